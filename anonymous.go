@@ -0,0 +1,150 @@
+package likeable
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	auth "github.com/nicolasbonnici/gorest/auth"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+const anonymousIDLocal = "likeable_anonymous_id"
+
+// Liker identifies who a like belongs to: an authenticated user or, failing
+// that, an anonymous device. The zero value is a caller with no identity.
+type Liker struct {
+	UserID      string
+	AnonymousID string
+}
+
+func (l Liker) IsZero() bool {
+	return l.UserID == "" && l.AnonymousID == ""
+}
+
+// Owns reports whether like was made by this liker.
+func (l Liker) Owns(like *Like) bool {
+	if like.LikerId != nil {
+		return l.UserID != "" && *like.LikerId == l.UserID
+	}
+	return l.AnonymousID != "" && like.AnonymousId != nil && *like.AnonymousId == l.AnonymousID
+}
+
+// apply stamps like with the identity of the liker.
+func (l Liker) apply(like *Like) {
+	if l.UserID != "" {
+		userID := l.UserID
+		like.LikerId = &userID
+		return
+	}
+	if l.AnonymousID != "" {
+		anonymousID := l.AnonymousID
+		like.AnonymousId = &anonymousID
+	}
+}
+
+func (l Liker) condition() query.Condition {
+	if l.UserID != "" {
+		return query.Eq("liker_id", l.UserID)
+	}
+	return query.And(query.IsNull("liker_id"), query.Eq("anonymous_id", l.AnonymousID))
+}
+
+// CallerLiker resolves the identity of the caller of a request: the
+// authenticated user when there is one, the verified anonymous device
+// otherwise.
+func CallerLiker(c fiber.Ctx) Liker {
+	if user := auth.GetAuthenticatedUser(c); user != nil {
+		return Liker{UserID: user.UserID}
+	}
+	return Liker{AnonymousID: AnonymousID(c)}
+}
+
+// AnonymousID returns the device id verified by the plugin middleware for the
+// current request. It is empty when device tokens are disabled and when the
+// request carries no valid token: the id of a token issued to it only counts
+// once the client sends the token back, so dropping it cannot mint a new
+// device per request. Likes made without one are told apart by IP address and
+// user agent instead.
+func AnonymousID(c fiber.Ctx) string {
+	id, _ := c.Locals(anonymousIDLocal).(string)
+	return id
+}
+
+// DeviceTokens issues and verifies anonymous device tokens. A token is a
+// random device id followed by an HMAC-SHA256 signature of it, so clients can
+// hold their identity without the server storing sessions, and cannot claim
+// another device's likes by guessing its id.
+type DeviceTokens struct {
+	secret []byte
+}
+
+func NewDeviceTokens(secret string) *DeviceTokens {
+	return &DeviceTokens{secret: []byte(secret)}
+}
+
+// Issue creates a new device id and its signed token.
+func (d *DeviceTokens) Issue() (id, token string) {
+	id = uuid.New().String()
+	return id, id + "." + d.sign(id)
+}
+
+// Verify returns the device id carried by token when its signature is valid.
+func (d *DeviceTokens) Verify(token string) (string, bool) {
+	id, signature, found := strings.Cut(token, ".")
+	if !found || id == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(d.sign(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+func (d *DeviceTokens) sign(id string) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// anonymousMiddleware resolves the device token of every request from the
+// configured header or cookie. Anonymous requests without a valid token are
+// issued a new one, returned both as a cookie for browsers and as a response
+// header for other clients, which should send it back in the request header.
+// Only a verified token identifies the device of a request.
+// Authenticated requests act as their account and are not issued one; the
+// token is only handed out once the request has run, as authentication may be
+// resolved by a handler further down the chain.
+func anonymousMiddleware(tokens *DeviceTokens, config *Config) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		token := c.Get(config.AnonymousHeaderName)
+		if token == "" {
+			token = c.Cookies(config.AnonymousCookieName)
+		}
+
+		id, verified := tokens.Verify(token)
+		if verified {
+			c.Locals(anonymousIDLocal, id)
+		} else {
+			_, token = tokens.Issue()
+		}
+
+		err := c.Next()
+		if !verified && auth.GetAuthenticatedUser(c) == nil {
+			c.Cookie(&fiber.Cookie{
+				Name:     config.AnonymousCookieName,
+				Value:    token,
+				Path:     "/",
+				MaxAge:   config.AnonymousCookieMaxAge,
+				Secure:   config.AnonymousCookieSecure,
+				HTTPOnly: true,
+				SameSite: fiber.CookieSameSiteLaxMode,
+			})
+			c.Set(config.AnonymousHeaderName, token)
+		}
+		return err
+	}
+}
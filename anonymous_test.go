@@ -0,0 +1,171 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	authcontext "github.com/nicolasbonnici/gorest/auth/context"
+)
+
+const testAnonymousSecret = "0123456789abcdef0123456789abcdef"
+
+func newDeviceLike(anonymousID, likeableID string) *Like {
+	return &Like{
+		Id:          uuid.New().String(),
+		AnonymousId: ptr(anonymousID),
+		LikeableId:  likeableID,
+		Likeable:    "post",
+		Reaction:    "like",
+		LikedAt:     time.Now(),
+	}
+}
+
+func TestDeviceTokens(t *testing.T) {
+	tokens := NewDeviceTokens(testAnonymousSecret)
+
+	id, token := tokens.Issue()
+	got, ok := tokens.Verify(token)
+	if !ok || got != id {
+		t.Fatalf("Verify(%q) = %q, %v, want %q, true", token, got, ok, id)
+	}
+
+	other := NewDeviceTokens(strings.Repeat("x", 32))
+	if _, ok := other.Verify(token); ok {
+		t.Error("token signed with another secret should not verify")
+	}
+
+	_, signature, _ := strings.Cut(token, ".")
+	forged := uuid.New().String() + "." + signature
+	if _, ok := tokens.Verify(forged); ok {
+		t.Error("token with a swapped device id should not verify")
+	}
+
+	for _, token := range []string{"", id, "." + signature} {
+		if _, ok := tokens.Verify(token); ok {
+			t.Errorf("Verify(%q) should fail", token)
+		}
+	}
+}
+
+func TestAnonymousMiddlewareIssuesTokensToAnonymousCallers(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AnonymousSecret = testAnonymousSecret
+
+	app := fiber.New()
+	app.Use(anonymousMiddleware(NewDeviceTokens(cfg.AnonymousSecret), &cfg))
+	app.Get("/", func(c fiber.Ctx) error {
+		if c.Query("user") != "" {
+			authcontext.SetUserID(c, c.Query("user"))
+		}
+		c.Set("X-Device", AnonymousID(c))
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("anonymous request: %v", err)
+	}
+	cookie := resp.Header.Get("Set-Cookie")
+	if resp.Header.Get(cfg.AnonymousHeaderName) == "" || !strings.Contains(cookie, "secure") {
+		t.Errorf("anonymous caller should be issued a secure cookie and header, got cookie %q", cookie)
+	}
+	if device := resp.Header.Get("X-Device"); device != "" {
+		t.Errorf("request without a token acts as device %q, want none until the token is sent back", device)
+	}
+
+	token := resp.Header.Get(cfg.AnonymousHeaderName)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(cfg.AnonymousHeaderName, token)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("request with a token: %v", err)
+	}
+	if id, _ := NewDeviceTokens(cfg.AnonymousSecret).Verify(token); resp.Header.Get("X-Device") != id {
+		t.Errorf("request with a token acts as device %q, want %q", resp.Header.Get("X-Device"), id)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/?user=user-1", nil))
+	if err != nil {
+		t.Fatalf("authenticated request: %v", err)
+	}
+	if resp.Header.Get(cfg.AnonymousHeaderName) != "" || resp.Header.Get("Set-Cookie") != "" {
+		t.Error("authenticated caller should not be issued a device token")
+	}
+}
+
+func TestLikerOwns(t *testing.T) {
+	userLike := newLike("user-1", "post-1", "like")
+	deviceLike := newDeviceLike("device-1", "post-1")
+
+	tests := []struct {
+		name  string
+		liker Liker
+		like  *Like
+		want  bool
+	}{
+		{"user owns own like", Liker{UserID: "user-1"}, userLike, true},
+		{"user does not own other user like", Liker{UserID: "user-2"}, userLike, false},
+		{"device owns own like", Liker{AnonymousID: "device-1"}, deviceLike, true},
+		{"device does not own other device like", Liker{AnonymousID: "device-2"}, deviceLike, false},
+		{"device does not own user like", Liker{AnonymousID: "user-1"}, userLike, false},
+		{"zero liker owns nothing", Liker{}, deviceLike, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.liker.Owns(tt.like); got != tt.want {
+				t.Errorf("Owns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnonymousLikes(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	// Two devices behind the same network and browser are told apart.
+	for _, device := range []string{"device-1", "device-2"} {
+		like := newDeviceLike(device, "post-1")
+		like.IpAddress = ptr("203.0.113.7")
+		like.UserAgent = ptr("Mozilla/5.0")
+		created, err := svc.Like(ctx, like)
+		if err != nil {
+			t.Fatalf("Like(%s): %v", device, err)
+		}
+		if !created {
+			t.Errorf("Like(%s) should create a like", device)
+		}
+	}
+
+	device := Liker{AnonymousID: "device-1"}
+	liked, err := svc.LikedByLikerBatch(ctx, device, "post", []string{"post-1", "post-2"})
+	if err != nil {
+		t.Fatalf("LikedByLikerBatch: %v", err)
+	}
+	if !liked["post-1"] || liked["post-2"] {
+		t.Errorf("unexpected liked states: %v", liked)
+	}
+
+	if err := svc.UnlikeByLiker(ctx, device, "post", "post-1"); err != nil {
+		t.Fatalf("Unlike: %v", err)
+	}
+	if err := svc.UnlikeByLiker(ctx, device, "post", "post-1"); !errors.Is(err, ErrLikeNotFound) {
+		t.Errorf("second Unlike = %v, want ErrLikeNotFound", err)
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 {
+		t.Errorf("Count = %d, want 1", count.Total)
+	}
+}
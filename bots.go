@@ -0,0 +1,231 @@
+package likeable
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/nicolasbonnici/gorest/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultBotUserAgents are the signatures of well-known crawlers, headless
+// browsers and HTTP libraries, matched against the user agent of anonymous
+// callers when the bot filter is on. Crawlers are told by a name ending in
+// "bot" followed by a version or separator, as in "Googlebot/2.1" or
+// "AdsBot-Google", so device names such as "CUBOT X30" are not caught.
+var DefaultBotUserAgents = []string{
+	`(?i)\bbot\b`,
+	`(?i)[a-z]bot[/;)-]`,
+	`(?i)crawler`,
+	`(?i)spider`,
+	`(?i)slurp`,
+	`(?i)facebookexternalhit`,
+	`(?i)bingpreview`,
+	`(?i)headlesschrome`,
+	`(?i)phantomjs`,
+	`(?i)puppeteer`,
+	`(?i)playwright`,
+	`(?i)selenium`,
+	`(?i)lighthouse`,
+	`(?i)^curl/`,
+	`(?i)^wget/`,
+	`(?i)python-requests`,
+	`(?i)python-urllib`,
+	`(?i)go-http-client`,
+	`(?i)okhttp`,
+	`(?i)^java/`,
+	`(?i)apache-httpclient`,
+}
+
+// BotList lists the user agent patterns and networks the bot filter denies
+// or allows. Allowed networks and user agents win over denied ones, and
+// networks are checked first. A bot list file holds the same keys as the
+// plugin configuration.
+type BotList struct {
+	UserAgents      []string `json:"bot_user_agents" yaml:"bot_user_agents"`
+	AllowUserAgents []string `json:"bot_allow_user_agents" yaml:"bot_allow_user_agents"`
+	DenyCIDRs       []string `json:"bot_deny_cidrs" yaml:"bot_deny_cidrs"`
+	AllowCIDRs      []string `json:"bot_allow_cidrs" yaml:"bot_allow_cidrs"`
+}
+
+// LoadBotList reads a bot list from a YAML file.
+func LoadBotList(path string) (BotList, error) {
+	var list BotList
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return list, err
+	}
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return list, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return list, nil
+}
+
+func (l BotList) merge(other BotList) BotList {
+	return BotList{
+		UserAgents:      append(append([]string{}, l.UserAgents...), other.UserAgents...),
+		AllowUserAgents: append(append([]string{}, l.AllowUserAgents...), other.AllowUserAgents...),
+		DenyCIDRs:       append(append([]string{}, l.DenyCIDRs...), other.DenyCIDRs...),
+		AllowCIDRs:      append(append([]string{}, l.AllowCIDRs...), other.AllowCIDRs...),
+	}
+}
+
+// botRules is a compiled BotList.
+type botRules struct {
+	denyAgents  []*regexp.Regexp
+	allowAgents []*regexp.Regexp
+	denyNets    []netip.Prefix
+	allowNets   []netip.Prefix
+}
+
+func (l BotList) compile() (*botRules, error) {
+	rules := &botRules{}
+	for _, list := range []struct {
+		patterns []string
+		target   *[]*regexp.Regexp
+	}{
+		{l.UserAgents, &rules.denyAgents},
+		{l.AllowUserAgents, &rules.allowAgents},
+	} {
+		for _, pattern := range list.patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("user agent pattern %q: %w", pattern, err)
+			}
+			*list.target = append(*list.target, re)
+		}
+	}
+	for _, list := range []struct {
+		cidrs  []string
+		target *[]netip.Prefix
+	}{
+		{l.DenyCIDRs, &rules.denyNets},
+		{l.AllowCIDRs, &rules.allowNets},
+	} {
+		for _, cidr := range list.cidrs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("network %q: %w", cidr, err)
+			}
+			*list.target = append(*list.target, prefix.Masked())
+		}
+	}
+	return rules, nil
+}
+
+// blocks reports whether a caller with this IP address and user agent is a
+// bot. Browsers always send a user agent, so callers without one are bots
+// unless allowed.
+func (r *botRules) blocks(ipAddress, userAgent string) bool {
+	if addr, err := netip.ParseAddr(ipAddress); err == nil {
+		addr = addr.Unmap()
+		if containsAddr(r.allowNets, addr) {
+			return false
+		}
+		if containsAddr(r.denyNets, addr) {
+			return true
+		}
+	}
+	if matchesAny(r.allowAgents, userAgent) {
+		return false
+	}
+	if userAgent == "" {
+		return true
+	}
+	return matchesAny(r.denyAgents, userAgent)
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// botFilter keeps anonymous bots from liking. Its rules are the default
+// signatures, the lists of the configuration and the ones of BotListFile,
+// which reload reads again.
+type botFilter struct {
+	config *Config
+
+	mu    sync.RWMutex
+	rules *botRules
+}
+
+func newBotFilter(config *Config) *botFilter {
+	f := &botFilter{config: config, rules: &botRules{}}
+	if err := f.reload(); err != nil {
+		logger.Log.Error("likeable: loading the bot list", "error", err)
+	}
+	return f
+}
+
+// botList returns the bot list of config, the file aside.
+func (c *Config) botList() BotList {
+	return BotList{UserAgents: DefaultBotUserAgents}.merge(BotList{
+		UserAgents:      c.BotUserAgents,
+		AllowUserAgents: c.BotAllowUserAgents,
+		DenyCIDRs:       c.BotDenyCIDRs,
+		AllowCIDRs:      c.BotAllowCIDRs,
+	})
+}
+
+// reload compiles the bot list again, reading BotListFile. The rules in
+// place are kept when it fails. Config.Validate leaves the file to it, so a
+// missing or invalid file is reported when the filter is created or
+// reloaded.
+func (f *botFilter) reload() error {
+	list := f.config.botList()
+	if f.config.BotListFile != "" {
+		file, err := LoadBotList(f.config.BotListFile)
+		if err != nil {
+			return err
+		}
+		list = list.merge(file)
+	}
+
+	rules, err := list.compile()
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.rules = rules
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *botFilter) blocks(ipAddress, userAgent string) bool {
+	if !f.config.BotFilter {
+		return false
+	}
+	f.mu.RLock()
+	rules := f.rules
+	f.mu.RUnlock()
+	return rules.blocks(ipAddress, userAgent)
+}
+
+// size returns the number of rules in place, by list.
+func (f *botFilter) size() LikeBotListResponseDTO {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return LikeBotListResponseDTO{
+		UserAgents:      len(f.rules.denyAgents),
+		AllowUserAgents: len(f.rules.allowAgents),
+		DenyCIDRs:       len(f.rules.denyNets),
+		AllowCIDRs:      len(f.rules.allowNets),
+	}
+}
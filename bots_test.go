@@ -0,0 +1,118 @@
+package likeable
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestBotRules(t *testing.T) {
+	rules, err := BotList{
+		UserAgents:      DefaultBotUserAgents,
+		AllowUserAgents: []string{`(?i)^Feedly/`},
+		DenyCIDRs:       []string{"192.0.2.0/24"},
+		AllowCIDRs:      []string{"192.0.2.10/32"},
+	}.compile()
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0"
+	tests := []struct {
+		ip, userAgent string
+		want          bool
+	}{
+		{"198.51.100.1", firefox, false},
+		{"198.51.100.1", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true},
+		{"198.51.100.1", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36", true},
+		{"198.51.100.1", "Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)", true},
+		{"198.51.100.1", "AdsBot-Google (+http://www.google.com/adsbot.html)", true},
+		{"198.51.100.1", "Mozilla/5.0 (Linux; Android 10; CUBOT X30 Build/QP1A.190711.020) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", false},
+		{"198.51.100.1", "curl/8.5.0", true},
+		{"198.51.100.1", "", true},
+		{"192.0.2.10", "", false},
+		{"198.51.100.1", "Feedly/1.0 (+http://www.feedly.com/fetcher.html; like FeedFetcher-Google)", false},
+		{"192.0.2.1", firefox, true},
+		{"::ffff:192.0.2.1", firefox, true},
+		{"192.0.2.10", "curl/8.5.0", false},
+	}
+	for _, tt := range tests {
+		if got := rules.blocks(tt.ip, tt.userAgent); got != tt.want {
+			t.Errorf("blocks(%q, %q) = %v, want %v", tt.ip, tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestBotFilterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bots.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write bot list: %v", err)
+		}
+	}
+	write("bot_user_agents:\n  - (?i)scraper\n")
+
+	cfg := DefaultConfig()
+	cfg.AnonymousSecret = testAnonymousSecret
+	cfg.BotFilter = true
+	cfg.BotListFile = path
+	hooks := NewLikeHooks(newTestDB(t), &cfg)
+
+	app := fiber.New()
+	app.Use(anonymousMiddleware(NewDeviceTokens(cfg.AnonymousSecret), &cfg))
+	registerLikeRoutes(app, hooks)
+	_, token := NewDeviceTokens(testAnonymousSecret).Issue()
+
+	like := func(userAgent string) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/likes", strings.NewReader(`{"likeable":"post","likeableId":"post-1"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set(cfg.AnonymousHeaderName, token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("POST /likes: %v", err)
+		}
+		return resp.StatusCode
+	}
+	if code := like("Mozilla/5.0 (compatible; Googlebot/2.1)"); code != fiber.StatusForbidden {
+		t.Errorf("crawler like = %d, want 403", code)
+	}
+	if code := like("Scraper/2.0"); code != fiber.StatusForbidden {
+		t.Errorf("like matching the file = %d, want 403", code)
+	}
+
+	write("bot_allow_user_agents:\n  - (?i)scraper\nbot_deny_cidrs:\n  - 192.0.2.0/24\n")
+	if err := hooks.bots.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	want := LikeBotListResponseDTO{UserAgents: len(DefaultBotUserAgents), AllowUserAgents: 1, DenyCIDRs: 1}
+	if got := hooks.bots.size(); got != want {
+		t.Errorf("size = %+v, want %+v", got, want)
+	}
+	if code := like("Scraper/2.0"); code != fiber.StatusCreated {
+		t.Errorf("like allowed by the reloaded file = %d, want 201", code)
+	}
+
+	write("bot_deny_cidrs:\n  - not-a-network\n")
+	if err := hooks.bots.reload(); err == nil {
+		t.Error("reloading an invalid file succeeded")
+	}
+	if got := hooks.bots.size(); got != want {
+		t.Errorf("size after a failed reload = %+v, want the previous rules kept", got)
+	}
+
+	req := httptest.NewRequest("POST", "/likes/bots/reload", nil)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("POST /likes/bots/reload: %v", err)
+	}
+	if resp.StatusCode == fiber.StatusOK {
+		t.Errorf("anonymous reload = %d, want it refused", resp.StatusCode)
+	}
+}
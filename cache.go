@@ -0,0 +1,157 @@
+package likeable
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache stores the results of LikeService count and liked-state lookups.
+// Values are LikeCount for counts and bool for liked states. Implementations
+// must be safe for concurrent use; a shared store can replace the default
+// in-memory LRUCache, provided it invalidates keys across instances.
+type Cache interface {
+	Get(ctx context.Context, key string) (any, bool)
+	Set(ctx context.Context, key string, value any)
+	Delete(ctx context.Context, keys ...string)
+}
+
+// CacheStats reports how LikeService lookups were served by its cache.
+type CacheStats struct {
+	// Hits counts objects served from the cache.
+	Hits uint64 `json:"hits"`
+	// Misses counts objects that had to be loaded from the database.
+	Misses uint64 `json:"misses"`
+	// Shared counts database loads avoided by joining an identical load
+	// already in flight.
+	Shared uint64 `json:"shared"`
+}
+
+type cacheStats struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	shared atomic.Uint64
+}
+
+func (s *cacheStats) snapshot() CacheStats {
+	return CacheStats{Hits: s.hits.Load(), Misses: s.misses.Load(), Shared: s.shared.Load()}
+}
+
+func countCacheKey(likeableType, likeableID string) string {
+	return "count:" + likeableType + ":" + likeableID
+}
+
+func likedCacheKey(liker Liker, likeableType, likeableID string) string {
+	if liker.UserID != "" {
+		return "liked:u:" + liker.UserID + ":" + likeableType + ":" + likeableID
+	}
+	return "liked:a:" + liker.AnonymousID + ":" + likeableType + ":" + likeableID
+}
+
+// flightKey identifies a batch load for singleflight, so concurrent misses
+// on the same objects share one query.
+func flightKey(prefix string, ids []string) string {
+	return prefix + "|" + strings.Join(ids, ",")
+}
+
+// likeCacheKeys returns the cache keys a write to like makes stale.
+func likeCacheKeys(like Like) []string {
+	keys := []string{countCacheKey(like.Likeable, like.LikeableId)}
+	if like.LikerId != nil {
+		keys = append(keys, likedCacheKey(Liker{UserID: *like.LikerId}, like.Likeable, like.LikeableId))
+	}
+	if like.AnonymousId != nil {
+		keys = append(keys, likedCacheKey(Liker{AnonymousID: *like.AnonymousId}, like.Likeable, like.LikeableId))
+	}
+	return keys
+}
+
+// LRUCache is a bounded in-memory Cache. Once full, the least recently used
+// entry is evicted, and entries expire after a fixed TTL so counts written by
+// other instances are eventually picked up.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func NewLRUCache(capacity int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if c.now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRUCache) Delete(ctx context.Context, keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := c.entries[key]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+// Len returns the number of entries currently held, expired or not.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRUCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*lruEntry).key)
+}
@@ -0,0 +1,161 @@
+package likeable
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := NewLRUCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Set(ctx, "a", 1)
+	cache.Set(ctx, "b", 2)
+	if _, ok := cache.Get(ctx, "a"); !ok {
+		t.Fatal("a should be cached")
+	}
+	// b is now the least recently used entry.
+	cache.Set(ctx, "c", 3)
+	if _, ok := cache.Get(ctx, "b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if v, ok := cache.Get(ctx, "c"); !ok || v != 3 {
+		t.Errorf("Get(c) = %v, %v", v, ok)
+	}
+
+	cache.Delete(ctx, "a", "missing")
+	if _, ok := cache.Get(ctx, "a"); ok {
+		t.Error("a should have been deleted")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get(ctx, "c"); ok {
+		t.Error("c should have expired")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Len = %d, want expired entries dropped", cache.Len())
+	}
+}
+
+func TestCachedCounts(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db, WithCache(NewLRUCache(100, time.Minute)))
+	ctx := context.Background()
+	user := Liker{UserID: "user-1"}
+
+	if _, err := svc.Like(ctx, newLike("user-2", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		counts, err := svc.CountBatch(ctx, "post", []string{"post-1", "post-2"})
+		if err != nil {
+			t.Fatalf("CountBatch: %v", err)
+		}
+		if counts["post-1"].Total != 1 || counts["post-2"].Total != 0 {
+			t.Errorf("CountBatch = %+v", counts)
+		}
+		// Callers own the returned breakdown.
+		counts["post-1"].Reactions["like"] = 42
+	}
+	if _, err := svc.LikedByLikerBatch(ctx, user, "post", []string{"post-1"}); err != nil {
+		t.Fatalf("LikedByLikerBatch: %v", err)
+	}
+
+	stats := svc.CacheStats()
+	if stats.Hits != 2 || stats.Misses != 3 {
+		t.Errorf("CacheStats = %+v, want 2 hits and 3 misses", stats)
+	}
+
+	// A write invalidates both the count and the liker's state.
+	if _, err := svc.Like(ctx, newLike("user-1", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 2 || count.Reactions["like"] != 2 {
+		t.Errorf("Count after like = %+v, want 2", count)
+	}
+	liked, err := svc.LikedByLikerBatch(ctx, user, "post", []string{"post-1"})
+	if err != nil {
+		t.Fatalf("LikedByLikerBatch: %v", err)
+	}
+	if !liked["post-1"] {
+		t.Error("liked state should be refreshed after liking")
+	}
+
+	if err := svc.UnlikeByLiker(ctx, user, "post", "post-1"); err != nil {
+		t.Fatalf("Unlike: %v", err)
+	}
+	count, err = svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 {
+		t.Errorf("Count after unlike = %d, want 1", count.Total)
+	}
+}
+
+func TestSharedLoad(t *testing.T) {
+	svc := NewLikeService(newTestDB(t))
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func() (any, error) {
+		loads.Add(1)
+		<-release
+		return 7, nil
+	}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := svc.sharedLoad("count:post|post-1", load)
+			if err != nil || v != 7 {
+				t.Errorf("sharedLoad = %v, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := uint64(loads.Load()) + svc.CacheStats().Shared; got != callers {
+		t.Errorf("loads + shared = %d, want %d", got, callers)
+	}
+}
+
+func TestLoadsRacingInvalidationAreNotCached(t *testing.T) {
+	db := newTestDB(t)
+	cache := NewLRUCache(100, time.Minute)
+	svc := NewLikeService(db, WithCache(cache))
+	ctx := context.Background()
+
+	// A load starts, reads the state before the like below, and caches it
+	// once the like committed.
+	gen := svc.generation.Load()
+	key := countCacheKey("post", "post-1")
+	if _, err := svc.Like(ctx, newLike("user-1", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	cache.Set(ctx, key, newLikeCount())
+	svc.dropIfInvalidated(ctx, gen, []string{key})
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 {
+		t.Errorf("Count = %d, want the stale load dropped", count.Total)
+	}
+}
@@ -0,0 +1,165 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gofiber/fiber/v3"
+	auth "github.com/nicolasbonnici/gorest/auth"
+)
+
+// LikeAction is what like callbacks are given: the like being made or
+// removed, and the authenticated user behind the request, nil for anonymous
+// callers.
+//
+// For likes, Like is the like being inserted. For unlikes, it is the like
+// itself when deleted by id, and otherwise its target and liker, with the
+// reaction removed or an empty one when all of them are.
+type LikeAction struct {
+	Like *Like
+	User *auth.AuthenticatedUser
+}
+
+// BeforeFunc runs before a like or unlike is written. Returning an error
+// vetoes it: a *VetoError or *fiber.Error is answered with its status, any
+// other error with 403 and its message. Callbacks must not modify the like.
+type BeforeFunc func(ctx context.Context, action LikeAction) error
+
+// AfterFunc runs once a like or unlike is committed, in the request that
+// made it, so slow work belongs in a goroutine.
+type AfterFunc func(ctx context.Context, action LikeAction)
+
+// VetoError rejects a like or unlike from a BeforeFunc with an HTTP status.
+type VetoError struct {
+	Status  int
+	Message string
+}
+
+// Veto returns a VetoError answering the request with status and message.
+func Veto(status int, message string) *VetoError {
+	return &VetoError{Status: status, Message: message}
+}
+
+func (e *VetoError) Error() string {
+	return e.Message
+}
+
+// likeCallbacks holds the callbacks registered by other plugins. They can be
+// registered at any time, including while requests are served, and run in
+// registration order.
+type likeCallbacks struct {
+	mu           sync.RWMutex
+	beforeLike   []BeforeFunc
+	afterLike    []AfterFunc
+	beforeUnlike []BeforeFunc
+	afterUnlike  []AfterFunc
+}
+
+func (cb *likeCallbacks) register(list *[]BeforeFunc, fn BeforeFunc) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	*list = append(*list, fn)
+}
+
+func (cb *likeCallbacks) registerAfter(list *[]AfterFunc, fn AfterFunc) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	*list = append(*list, fn)
+}
+
+// before runs the callbacks of list until one vetoes the action, and returns
+// its veto as a *fiber.Error.
+func (cb *likeCallbacks) before(ctx context.Context, list *[]BeforeFunc, action LikeAction) error {
+	cb.mu.RLock()
+	callbacks := *list
+	cb.mu.RUnlock()
+
+	for _, fn := range callbacks {
+		if err := fn(ctx, action); err != nil {
+			return vetoError(err)
+		}
+	}
+	return nil
+}
+
+func (cb *likeCallbacks) after(ctx context.Context, list *[]AfterFunc, action LikeAction) {
+	cb.mu.RLock()
+	callbacks := *list
+	cb.mu.RUnlock()
+
+	for _, fn := range callbacks {
+		fn(ctx, action)
+	}
+}
+
+// vetoError maps the error a BeforeFunc vetoed with to the HTTP error
+// answering the request.
+func vetoError(err error) *fiber.Error {
+	var veto *VetoError
+	if errors.As(err, &veto) {
+		return fiber.NewError(veto.Status, veto.Message)
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr
+	}
+	return fiber.NewError(fiber.StatusForbidden, err.Error())
+}
+
+// BeforeLike registers fn to run before a like is made, through any of the
+// like endpoints. It may veto the like.
+func (p *LikeablePlugin) BeforeLike(fn BeforeFunc) {
+	p.callbacks.register(&p.callbacks.beforeLike, fn)
+}
+
+// AfterLike registers fn to run once a like is made.
+func (p *LikeablePlugin) AfterLike(fn AfterFunc) {
+	p.callbacks.registerAfter(&p.callbacks.afterLike, fn)
+}
+
+// BeforeUnlike registers fn to run before a like is removed, through any of
+// the unlike endpoints. It may veto the removal.
+func (p *LikeablePlugin) BeforeUnlike(fn BeforeFunc) {
+	p.callbacks.register(&p.callbacks.beforeUnlike, fn)
+}
+
+// AfterUnlike registers fn to run once a like is removed.
+func (p *LikeablePlugin) AfterUnlike(fn AfterFunc) {
+	p.callbacks.registerAfter(&p.callbacks.afterUnlike, fn)
+}
+
+// beforeLike takes a rate limit token for a like, then vets it.
+func (h *LikeHooks) beforeLike(ctx context.Context, who caller, like *Like) error {
+	if err := h.rateLimit(ctx, who, RateLimitLike, like.Likeable); err != nil {
+		return err
+	}
+	return h.vetLike(ctx, who, like)
+}
+
+// vetLike runs the callbacks of a like, then screens it for fraud.
+func (h *LikeHooks) vetLike(ctx context.Context, who caller, like *Like) error {
+	if err := h.callbacks.before(ctx, &h.callbacks.beforeLike, LikeAction{Like: like, User: who.user}); err != nil {
+		return err
+	}
+	return h.screenLike(ctx, like)
+}
+
+func (h *LikeHooks) afterLike(ctx context.Context, who caller, like *Like) {
+	h.callbacks.after(ctx, &h.callbacks.afterLike, LikeAction{Like: like, User: who.user})
+}
+
+func (h *LikeHooks) beforeUnlike(ctx context.Context, who caller, like *Like) error {
+	if err := h.rateLimit(ctx, who, RateLimitUnlike, like.Likeable); err != nil {
+		return err
+	}
+	return h.vetUnlike(ctx, who, like)
+}
+
+func (h *LikeHooks) vetUnlike(ctx context.Context, who caller, like *Like) error {
+	return h.callbacks.before(ctx, &h.callbacks.beforeUnlike, LikeAction{Like: like, User: who.user})
+}
+
+func (h *LikeHooks) afterUnlike(ctx context.Context, who caller, like *Like) {
+	h.callbacks.after(ctx, &h.callbacks.afterUnlike, LikeAction{Like: like, User: who.user})
+}
@@ -0,0 +1,76 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestCallbacks(t *testing.T) {
+	p := &LikeablePlugin{}
+	ctx := context.Background()
+	like := newLike("user-1", "post-1", "like")
+
+	var calls []string
+	p.BeforeLike(func(ctx context.Context, action LikeAction) error {
+		calls = append(calls, "before like "+action.Like.LikeableId)
+		return nil
+	})
+	p.BeforeLike(func(ctx context.Context, action LikeAction) error {
+		if action.Like.LikeableId == "locked" {
+			return Veto(fiber.StatusLocked, "Post is locked")
+		}
+		return nil
+	})
+	p.AfterLike(func(ctx context.Context, action LikeAction) {
+		calls = append(calls, "after like")
+	})
+	p.BeforeUnlike(func(ctx context.Context, action LikeAction) error {
+		return errors.New("Unlikes are disabled")
+	})
+	p.AfterUnlike(func(ctx context.Context, action LikeAction) {
+		calls = append(calls, "after unlike")
+	})
+
+	cb := &p.callbacks
+	if err := cb.before(ctx, &cb.beforeLike, LikeAction{Like: like}); err != nil {
+		t.Fatalf("before like: %v", err)
+	}
+	cb.after(ctx, &cb.afterLike, LikeAction{Like: like})
+	if len(calls) != 2 || calls[0] != "before like post-1" || calls[1] != "after like" {
+		t.Errorf("calls = %v", calls)
+	}
+
+	locked := newLike("user-1", "locked", "like")
+	err := cb.before(ctx, &cb.beforeLike, LikeAction{Like: locked})
+	var fiberErr *fiber.Error
+	if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusLocked || fiberErr.Message != "Post is locked" {
+		t.Errorf("veto = %v, want 423 Post is locked", err)
+	}
+
+	err = cb.before(ctx, &cb.beforeUnlike, LikeAction{Like: like})
+	if !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusForbidden || fiberErr.Message != "Unlikes are disabled" {
+		t.Errorf("plain error = %v, want 403 with its message", err)
+	}
+	cb.after(ctx, &cb.afterUnlike, LikeAction{Like: like})
+	if len(calls) != 4 || calls[3] != "after unlike" {
+		t.Errorf("calls = %v", calls)
+	}
+}
+
+func TestVetoError(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		code int
+	}{
+		{Veto(fiber.StatusConflict, "no"), fiber.StatusConflict},
+		{fiber.NewError(fiber.StatusTooManyRequests, "slow down"), fiber.StatusTooManyRequests},
+		{errors.New("no"), fiber.StatusForbidden},
+	} {
+		if got := vetoError(tt.err); got.Code != tt.code {
+			t.Errorf("vetoError(%v) = %d, want %d", tt.err, got.Code, tt.code)
+		}
+	}
+}
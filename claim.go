@@ -0,0 +1,251 @@
+package likeable
+
+import (
+	"context"
+
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// AnonymousKey identifies the likes a visitor made before signing in: by
+// device id when they held a device token, by IP address and user agent
+// otherwise.
+type AnonymousKey struct {
+	AnonymousID string
+	IpAddress   string
+	UserAgent   string
+}
+
+func (k AnonymousKey) IsZero() bool {
+	return k.AnonymousID == "" && k.IpAddress == "" && k.UserAgent == ""
+}
+
+// condition matches the likes of the visitor, whose IP address and user agent
+// are stored in the form given by tracking.
+func (k AnonymousKey) condition(tracking *trackingHasher) query.Condition {
+	probe := &Like{}
+	if k.AnonymousID != "" {
+		probe.AnonymousId = &k.AnonymousID
+		return likerCondition(probe)
+	}
+	// Mirrors LikeHooks.prepareLike, which leaves empty values unset.
+	if k.IpAddress != "" {
+		probe.IpAddress = &k.IpAddress
+	}
+	if k.UserAgent != "" {
+		probe.UserAgent = &k.UserAgent
+	}
+	tracking.apply(probe)
+	return likerCondition(probe)
+}
+
+// ClaimResult reports the outcome of ClaimAnonymous.
+type ClaimResult struct {
+	// Migrated is the number of anonymous likes reassigned to the user.
+	Migrated int64
+	// Collapsed is the number of anonymous likes dropped because the user
+	// already held them.
+	Collapsed int64
+}
+
+// claimAttempts bounds how many times ClaimAnonymous runs again after losing
+// a race with a like of the user.
+const claimAttempts = 3
+
+// ClaimAnonymous reassigns the anonymous likes identified by key to userID.
+// Likes duplicating one the user already holds are deleted instead, so the
+// unique_authenticated_like index is never violated; in single reaction mode
+// this also applies to any other reaction on an object the user has already
+// reacted to, the user's own reaction winning. A like the user makes while
+// the claim runs can still collide with a reassigned one: the claim is then
+// run again, which deletes the duplicate. Reassigned likes follow the shadow
+// ban of the user rather than the one of the device.
+func (s *LikeService) ClaimAnonymous(ctx context.Context, userID string, key AnonymousKey) (ClaimResult, error) {
+	if userID == "" || key.IsZero() {
+		return ClaimResult{}, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := s.claimAnonymous(ctx, userID, key)
+		if err == nil || !isUniqueViolation(err) || attempt == claimAttempts {
+			return result, err
+		}
+	}
+}
+
+func (s *LikeService) claimAnonymous(ctx context.Context, userID string, key AnonymousKey) (ClaimResult, error) {
+	var result ClaimResult
+	err := s.withTx(ctx, func(tx database.Database) error {
+		anonymous, err := crud.New[Like](tx).GetAllPaginated(ctx, crud.PaginationOptions{
+			Conditions: []query.Condition{key.condition(s.tracking)},
+			OrderBy:    []crud.OrderByClause{{Column: "liked_at", Direction: query.ASC}},
+		})
+		if err != nil {
+			return err
+		}
+		if len(anonymous.Items) == 0 {
+			return nil
+		}
+
+		held, err := s.heldOnTargets(ctx, tx, userID, anonymous.Items)
+		if err != nil {
+			return err
+		}
+
+		var migrate, collapse []Like
+		for _, like := range anonymous.Items {
+			target := likeTarget{like.Likeable, like.LikeableId}
+			reactions := held[target]
+			if reactions[like.Reaction] || (s.config.ReactionMode == ReactionModeSingle && len(reactions) > 0) {
+				collapse = append(collapse, like)
+				continue
+			}
+			if reactions == nil {
+				reactions = make(map[string]bool)
+				held[target] = reactions
+			}
+			reactions[like.Reaction] = true
+			migrate = append(migrate, like)
+		}
+
+		collapsed, err := s.deleteLikes(ctx, tx, collapse)
+		if err != nil {
+			return err
+		}
+		if err := s.reassignLikes(ctx, tx, userID, migrate); err != nil {
+			return err
+		}
+
+		result.Migrated = int64(len(migrate))
+		result.Collapsed = int64(len(collapsed))
+		return nil
+	})
+	return result, err
+}
+
+type likeTarget struct {
+	likeable   string
+	likeableID string
+}
+
+// heldOnTargets returns the reactions userID already holds on the objects
+// liked by likes.
+func (s *LikeService) heldOnTargets(ctx context.Context, db database.Database, userID string, likes []Like) (map[likeTarget]map[string]bool, error) {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, like := range likes {
+		if !seen[like.LikeableId] {
+			seen[like.LikeableId] = true
+			ids = append(ids, like.LikeableId)
+		}
+	}
+
+	result, err := crud.New[Like](db).GetAllPaginated(ctx, crud.PaginationOptions{
+		Conditions: []query.Condition{
+			query.Eq("liker_id", userID),
+			query.In("likeable_id", toAnySlice(ids)...),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[likeTarget]map[string]bool)
+	for _, like := range result.Items {
+		target := likeTarget{like.Likeable, like.LikeableId}
+		if held[target] == nil {
+			held[target] = make(map[string]bool)
+		}
+		held[target][like.Reaction] = true
+	}
+	return held, nil
+}
+
+// reassignLikes hands likes over to userID. Likes shadowed by a ban, or
+// counted, are shadowed by the ban of the user, if any, instead of the one of
+// their device; likes shadowed for another reason, such as fraud, stay
+// shadowed. Counters follow.
+func (s *LikeService) reassignLikes(ctx context.Context, db database.Database, userID string, likes []Like) error {
+	if len(likes) == 0 {
+		return nil
+	}
+
+	ban, err := s.shadowBanOf(ctx, db, Liker{UserID: userID})
+	if err != nil {
+		return err
+	}
+	var shadow *string
+	if ban != nil {
+		banned := ShadowBanned
+		shadow = &banned
+	}
+	var before, after []Like
+	var reshadowed []any
+	for _, like := range likes {
+		if like.Shadow != nil && *like.Shadow != ShadowBanned {
+			continue
+		}
+		if (like.Shadow == nil) == (shadow == nil) {
+			continue
+		}
+		before = append(before, like)
+		like.Shadow = shadow
+		after = append(after, like)
+		reshadowed = append(reshadowed, like.Id)
+	}
+
+	ids := make([]any, len(likes))
+	for i, like := range likes {
+		ids[i] = like.Id
+	}
+
+	q, args, err := query.New(db.Dialect()).
+		Update(likesTable).
+		Set("liker_id", userID).
+		Set("anonymous_id", nil).
+		Where(query.In("id", ids...)).
+		Build()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(ctx, q, args...); err != nil {
+		return err
+	}
+
+	if len(reshadowed) > 0 {
+		var value any
+		if shadow != nil {
+			value = *shadow
+		}
+		q, args, err := query.New(db.Dialect()).
+			Update(likesTable).
+			Set("shadow", value).
+			Where(query.In("id", reshadowed...)).
+			Build()
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(ctx, q, args...); err != nil {
+			return err
+		}
+		if err := s.adjustCounts(ctx, db, before, -1); err != nil {
+			return err
+		}
+		if err := s.adjustCounts(ctx, db, after, 1); err != nil {
+			return err
+		}
+	}
+
+	// Both the device and the user see their liked state change.
+	claimed := make([]Like, 0, 2*len(likes))
+	for _, like := range likes {
+		owned := like
+		owned.LikerId = &userID
+		owned.AnonymousId = nil
+		claimed = append(claimed, like, owned)
+	}
+	s.invalidate(ctx, db, claimed)
+	return nil
+}
@@ -0,0 +1,181 @@
+package likeable
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	authcontext "github.com/nicolasbonnici/gorest/auth/context"
+)
+
+func TestClaimAnonymous(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	for _, id := range []string{"post-1", "post-2", "post-3"} {
+		if _, err := svc.Like(ctx, newDeviceLike("device-1", id)); err != nil {
+			t.Fatalf("Like: %v", err)
+		}
+	}
+	// post-2 is already liked by the user and post-3 already carries another
+	// reaction of theirs, so both anonymous likes collapse in single mode.
+	if _, err := svc.Like(ctx, newLike("user-1", "post-2", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if _, err := svc.Like(ctx, newLike("user-1", "post-3", "love")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if _, err := svc.Like(ctx, newDeviceLike("device-2", "post-1")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+
+	result, err := svc.ClaimAnonymous(ctx, "user-1", AnonymousKey{AnonymousID: "device-1"})
+	if err != nil {
+		t.Fatalf("ClaimAnonymous: %v", err)
+	}
+	if result.Migrated != 1 || result.Collapsed != 2 {
+		t.Errorf("ClaimAnonymous = %+v, want 1 migrated and 2 collapsed", result)
+	}
+
+	user := Liker{UserID: "user-1"}
+	liked, err := svc.LikedByLikerBatch(ctx, user, "post", []string{"post-1", "post-2", "post-3"})
+	if err != nil {
+		t.Fatalf("LikedByLikerBatch: %v", err)
+	}
+	for _, id := range []string{"post-1", "post-2", "post-3"} {
+		if !liked[id] {
+			t.Errorf("user should like %s after claiming", id)
+		}
+	}
+
+	liked, err = svc.LikedByLikerBatch(ctx, Liker{AnonymousID: "device-1"}, "post", []string{"post-1"})
+	if err != nil {
+		t.Fatalf("LikedByLikerBatch: %v", err)
+	}
+	if liked["post-1"] {
+		t.Error("claimed likes should no longer belong to the device")
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 2 {
+		t.Errorf("Count = %d, want 2: another device's like must not be claimed", count.Total)
+	}
+
+	again, err := svc.ClaimAnonymous(ctx, "user-1", AnonymousKey{AnonymousID: "device-1"})
+	if err != nil {
+		t.Fatalf("ClaimAnonymous: %v", err)
+	}
+	if again != (ClaimResult{}) {
+		t.Errorf("second claim = %+v, want nothing to claim", again)
+	}
+}
+
+func TestClaimAnonymousShadowBans(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	for _, like := range []*Like{newDeviceLike("banned-device", "post-1"), newDeviceLike("device-2", "post-2")} {
+		if _, err := svc.Like(ctx, like); err != nil {
+			t.Fatalf("Like: %v", err)
+		}
+	}
+	for _, liker := range []Liker{{AnonymousID: "banned-device"}, {UserID: "banned-user"}} {
+		if _, err := svc.ShadowBan(ctx, liker, ""); err != nil {
+			t.Fatalf("ShadowBan: %v", err)
+		}
+	}
+
+	claim := func(userID, device string) {
+		t.Helper()
+		if _, err := svc.ClaimAnonymous(ctx, userID, AnonymousKey{AnonymousID: device}); err != nil {
+			t.Fatalf("ClaimAnonymous: %v", err)
+		}
+	}
+	counted := func(likeableID string) int64 {
+		t.Helper()
+		count, err := svc.Count(ctx, "post", likeableID)
+		if err != nil {
+			t.Fatalf("Count: %v", err)
+		}
+		return count.Total
+	}
+
+	claim("user-1", "banned-device")
+	if n := counted("post-1"); n != 1 {
+		t.Errorf("Count = %d, want the like claimed from a banned device counted for its user", n)
+	}
+	claim("banned-user", "device-2")
+	if n := counted("post-2"); n != 0 {
+		t.Errorf("Count = %d, want the like claimed by a banned user shadowed", n)
+	}
+
+	report, err := svc.Reconcile(ctx, ReconcileOptions{})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("counters drifted: %+v", report.Discrepancies)
+	}
+}
+
+func TestClaimAnonymousByIPAndUserAgent(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.ReactionMode = ReactionModeMultiple
+	svc := NewLikeService(db, WithConfig(&cfg))
+	ctx := context.Background()
+
+	for _, reaction := range []string{"like", "love"} {
+		like := newLike("", "post-1", reaction)
+		like.LikerId = nil
+		like.IpAddress = ptr("203.0.113.7")
+		like.UserAgent = ptr("Mozilla/5.0")
+		if _, err := svc.Like(ctx, like); err != nil {
+			t.Fatalf("Like: %v", err)
+		}
+	}
+	if _, err := svc.Like(ctx, newLike("user-1", "post-1", "love")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+
+	key := AnonymousKey{IpAddress: "203.0.113.7", UserAgent: "Mozilla/5.0"}
+	result, err := svc.ClaimAnonymous(ctx, "user-1", key)
+	if err != nil {
+		t.Fatalf("ClaimAnonymous: %v", err)
+	}
+	if result.Migrated != 1 || result.Collapsed != 1 {
+		t.Errorf("ClaimAnonymous = %+v, want 1 migrated and 1 collapsed", result)
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 2 || count.Reactions["like"] != 1 || count.Reactions["love"] != 1 {
+		t.Errorf("Count = %+v, want one like and one love", count)
+	}
+}
+
+func TestClaimRequiresDeviceToken(t *testing.T) {
+	cfg := DefaultConfig()
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		authcontext.SetUserID(c, "user-1")
+		return c.Next()
+	})
+	registerLikeRoutes(app, NewLikeHooks(newTestDB(t), &cfg))
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/likes/claim", nil))
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("claim without a device token = %d, want 403", resp.StatusCode)
+	}
+}
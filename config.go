@@ -3,16 +3,171 @@ package likeable
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/nicolasbonnici/gorest/database"
 )
 
+const (
+	// ReactionModeSingle allows one reaction per liker and object. Creating a
+	// second reaction is rejected, while toggling or setting one replaces the
+	// reaction already held.
+	ReactionModeSingle = "single"
+	// ReactionModeMultiple allows a liker to add several distinct reactions to
+	// the same object, each of them counted separately.
+	ReactionModeMultiple = "multiple"
+)
+
+// maxReactionLength matches the width of the reaction column.
+const maxReactionLength = 32
+
+// minAnonymousSecretLength keeps device token signatures out of brute-force
+// reach.
+const minAnonymousSecretLength = 32
+
 type Config struct {
 	Database           database.Database
-	AllowedTypes       []string `json:"allowed_types" yaml:"allowed_types"`
-	PaginationLimit    int      `json:"pagination_limit" yaml:"pagination_limit"`
-	MaxPaginationLimit int      `json:"max_pagination_limit" yaml:"max_pagination_limit"`
-	EnableUserLikes    bool     `json:"enable_user_likes" yaml:"enable_user_likes"`
+	AllowedTypes       []string            `json:"allowed_types" yaml:"allowed_types"`
+	PaginationLimit    int                 `json:"pagination_limit" yaml:"pagination_limit"`
+	MaxPaginationLimit int                 `json:"max_pagination_limit" yaml:"max_pagination_limit"`
+	EnableUserLikes    bool                `json:"enable_user_likes" yaml:"enable_user_likes"`
+	DefaultReaction    string              `json:"default_reaction" yaml:"default_reaction"`
+	Reactions          map[string][]string `json:"reactions" yaml:"reactions"`
+	ReactionMode       string              `json:"reaction_mode" yaml:"reaction_mode"`
+
+	// PublicFields lists the restrictable like fields shown to every caller.
+	// The others are only shown to the liker and to callers holding one of
+	// AdminRoles, who alone may also filter and order likes on them.
+	PublicFields []string `json:"public_fields" yaml:"public_fields"`
+	AdminRoles   []string `json:"admin_roles" yaml:"admin_roles"`
+
+	// LiveCounts makes counts aggregate the likes table on every read instead
+	// of reading the like_counts counters, which are maintained either way.
+	LiveCounts bool `json:"live_counts" yaml:"live_counts"`
+
+	// CacheSize bounds the in-process cache of counts and liked states, in
+	// entries. Zero disables the cache. Entries are invalidated on writes
+	// made by this process and expire after CacheTTL otherwise.
+	CacheSize int           `json:"cache_size" yaml:"cache_size"`
+	CacheTTL  time.Duration `json:"cache_ttl" yaml:"cache_ttl"`
+
+	// Trending scores decay each like by (age + TrendingOffset) raised to
+	// TrendingGravity; a higher gravity favors fresher likes. Windows longer
+	// than TrendingMaxWindow are rejected to bound the hourly counts read.
+	TrendingGravity   float64       `json:"trending_gravity" yaml:"trending_gravity"`
+	TrendingOffset    time.Duration `json:"trending_offset" yaml:"trending_offset"`
+	TrendingMaxWindow time.Duration `json:"trending_max_window" yaml:"trending_max_window"`
+
+	// HistogramMaxBuckets bounds the number of buckets a histogram range may
+	// span, since empty buckets are filled in rather than skipped, and
+	// HistogramMaxObjects the number of objects charted at once, each getting
+	// the full series.
+	HistogramMaxBuckets int `json:"histogram_max_buckets" yaml:"histogram_max_buckets"`
+	HistogramMaxObjects int `json:"histogram_max_objects" yaml:"histogram_max_objects"`
+
+	// AnonymousSecret signs anonymous device tokens. Leaving it empty disables
+	// device tokens, and anonymous likes are then deduplicated on IP address
+	// and user agent only. AnonymousCookieSecure marks the device cookie
+	// Secure; it is configured rather than derived from the request because
+	// TLS is usually terminated by a proxy in front of the app.
+	AnonymousSecret       string `json:"anonymous_secret" yaml:"anonymous_secret"`
+	AnonymousCookieName   string `json:"anonymous_cookie_name" yaml:"anonymous_cookie_name"`
+	AnonymousHeaderName   string `json:"anonymous_header_name" yaml:"anonymous_header_name"`
+	AnonymousCookieMaxAge int    `json:"anonymous_cookie_max_age" yaml:"anonymous_cookie_max_age"`
+	AnonymousCookieSecure bool   `json:"anonymous_cookie_secure" yaml:"anonymous_cookie_secure"`
+
+	// TrackingMode selects how the IP address and user agent of likers are
+	// stored: TrackingRaw or TrackingHashed. In hashed mode IP addresses are
+	// hashed with the first of TrackingPeppers; the following ones are retired
+	// peppers still matched when deduplicating anonymous likes, so the pepper
+	// can be rotated by prepending a new one. TrackingTruncateIP hashes the
+	// /24 (IPv4) or /64 (IPv6) network of the address instead of the address.
+	TrackingMode       string   `json:"tracking_mode" yaml:"tracking_mode"`
+	TrackingPeppers    []string `json:"tracking_peppers" yaml:"tracking_peppers"`
+	TrackingTruncateIP bool     `json:"tracking_truncate_ip" yaml:"tracking_truncate_ip"`
+
+	// Retention is the retention policy of likeable types missing from
+	// RetentionByType. A type listed there follows its own policy entirely.
+	Retention       RetentionPolicy            `json:"retention" yaml:"retention"`
+	RetentionByType map[string]RetentionPolicy `json:"retention_by_type" yaml:"retention_by_type"`
+
+	// ErasureMode is how the likes of a user are erased on account deletion
+	// by default: ErasureDelete or ErasureAnonymize.
+	ErasureMode string `json:"erasure_mode" yaml:"erasure_mode"`
+
+	// Webhooks are notified of likes being created and deleted. Deliveries
+	// failing are retried up to WebhookMaxAttempts times, waiting from
+	// WebhookBackoff, doubled after each attempt, up to WebhookMaxBackoff.
+	Webhooks            []WebhookEndpoint `json:"webhooks" yaml:"webhooks"`
+	WebhookMaxAttempts  int               `json:"webhook_max_attempts" yaml:"webhook_max_attempts"`
+	WebhookBackoff      time.Duration     `json:"webhook_backoff" yaml:"webhook_backoff"`
+	WebhookMaxBackoff   time.Duration     `json:"webhook_max_backoff" yaml:"webhook_max_backoff"`
+	WebhookTimeout      time.Duration     `json:"webhook_timeout" yaml:"webhook_timeout"`
+	WebhookPollInterval time.Duration     `json:"webhook_poll_interval" yaml:"webhook_poll_interval"`
+
+	// Outbox stores like events in the like_events table, in the transaction
+	// writing the likes, for an EventDispatcher to publish. The dispatcher
+	// polls every EventPollInterval, holds the outbox for EventLeaseDuration
+	// at a time, and deletes events published more than EventRetention ago.
+	Outbox             bool          `json:"outbox" yaml:"outbox"`
+	EventPollInterval  time.Duration `json:"event_poll_interval" yaml:"event_poll_interval"`
+	EventLeaseDuration time.Duration `json:"event_lease_duration" yaml:"event_lease_duration"`
+	EventRetention     time.Duration `json:"event_retention" yaml:"event_retention"`
+
+	// StreamMaxTargets bounds the number of objects one stream connection
+	// watches. Connections are sent a heartbeat every StreamHeartbeat, so
+	// clients and proxies can tell them from dead ones.
+	StreamMaxTargets int           `json:"stream_max_targets" yaml:"stream_max_targets"`
+	StreamHeartbeat  time.Duration `json:"stream_heartbeat" yaml:"stream_heartbeat"`
+
+	// SocketPushInterval is the minimum delay between two state pushes to a
+	// WebSocket connection; changes in between are pushed together.
+	SocketPushInterval time.Duration `json:"socket_push_interval" yaml:"socket_push_interval"`
+
+	// RateLimits limits the likes and unlikes of each caller, by action:
+	// RateLimitLike or RateLimitUnlike. RateLimitsByType overrides them, action
+	// by action, for some likeable types. Authenticated callers are limited by
+	// user id and anonymous ones as RateLimitAnonymousBy says. RateLimitStore
+	// holds the buckets, in memory when nil.
+	RateLimits           map[string]RateLimit            `json:"rate_limits" yaml:"rate_limits"`
+	RateLimitsByType     map[string]map[string]RateLimit `json:"rate_limits_by_type" yaml:"rate_limits_by_type"`
+	RateLimitAnonymousBy string                          `json:"rate_limit_anonymous_by" yaml:"rate_limit_anonymous_by"`
+	RateLimitStore       RateLimitStore
+
+	// FraudDetection scores each like by the fraud signals it trips, one point
+	// each, comparing it with the likes its object received within
+	// FraudWindow: FraudVelocity of them in all, FraudSubnetLikes from the
+	// network of the liker, FraudUserAgentLikes with their user agent, or an
+	// account younger than FraudMinAccountAge, as told by AccountAges. A zero
+	// threshold turns its signal off. Likes scoring FraudFlagScore are
+	// flagged for review, FraudShadowScore shadow counted and FraudBlockScore
+	// rejected, the most severe action reached applying; zero turns an action
+	// off. FraudVelocity counts every like of the object, so a genuinely
+	// popular one trips it for each of its likers: set it well above organic
+	// peaks, or keep the scores needing another signal on top of it.
+	FraudDetection      bool          `json:"fraud_detection" yaml:"fraud_detection"`
+	FraudWindow         time.Duration `json:"fraud_window" yaml:"fraud_window"`
+	FraudVelocity       int           `json:"fraud_velocity" yaml:"fraud_velocity"`
+	FraudSubnetLikes    int           `json:"fraud_subnet_likes" yaml:"fraud_subnet_likes"`
+	FraudUserAgentLikes int           `json:"fraud_user_agent_likes" yaml:"fraud_user_agent_likes"`
+	FraudMinAccountAge  time.Duration `json:"fraud_min_account_age" yaml:"fraud_min_account_age"`
+	FraudFlagScore      int           `json:"fraud_flag_score" yaml:"fraud_flag_score"`
+	FraudShadowScore    int           `json:"fraud_shadow_score" yaml:"fraud_shadow_score"`
+	FraudBlockScore     int           `json:"fraud_block_score" yaml:"fraud_block_score"`
+	AccountAges         AccountAgeProvider
+
+	// BotFilter keeps anonymous callers whose user agent matches
+	// DefaultBotUserAgents or BotUserAgents, or whose IP address is in
+	// BotDenyCIDRs, from liking, unless they match BotAllowUserAgents or are
+	// in BotAllowCIDRs. Callers without a user agent are filtered too.
+	// BotListFile names a YAML file extending these lists, read when the
+	// plugin is initialized and again when the bot list is reloaded.
+	BotFilter          bool     `json:"bot_filter" yaml:"bot_filter"`
+	BotUserAgents      []string `json:"bot_user_agents" yaml:"bot_user_agents"`
+	BotAllowUserAgents []string `json:"bot_allow_user_agents" yaml:"bot_allow_user_agents"`
+	BotDenyCIDRs       []string `json:"bot_deny_cidrs" yaml:"bot_deny_cidrs"`
+	BotAllowCIDRs      []string `json:"bot_allow_cidrs" yaml:"bot_allow_cidrs"`
+	BotListFile        string   `json:"bot_list_file" yaml:"bot_list_file"`
 }
 
 func DefaultConfig() Config {
@@ -21,6 +176,55 @@ func DefaultConfig() Config {
 		PaginationLimit:    50,
 		MaxPaginationLimit: 200,
 		EnableUserLikes:    false,
+		DefaultReaction:    "like",
+		Reactions:          map[string][]string{},
+		ReactionMode:       ReactionModeSingle,
+		PublicFields:       []string{"likerId", "likedId", "updatedAt", "createdAt"},
+		AdminRoles:         []string{"admin"},
+		CacheTTL:           30 * time.Second,
+		TrendingGravity:    1.8,
+		TrendingOffset:     2 * time.Hour,
+		TrendingMaxWindow:  7 * 24 * time.Hour,
+
+		HistogramMaxBuckets: 1000,
+		HistogramMaxObjects: 50,
+
+		AnonymousCookieName:   "likeable_device",
+		AnonymousHeaderName:   "X-Likeable-Device",
+		AnonymousCookieMaxAge: 365 * 24 * 60 * 60,
+		AnonymousCookieSecure: true,
+
+		TrackingMode:    TrackingRaw,
+		RetentionByType: map[string]RetentionPolicy{},
+		ErasureMode:     ErasureDelete,
+
+		WebhookMaxAttempts:  8,
+		WebhookBackoff:      10 * time.Second,
+		WebhookMaxBackoff:   time.Hour,
+		WebhookTimeout:      10 * time.Second,
+		WebhookPollInterval: time.Second,
+
+		EventPollInterval:  time.Second,
+		EventLeaseDuration: 30 * time.Second,
+		EventRetention:     24 * time.Hour,
+
+		StreamMaxTargets: 100,
+		StreamHeartbeat:  15 * time.Second,
+
+		SocketPushInterval: 500 * time.Millisecond,
+
+		RateLimits:           map[string]RateLimit{},
+		RateLimitsByType:     map[string]map[string]RateLimit{},
+		RateLimitAnonymousBy: RateLimitByIP,
+
+		FraudWindow:         10 * time.Minute,
+		FraudVelocity:       100,
+		FraudSubnetLikes:    20,
+		FraudUserAgentLikes: 50,
+		FraudMinAccountAge:  24 * time.Hour,
+		FraudFlagScore:      2,
+		FraudShadowScore:    3,
+		FraudBlockScore:     4,
 	}
 }
 
@@ -45,9 +249,245 @@ func (c *Config) Validate() error {
 		return errors.New("pagination_limit must be between 1 and max_pagination_limit")
 	}
 
+	if c.DefaultReaction == "" || len(c.DefaultReaction) > maxReactionLength {
+		return fmt.Errorf("default_reaction must be between 1 and %d characters", maxReactionLength)
+	}
+
+	if c.ReactionMode != ReactionModeSingle && c.ReactionMode != ReactionModeMultiple {
+		return fmt.Errorf("reaction_mode must be %q or %q", ReactionModeSingle, ReactionModeMultiple)
+	}
+
+	for likeableType, reactions := range c.Reactions {
+		if err := validateReactions(likeableType, reactions, c.DefaultReaction); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range c.PublicFields {
+		if !restrictableFields[field] {
+			return fmt.Errorf("public_fields cannot contain %q, only restrictable fields", field)
+		}
+	}
+
+	if c.CacheSize < 0 {
+		return errors.New("cache_size cannot be negative")
+	}
+	if c.CacheSize > 0 && c.CacheTTL <= 0 {
+		return errors.New("cache_ttl must be positive when the cache is enabled")
+	}
+
+	if c.TrendingGravity < 0 {
+		return errors.New("trending_gravity cannot be negative")
+	}
+	if c.TrendingOffset <= 0 || c.TrendingMaxWindow <= 0 {
+		return errors.New("trending_offset and trending_max_window must be positive")
+	}
+
+	if c.HistogramMaxBuckets < 1 || c.HistogramMaxObjects < 1 {
+		return errors.New("histogram_max_buckets and histogram_max_objects must be positive")
+	}
+
+	if c.AnonymousSecret != "" {
+		if len(c.AnonymousSecret) < minAnonymousSecretLength {
+			return fmt.Errorf("anonymous_secret must be at least %d characters", minAnonymousSecretLength)
+		}
+		if c.AnonymousCookieName == "" || c.AnonymousHeaderName == "" {
+			return errors.New("anonymous_cookie_name and anonymous_header_name cannot be empty")
+		}
+	}
+
+	if c.TrackingMode != TrackingRaw && c.TrackingMode != TrackingHashed {
+		return fmt.Errorf("tracking_mode must be %q or %q", TrackingRaw, TrackingHashed)
+	}
+	if c.TrackingMode == TrackingHashed && len(c.TrackingPeppers) == 0 {
+		return errors.New("tracking_peppers cannot be empty when tracking_mode is hashed")
+	}
+	for _, pepper := range c.TrackingPeppers {
+		if len(pepper) < minTrackingPepperLength {
+			return fmt.Errorf("tracking_peppers must be at least %d characters", minTrackingPepperLength)
+		}
+	}
+
+	if err := c.Retention.validate(); err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
+	for likeableType, policy := range c.RetentionByType {
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("retention_by_type for %s: %w", likeableType, err)
+		}
+	}
+
+	if c.ErasureMode != ErasureDelete && c.ErasureMode != ErasureAnonymize {
+		return fmt.Errorf("erasure_mode must be %q or %q", ErasureDelete, ErasureAnonymize)
+	}
+
+	urls := make(map[string]bool)
+	for _, endpoint := range c.Webhooks {
+		if err := endpoint.validate(); err != nil {
+			return fmt.Errorf("webhooks: %w", err)
+		}
+		if urls[endpoint.URL] {
+			return fmt.Errorf("duplicate url in webhooks: %s", endpoint.URL)
+		}
+		urls[endpoint.URL] = true
+	}
+	if c.WebhookMaxAttempts < 1 {
+		return errors.New("webhook_max_attempts must be positive")
+	}
+	if c.WebhookBackoff <= 0 || c.WebhookMaxBackoff < c.WebhookBackoff {
+		return errors.New("webhook_backoff must be positive and at most webhook_max_backoff")
+	}
+	if c.WebhookTimeout <= 0 || c.WebhookPollInterval <= 0 {
+		return errors.New("webhook_timeout and webhook_poll_interval must be positive")
+	}
+
+	if c.EventPollInterval <= 0 || c.EventRetention < 0 {
+		return errors.New("event_poll_interval must be positive and event_retention cannot be negative")
+	}
+	if c.EventLeaseDuration <= c.EventPollInterval {
+		return errors.New("event_lease_duration must be longer than event_poll_interval")
+	}
+
+	if c.StreamMaxTargets < 1 || c.StreamHeartbeat <= 0 {
+		return errors.New("stream_max_targets and stream_heartbeat must be positive")
+	}
+	if c.SocketPushInterval < 0 {
+		return errors.New("socket_push_interval cannot be negative")
+	}
+
+	if err := validateRateLimits(c.RateLimits); err != nil {
+		return fmt.Errorf("rate_limits: %w", err)
+	}
+	for likeableType, limits := range c.RateLimitsByType {
+		if err := validateRateLimits(limits); err != nil {
+			return fmt.Errorf("rate_limits_by_type for %s: %w", likeableType, err)
+		}
+	}
+	if c.RateLimitAnonymousBy != RateLimitByIP && c.RateLimitAnonymousBy != RateLimitByDevice {
+		return fmt.Errorf("rate_limit_anonymous_by must be %q or %q", RateLimitByIP, RateLimitByDevice)
+	}
+
+	if c.FraudWindow <= 0 {
+		return errors.New("fraud_window must be positive")
+	}
+	if c.FraudVelocity < 0 || c.FraudSubnetLikes < 0 || c.FraudUserAgentLikes < 0 || c.FraudMinAccountAge < 0 {
+		return errors.New("fraud thresholds cannot be negative")
+	}
+	if c.FraudFlagScore < 0 || c.FraudShadowScore < 0 || c.FraudBlockScore < 0 {
+		return errors.New("fraud scores cannot be negative")
+	}
+
+	if _, err := c.botList().compile(); err != nil {
+		return fmt.Errorf("bot lists: %w", err)
+	}
+
+	return nil
+}
+
+func validateRateLimits(limits map[string]RateLimit) error {
+	for action, limit := range limits {
+		if action != RateLimitLike && action != RateLimitUnlike {
+			return fmt.Errorf("unknown action %q", action)
+		}
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("%s: %w", action, err)
+		}
+	}
+	return nil
+}
+
+func validateReactions(likeableType string, reactions []string, defaultReaction string) error {
+	if len(reactions) == 0 {
+		return fmt.Errorf("reactions for %s cannot be empty", likeableType)
+	}
+
+	seen := make(map[string]bool)
+	for _, reaction := range reactions {
+		if reaction == "" || len(reaction) > maxReactionLength {
+			return fmt.Errorf("reactions for %s must be between 1 and %d characters", likeableType, maxReactionLength)
+		}
+		if seen[reaction] {
+			return fmt.Errorf("duplicate reaction for %s: %s", likeableType, reaction)
+		}
+		seen[reaction] = true
+	}
+
+	// Likes created without an explicit reaction fall back to the default, so
+	// it has to be accepted for every type.
+	if !seen[defaultReaction] {
+		return fmt.Errorf("reactions for %s must include default_reaction %q", likeableType, defaultReaction)
+	}
+
 	return nil
 }
 
+// AnonymousTokensEnabled reports whether anonymous callers are identified by
+// signed device tokens.
+func (c *Config) AnonymousTokensEnabled() bool {
+	return c.AnonymousSecret != ""
+}
+
+// IsPublicField reports whether a like field is shown to every caller.
+func (c *Config) IsPublicField(field string) bool {
+	if !restrictableFields[field] {
+		return true
+	}
+	for _, public := range c.PublicFields {
+		if public == field {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether roles include one of AdminRoles.
+func (c *Config) IsAdmin(roles []string) bool {
+	for _, role := range roles {
+		for _, admin := range c.AdminRoles {
+			if role == admin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RetentionPolicyFor returns the retention policy of a likeable type.
+func (c *Config) RetentionPolicyFor(likeableType string) RetentionPolicy {
+	if policy, ok := c.RetentionByType[likeableType]; ok {
+		return policy
+	}
+	return c.Retention
+}
+
+// RateLimitFor returns the rate limit of an action on a likeable type, and
+// whether there is one.
+func (c *Config) RateLimitFor(action, likeableType string) (RateLimit, bool) {
+	if limit, ok := c.RateLimitsByType[likeableType][action]; ok {
+		return limit, true
+	}
+	limit, ok := c.RateLimits[action]
+	return limit, ok
+}
+
+// FraudActionFor returns the most severe fraud action a score reaches, or
+// an empty string when it reaches none.
+func (c *Config) FraudActionFor(score int) string {
+	for _, action := range []struct {
+		name  string
+		score int
+	}{
+		{FraudActionBlock, c.FraudBlockScore},
+		{FraudActionShadow, c.FraudShadowScore},
+		{FraudActionFlag, c.FraudFlagScore},
+	} {
+		if action.score > 0 && score >= action.score {
+			return action.name
+		}
+	}
+	return ""
+}
+
 func (c *Config) IsAllowedType(likeableType string) bool {
 	for _, allowed := range c.AllowedTypes {
 		if allowed == likeableType {
@@ -56,3 +496,22 @@ func (c *Config) IsAllowedType(likeableType string) bool {
 	}
 	return false
 }
+
+// AllowedReactions returns the reactions accepted for a likeable type. Types
+// without an explicit list only accept the default reaction, which keeps them
+// behaving as a plain binary like.
+func (c *Config) AllowedReactions(likeableType string) []string {
+	if reactions, ok := c.Reactions[likeableType]; ok {
+		return reactions
+	}
+	return []string{c.DefaultReaction}
+}
+
+func (c *Config) IsAllowedReaction(likeableType, reaction string) bool {
+	for _, allowed := range c.AllowedReactions(likeableType) {
+		if allowed == reaction {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package likeable
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr bool
+	}{
+		{"defaults", func(c *Config) {}, false},
+		{"reaction set", func(c *Config) {
+			c.Reactions["post"] = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+		}, false},
+		{"missing default reaction", func(c *Config) {
+			c.Reactions["post"] = []string{"love"}
+		}, true},
+		{"duplicate reaction", func(c *Config) {
+			c.Reactions["post"] = []string{"like", "like"}
+		}, true},
+		{"unknown mode", func(c *Config) { c.ReactionMode = "some" }, true},
+		{"empty default", func(c *Config) { c.DefaultReaction = "" }, true},
+		{"short anonymous secret", func(c *Config) { c.AnonymousSecret = "secret" }, true},
+		{"cache enabled", func(c *Config) { c.CacheSize = 1000 }, false},
+		{"cache without ttl", func(c *Config) {
+			c.CacheSize = 1000
+			c.CacheTTL = 0
+		}, true},
+		{"negative cache size", func(c *Config) { c.CacheSize = -1 }, true},
+		{"public tracking field", func(c *Config) { c.PublicFields = []string{"ipAddress"} }, false},
+		{"unknown public field", func(c *Config) { c.PublicFields = []string{"likeableId"} }, true},
+		{"no histogram buckets", func(c *Config) { c.HistogramMaxBuckets = 0 }, true},
+		{"hashed tracking", func(c *Config) {
+			c.TrackingMode = TrackingHashed
+			c.TrackingPeppers = []string{testAnonymousSecret}
+		}, false},
+		{"hashed tracking without pepper", func(c *Config) { c.TrackingMode = TrackingHashed }, true},
+		{"short tracking pepper", func(c *Config) {
+			c.TrackingMode = TrackingHashed
+			c.TrackingPeppers = []string{testAnonymousSecret, "pepper"}
+		}, true},
+		{"unknown tracking mode", func(c *Config) { c.TrackingMode = "none" }, true},
+		{"retention", func(c *Config) {
+			c.Retention = RetentionPolicy{AnonymizeAfterDays: 30, PurgeAnonymousAfterDays: 365}
+		}, false},
+		{"anonymizing erasure", func(c *Config) { c.ErasureMode = ErasureAnonymize }, false},
+		{"unknown erasure mode", func(c *Config) { c.ErasureMode = "shred" }, true},
+		{"webhook", func(c *Config) {
+			c.Webhooks = []WebhookEndpoint{{URL: "https://example.com/hooks", Secret: testAnonymousSecret, Events: []string{EventLikeCreated}}}
+		}, false},
+		{"webhook without scheme", func(c *Config) {
+			c.Webhooks = []WebhookEndpoint{{URL: "example.com/hooks", Secret: testAnonymousSecret}}
+		}, true},
+		{"short webhook secret", func(c *Config) {
+			c.Webhooks = []WebhookEndpoint{{URL: "https://example.com/hooks", Secret: "secret"}}
+		}, true},
+		{"unknown webhook event", func(c *Config) {
+			c.Webhooks = []WebhookEndpoint{{URL: "https://example.com/hooks", Secret: testAnonymousSecret, Events: []string{"like.updated"}}}
+		}, true},
+		{"webhook backoff above max", func(c *Config) { c.WebhookBackoff = 2 * c.WebhookMaxBackoff }, true},
+		{"outbox", func(c *Config) { c.Outbox = true }, false},
+		{"event lease shorter than poll", func(c *Config) { c.EventLeaseDuration = c.EventPollInterval }, true},
+		{"no stream targets", func(c *Config) { c.StreamMaxTargets = 0 }, true},
+		{"no stream heartbeat", func(c *Config) { c.StreamHeartbeat = 0 }, true},
+		{"unthrottled socket", func(c *Config) { c.SocketPushInterval = 0 }, false},
+		{"negative socket push interval", func(c *Config) { c.SocketPushInterval = -time.Second }, true},
+		{"rate limit", func(c *Config) { c.RateLimits[RateLimitLike] = RateLimit{Rate: 10, Per: time.Minute, Burst: 20} }, false},
+		{"rate limit without period", func(c *Config) { c.RateLimits[RateLimitLike] = RateLimit{Rate: 10} }, true},
+		{"unknown rate limited action", func(c *Config) { c.RateLimits["claim"] = RateLimit{Rate: 10, Per: time.Minute} }, true},
+		{"rate limit by type", func(c *Config) {
+			c.RateLimitsByType["post"] = map[string]RateLimit{RateLimitUnlike: {Rate: 0, Per: time.Minute}}
+		}, true},
+		{"unknown anonymous rate limit key", func(c *Config) { c.RateLimitAnonymousBy = "cookie" }, true},
+		{"fraud signal off", func(c *Config) { c.FraudDetection = true; c.FraudVelocity = 0 }, false},
+		{"no fraud window", func(c *Config) { c.FraudWindow = 0 }, true},
+		{"negative fraud threshold", func(c *Config) { c.FraudSubnetLikes = -1 }, true},
+		{"negative fraud score", func(c *Config) { c.FraudBlockScore = -1 }, true},
+		{"bot lists", func(c *Config) {
+			c.BotFilter = true
+			c.BotUserAgents = []string{`(?i)scraper`}
+			c.BotDenyCIDRs = []string{"192.0.2.0/24"}
+		}, false},
+		{"invalid bot user agent", func(c *Config) { c.BotUserAgents = []string{"bot("} }, true},
+		{"invalid bot network", func(c *Config) { c.BotAllowCIDRs = []string{"192.0.2.1"} }, true},
+		{"bot list file left unread", func(c *Config) { c.BotListFile = "/nonexistent/bots.yaml" }, false},
+		{"negative retention", func(c *Config) {
+			c.RetentionByType["post"] = RetentionPolicy{AnonymizeAfterDays: -1}
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.mutate(&cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllowedReactions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Reactions["post"] = []string{"like", "love"}
+
+	if !cfg.IsAllowedReaction("post", "love") {
+		t.Error("love should be allowed on posts")
+	}
+	if cfg.IsAllowedReaction("comment", "love") {
+		t.Error("comments without a reaction list only accept the default reaction")
+	}
+	if !cfg.IsAllowedReaction("comment", "like") {
+		t.Error("the default reaction is always allowed")
+	}
+}
@@ -6,13 +6,22 @@ import (
 	"github.com/google/uuid"
 )
 
-type LikeConverter struct{}
+// LikeConverter maps likes to their DTOs. Response DTOs only carry the
+// fields the viewer may see, following the configured public fields.
+type LikeConverter struct {
+	config *Config
+}
+
+func NewLikeConverter(config *Config) *LikeConverter {
+	return &LikeConverter{config: config}
+}
 
 func (c *LikeConverter) CreateDTOToModel(dto LikeCreateDTO) Like {
 	return Like{
 		Id:         uuid.New().String(),
 		LikeableId: dto.LikeableId,
 		Likeable:   dto.Likeable,
+		Reaction:   dto.Reaction,
 		LikedId:    dto.LikedId,
 		LikedAt:    time.Now(),
 	}
@@ -22,19 +31,62 @@ func (c *LikeConverter) UpdateDTOToModel(dto LikeUpdateDTO) Like {
 	return Like{}
 }
 
+// ModelToResponseDTO renders a like as read by the processor, withholding
+// its non-public fields unless the viewer of the request was found allowed to
+// see them when it was read.
 func (c *LikeConverter) ModelToResponseDTO(model Like) LikeResponseDTO {
-	return LikeResponseDTO{
+	return c.render(model, model.revealed)
+}
+
+// ModelToResponseDTOFor renders a like for viewer, who sees every field of
+// the likes they made, or of all likes when admin.
+func (c *LikeConverter) ModelToResponseDTOFor(model Like, viewer Viewer) LikeResponseDTO {
+	return c.render(model, viewer.canSee(&model))
+}
+
+func (c *LikeConverter) render(model Like, revealed bool) LikeResponseDTO {
+	dto := LikeResponseDTO{
 		ID:         model.Id,
 		LikerID:    model.LikerId,
 		LikedID:    model.LikedId,
 		LikeableID: model.LikeableId,
 		Likeable:   model.Likeable,
+		Reaction:   model.Reaction,
 		IPAddress:  model.IpAddress,
 		UserAgent:  model.UserAgent,
 		LikedAt:    model.LikedAt,
 		UpdatedAt:  model.UpdatedAt,
 		CreatedAt:  model.CreatedAt,
 	}
+	if !revealed {
+		c.redact(&dto)
+	}
+	return dto
+}
+
+func (c *LikeConverter) redact(dto *LikeResponseDTO) {
+	public := func(field string) bool {
+		return c.config != nil && c.config.IsPublicField(field)
+	}
+
+	if !public("likerId") {
+		dto.LikerID = nil
+	}
+	if !public("likedId") {
+		dto.LikedID = nil
+	}
+	if !public("ipAddress") {
+		dto.IPAddress = nil
+	}
+	if !public("userAgent") {
+		dto.UserAgent = nil
+	}
+	if !public("updatedAt") {
+		dto.UpdatedAt = nil
+	}
+	if !public("createdAt") {
+		dto.CreatedAt = nil
+	}
 }
 
 func (c *LikeConverter) ModelsToResponseDTOs(models []Like) []LikeResponseDTO {
@@ -44,3 +96,11 @@ func (c *LikeConverter) ModelsToResponseDTOs(models []Like) []LikeResponseDTO {
 	}
 	return dtos
 }
+
+func (c *LikeConverter) ModelsToResponseDTOsFor(models []Like, viewer Viewer) []LikeResponseDTO {
+	dtos := make([]LikeResponseDTO, len(models))
+	for i, model := range models {
+		dtos[i] = c.ModelToResponseDTOFor(model, viewer)
+	}
+	return dtos
+}
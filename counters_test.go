@@ -0,0 +1,123 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nicolasbonnici/gorest/database"
+)
+
+func TestCountersFollowWrites(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.ReactionMode = ReactionModeMultiple
+	svc := NewLikeService(db, WithConfig(&cfg))
+	live := DefaultConfig()
+	live.LiveCounts = true
+	liveSvc := NewLikeService(db, WithConfig(&live))
+	ctx := context.Background()
+
+	first := newLike("user-1", "post-1", "like")
+	if err := svc.Create(ctx, first); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := svc.Like(ctx, newLike("user-1", "post-1", "love")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if _, err := svc.Toggle(ctx, newLike("user-2", "post-1", "love")); err != nil {
+		t.Fatalf("Toggle: %v", err)
+	}
+	if _, err := svc.Toggle(ctx, newLike("user-2", "post-1", "love")); err != nil {
+		t.Fatalf("Toggle: %v", err)
+	}
+	if _, err := svc.Like(ctx, newDeviceLike("device-1", "post-1")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if err := svc.Delete(ctx, first.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := svc.Delete(ctx, first.Id); !errors.Is(err, ErrLikeNotFound) {
+		t.Errorf("second Delete = %v, want ErrLikeNotFound", err)
+	}
+
+	counted, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	aggregated, err := liveSvc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("live Count: %v", err)
+	}
+
+	if counted.Total != 2 || counted.Reactions["like"] != 1 || counted.Reactions["love"] != 1 {
+		t.Errorf("counter Count = %+v, want one like and one love", counted)
+	}
+	if counted.Total != aggregated.Total || len(counted.Reactions) != len(aggregated.Reactions) {
+		t.Errorf("counter Count = %+v, live Count = %+v", counted, aggregated)
+	}
+	if _, ok := counted.Reactions["angry"]; ok {
+		t.Error("reactions without likes should not be reported")
+	}
+}
+
+func TestCountersSkipLikesAlreadyDeleted(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	like := newLike("user-1", "post-1", "like")
+	if err := svc.Create(ctx, like); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := svc.Create(ctx, newLike("user-2", "post-1", "like")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// A writer holding a stale copy of the like deletes it after someone
+	// else did.
+	for range 2 {
+		if err := svc.withTx(ctx, func(tx database.Database) error {
+			_, err := svc.deleteLikes(ctx, tx, []Like{*like})
+			return err
+		}); err != nil {
+			t.Fatalf("deleteLikes: %v", err)
+		}
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 {
+		t.Errorf("count = %d, want 1", count.Total)
+	}
+}
+
+func TestLiveCountsBypassCounters(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// Rows written behind the service's back only show up in live counts.
+	if err := NewLikeService(db).crud.Create(ctx, *newLike("user-1", "post-1", "like")); err != nil {
+		t.Fatalf("insert like: %v", err)
+	}
+
+	count, err := NewLikeService(db).Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 0 {
+		t.Errorf("counter Count = %d, want 0", count.Total)
+	}
+
+	cfg := DefaultConfig()
+	cfg.LiveCounts = true
+	count, err = NewLikeService(db, WithConfig(&cfg)).Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 {
+		t.Errorf("live Count = %d, want 1", count.Total)
+	}
+}
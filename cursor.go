@@ -0,0 +1,80 @@
+package likeable
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor was not issued by
+// this service or has been tampered with.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor packs the keyset values of the last item of a page into an
+// opaque token.
+func encodeCursor(values ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(values, "\n")))
+}
+
+// decodeCursor unpacks a token made by encodeCursor, which must hold n values.
+func decodeCursor(cursor string, n int) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	values := strings.Split(string(raw), "\n")
+	if len(values) != n {
+		return nil, ErrInvalidCursor
+	}
+	return values, nil
+}
+
+// keysetPage loads the page of rows following cursor, newest first on a
+// timestamp column with the id breaking ties, so rows added in the meantime
+// never shift the following pages. fetch loads up to limit rows in
+// keysetOrder(column), matching conditions; key returns the timestamp and id
+// of a row. It returns the page and the cursor of the next one, empty on the
+// last page.
+func keysetPage[T any](
+	cursor, column string,
+	limit int,
+	fetch func(conditions []query.Condition, limit int) ([]T, error),
+	key func(row T) (time.Time, string),
+) ([]T, string, error) {
+	var conditions []query.Condition
+	if cursor != "" {
+		values, err := decodeCursor(cursor, 2)
+		if err != nil {
+			return nil, "", err
+		}
+		at, err := time.Parse(time.RFC3339Nano, values[0])
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		conditions = append(conditions, query.Or(
+			query.Lt(column, at),
+			query.And(query.Eq(column, at), query.Lt("id", values[1])),
+		))
+	}
+
+	// One extra row tells whether another page follows.
+	rows, err := fetch(conditions, limit+1)
+	if err != nil || len(rows) <= limit {
+		return rows, "", err
+	}
+	rows = rows[:limit]
+	at, id := key(rows[limit-1])
+	return rows, encodeCursor(at.UTC().Format(time.RFC3339Nano), id), nil
+}
+
+// keysetOrder is the order keysetPage expects its rows in.
+func keysetOrder(column string) []crud.OrderByClause {
+	return []crud.OrderByClause{
+		{Column: column, Direction: query.DESC},
+		{Column: "id", Direction: query.DESC},
+	}
+}
@@ -7,6 +7,7 @@ import (
 type LikeCreateDTO struct {
 	LikeableId string  `json:"likeableId"`
 	Likeable   string  `json:"likeable"`
+	Reaction   string  `json:"reaction,omitempty"`
 	LikedId    *string `json:"likedId,omitempty"`
 }
 
@@ -14,10 +15,11 @@ type LikeUpdateDTO struct {
 }
 
 type LikeCountResponseDTO struct {
-	Likeable   string `json:"likeable"`
-	LikeableId string `json:"likeableId"`
-	Count      int64  `json:"count"`
-	Liked      bool   `json:"liked"`
+	Likeable   string           `json:"likeable"`
+	LikeableId string           `json:"likeableId"`
+	Count      int64            `json:"count"`
+	Reactions  map[string]int64 `json:"reactions"`
+	Liked      bool             `json:"liked"`
 }
 
 type LikeStateRequestDTO struct {
@@ -26,20 +28,90 @@ type LikeStateRequestDTO struct {
 }
 
 type LikeStateDTO struct {
-	Count int64 `json:"count"`
-	Liked bool  `json:"liked"`
+	Count     int64            `json:"count"`
+	Reactions map[string]int64 `json:"reactions"`
+	Liked     bool             `json:"liked"`
 }
 
 type LikeStateResponseDTO struct {
 	States map[string]LikeStateDTO `json:"states"`
 }
 
+// LikeStreamEventDTO is the data of a "state" stream event: the state of
+// the objects of a likeable type that changed.
+type LikeStreamEventDTO struct {
+	Likeable string                  `json:"likeable"`
+	States   map[string]LikeStateDTO `json:"states"`
+}
+
+type LikeHeartbeatDTO struct {
+	Time time.Time `json:"time"`
+}
+
+type LikeClaimResponseDTO struct {
+	Migrated  int64 `json:"migrated"`
+	Collapsed int64 `json:"collapsed"`
+}
+
+type LikeTrendingResponseDTO struct {
+	Likeable string         `json:"likeable"`
+	Window   string         `json:"window"`
+	Items    []TrendingItem `json:"items"`
+}
+
+type LikeMeResponseDTO struct {
+	Items      []LikedItem `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+type LikeFlagsResponseDTO struct {
+	Items      []LikeFlag `json:"items"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// LikeShadowBanCreateDTO names the liker to shadow ban: an account or an
+// anonymous device.
+type LikeShadowBanCreateDTO struct {
+	LikerId     string `json:"likerId,omitempty"`
+	AnonymousId string `json:"anonymousId,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type LikeShadowBansResponseDTO struct {
+	Items      []ShadowBan `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// LikeBotListResponseDTO counts the rules of the bot filter, by list.
+type LikeBotListResponseDTO struct {
+	UserAgents      int `json:"userAgents"`
+	AllowUserAgents int `json:"allowUserAgents"`
+	DenyCIDRs       int `json:"denyCidrs"`
+	AllowCIDRs      int `json:"allowCidrs"`
+}
+
+type LikeTopResponseDTO struct {
+	Likeable   string    `json:"likeable"`
+	Items      []TopItem `json:"items"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+type LikeHistogramResponseDTO struct {
+	Likeable string                       `json:"likeable"`
+	Interval HistogramInterval            `json:"interval"`
+	From     time.Time                    `json:"from"`
+	To       time.Time                    `json:"to"`
+	Timezone string                       `json:"timezone"`
+	Series   map[string][]HistogramBucket `json:"series"`
+}
+
 type LikeResponseDTO struct {
 	ID         string     `json:"id"`
 	LikerID    *string    `json:"likerId,omitempty"`
 	LikedID    *string    `json:"likedId,omitempty"`
 	LikeableID string     `json:"likeableId"`
 	Likeable   string     `json:"likeable"`
+	Reaction   string     `json:"reaction"`
 	IPAddress  *string    `json:"ipAddress,omitempty"`
 	UserAgent  *string    `json:"userAgent,omitempty"`
 	LikedAt    time.Time  `json:"likedAt"`
@@ -1,6 +1,7 @@
 package likeable
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/gofiber/fiber/v3"
@@ -9,13 +10,12 @@ import (
 type LikeErrorHandler struct{}
 
 func (h *LikeErrorHandler) HandleError(c fiber.Ctx, err error, operation string) error {
-	if operation == "create" {
-		errMsg := err.Error()
-		if strings.Contains(errMsg, "UNIQUE constraint") ||
-			strings.Contains(errMsg, "duplicate key") ||
-			strings.Contains(errMsg, "violates unique constraint") {
-			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Already liked"})
-		}
+	if limited, ok := rateLimitResponse(c, err); ok {
+		return c.Status(limited.Code).JSON(fiber.Map{"error": limited.Message})
+	}
+
+	if operation == "create" && (isUniqueViolation(err) || errors.Is(err, ErrAlreadyLiked)) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Already liked"})
 	}
 
 	if fiberErr, ok := err.(*fiber.Error); ok {
@@ -41,3 +41,12 @@ func (h *LikeErrorHandler) HandleError(c fiber.Ctx, err error, operation string)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 }
+
+// isUniqueViolation reports whether err was raised by one of the unique like
+// indexes, across the supported drivers.
+func isUniqueViolation(err error) bool {
+	errMsg := err.Error()
+	return strings.Contains(errMsg, "UNIQUE constraint") ||
+		strings.Contains(errMsg, "duplicate key") ||
+		strings.Contains(errMsg, "violates unique constraint")
+}
@@ -0,0 +1,72 @@
+package likeable
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicolasbonnici/gorest/database"
+)
+
+const (
+	// EventLikeCreated is emitted when a like is stored.
+	EventLikeCreated = "like.created"
+	// EventLikeDeleted is emitted when a like is removed, whether unliked,
+	// replaced by another reaction, purged or erased.
+	EventLikeDeleted = "like.deleted"
+)
+
+// LikeEvent is a domain event about a like, as sent to webhooks and
+// publishers. Id is unique to the event and stays the same when it is sent
+// again, so consumers can deduplicate. Sequence orders the events of the
+// outbox, and is zero elsewhere.
+type LikeEvent struct {
+	Sequence   int64     `json:"sequence,omitempty"`
+	Id         string    `json:"id"`
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Like       EventLike `json:"like"`
+}
+
+// EventLike is the like an event is about. Tracking data is never included.
+type EventLike struct {
+	Id         string    `json:"id"`
+	Likeable   string    `json:"likeable"`
+	LikeableId string    `json:"likeableId"`
+	Reaction   string    `json:"reaction"`
+	LikerId    *string   `json:"likerId,omitempty"`
+	LikedId    *string   `json:"likedId,omitempty"`
+	LikedAt    time.Time `json:"likedAt"`
+}
+
+// emit records an event for each of likes, in the transaction writing them,
+// for the webhooks and the outbox.
+func (s *LikeService) emit(ctx context.Context, db database.Database, event string, likes []Like) error {
+	if len(s.config.Webhooks) == 0 && !s.config.Outbox {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	events := make([]LikeEvent, len(likes))
+	for i, like := range likes {
+		events[i] = LikeEvent{
+			Id:         uuid.New().String(),
+			Event:      event,
+			OccurredAt: now,
+			Like: EventLike{
+				Id:         like.Id,
+				Likeable:   like.Likeable,
+				LikeableId: like.LikeableId,
+				Reaction:   like.Reaction,
+				LikerId:    like.LikerId,
+				LikedId:    like.LikedId,
+				LikedAt:    like.LikedAt.UTC(),
+			},
+		}
+	}
+
+	if err := s.enqueueWebhooks(ctx, db, events); err != nil {
+		return err
+	}
+	return s.appendOutbox(ctx, db, events)
+}
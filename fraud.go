@@ -0,0 +1,317 @@
+package likeable
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/logger"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// Fraud signals. Each one tripped by a like adds a point to its score.
+const (
+	// FraudSignalVelocity trips when the object received FraudVelocity likes
+	// within FraudWindow. It counts every like of the object, so a genuinely
+	// popular one trips it for each of its likers until the likes slow down.
+	FraudSignalVelocity = "velocity"
+	// FraudSignalSubnet trips when FraudSubnetLikes of them came from the /24
+	// (IPv4) or /64 (IPv6) network of the liker.
+	FraudSignalSubnet = "subnet"
+	// FraudSignalUserAgent trips when FraudUserAgentLikes of them came with
+	// the user agent of the liker.
+	FraudSignalUserAgent = "user_agent"
+	// FraudSignalAccountAge trips when the account of the liker is younger
+	// than FraudMinAccountAge.
+	FraudSignalAccountAge = "account_age"
+)
+
+// Fraud actions, by increasing severity.
+const (
+	// FraudActionFlag records the like in like_flags for review.
+	FraudActionFlag = "flag"
+	// FraudActionShadow also leaves it out of counts, see Like.Shadow.
+	FraudActionShadow = "shadow"
+	// FraudActionBlock rejects it, recording the first attempt of each caller
+	// on each object within FraudWindow.
+	FraudActionBlock = "block"
+)
+
+// ShadowFraud is the Shadow of the likes fraud detection shadow counted.
+const ShadowFraud = "fraud"
+
+// AccountAgeProvider tells fraud detection when the account of a user was
+// created. The plugin does not own accounts, so without one the account age
+// signal is off.
+type AccountAgeProvider interface {
+	AccountCreatedAt(ctx context.Context, userID string) (time.Time, error)
+}
+
+// LikeFlag records a like fraud detection scored high enough to act on, for
+// review. LikeId is nil for blocked likes, which were never stored. Signals
+// lists the signals tripped, comma-separated.
+type LikeFlag struct {
+	Id          string    `json:"id" db:"id"`
+	LikeId      *string   `json:"likeId,omitempty" db:"like_id"`
+	Likeable    string    `json:"likeable" db:"likeable"`
+	LikeableId  string    `json:"likeableId" db:"likeable_id"`
+	LikerId     *string   `json:"likerId,omitempty" db:"liker_id"`
+	AnonymousId *string   `json:"anonymousId,omitempty" db:"anonymous_id"`
+	IpAddress   *string   `json:"ipAddress,omitempty" db:"ip_address"`
+	UserAgent   *string   `json:"userAgent,omitempty" db:"user_agent"`
+	Score       int       `json:"score" db:"score"`
+	Signals     string    `json:"signals" db:"signals"`
+	Action      string    `json:"action" db:"action"`
+	FlaggedAt   time.Time `json:"flaggedAt" db:"flagged_at"`
+}
+
+func (LikeFlag) TableName() string {
+	return "like_flags"
+}
+
+var likeFlagsTable = LikeFlag{}.TableName()
+
+func newLikeFlag(like *Like, signals []string, action string) *LikeFlag {
+	return &LikeFlag{
+		Id:          uuid.New().String(),
+		Likeable:    like.Likeable,
+		LikeableId:  like.LikeableId,
+		LikerId:     like.LikerId,
+		AnonymousId: like.AnonymousId,
+		IpAddress:   like.IpAddress,
+		UserAgent:   like.UserAgent,
+		Score:       len(signals),
+		Signals:     strings.Join(signals, ","),
+		Action:      action,
+		FlaggedAt:   time.Now().UTC(),
+	}
+}
+
+// screenLike scores a like about to be made and acts on its score: a like
+// to flag or shadow count gets its flag attached, to be recorded with it,
+// and a like to block is rejected. Scores are a heuristic, so when one
+// cannot be computed, say because the account age provider is down, the
+// error is logged and the like is let through unscored: it is otherwise
+// valid, and nothing points at it being fraudulent.
+func (h *LikeHooks) screenLike(ctx context.Context, like *Like) error {
+	if !h.config.FraudDetection {
+		return nil
+	}
+
+	signals, err := h.service.fraudSignals(ctx, like)
+	if err != nil {
+		logger.Log.Error("likeable: scoring a like", "error", err)
+		return nil
+	}
+	action := h.config.FraudActionFor(len(signals))
+	if action == "" {
+		return nil
+	}
+
+	flag := newLikeFlag(like, signals, action)
+	if action == FraudActionBlock {
+		if err := h.service.recordBlock(ctx, like, flag); err != nil {
+			return err
+		}
+		return fiber.NewError(fiber.StatusForbidden, "Like rejected")
+	}
+
+	if action == FraudActionShadow {
+		reason := ShadowFraud
+		like.Shadow = &reason
+	}
+	flag.LikeId = &like.Id
+	like.flag = flag
+	return nil
+}
+
+// fraudSignals returns the signals like trips. The likes it is compared with
+// are those its object received within FraudWindow, shadow counted or not.
+func (s *LikeService) fraudSignals(ctx context.Context, like *Like) ([]string, error) {
+	config := s.config
+	since := time.Now().Add(-config.FraudWindow).UTC()
+	var signals []string
+
+	if config.FraudVelocity > 0 {
+		n, err := s.countRecent(ctx, like, since)
+		if err != nil {
+			return nil, err
+		}
+		if n >= int64(config.FraudVelocity) {
+			signals = append(signals, FraudSignalVelocity)
+		}
+	}
+
+	if config.FraudSubnetLikes > 0 && like.IpAddress != nil {
+		n, err := s.countSubnet(ctx, like, since)
+		if err != nil {
+			return nil, err
+		}
+		if n >= int64(config.FraudSubnetLikes) {
+			signals = append(signals, FraudSignalSubnet)
+		}
+	}
+
+	// Hashed user agents are reduced to their family, which too many likers
+	// share to tell anything.
+	if config.FraudUserAgentLikes > 0 && like.UserAgent != nil && s.tracking == nil {
+		n, err := s.countRecent(ctx, like, since, query.Eq("user_agent", *like.UserAgent))
+		if err != nil {
+			return nil, err
+		}
+		if n >= int64(config.FraudUserAgentLikes) {
+			signals = append(signals, FraudSignalUserAgent)
+		}
+	}
+
+	if config.FraudMinAccountAge > 0 && config.AccountAges != nil && like.LikerId != nil {
+		created, err := config.AccountAges.AccountCreatedAt(ctx, *like.LikerId)
+		if err != nil {
+			return nil, fmt.Errorf("account age: %w", err)
+		}
+		if time.Since(created) < config.FraudMinAccountAge {
+			signals = append(signals, FraudSignalAccountAge)
+		}
+	}
+
+	return signals, nil
+}
+
+// countRecent counts the likes the object of like received since then,
+// matching conditions.
+func (s *LikeService) countRecent(ctx context.Context, like *Like, since time.Time, conditions ...query.Condition) (int64, error) {
+	sb := query.New(s.db.Dialect()).
+		Select("COUNT(*)").
+		From(likesTable).
+		Where(query.Eq("likeable", like.Likeable)).
+		Where(query.Eq("likeable_id", like.LikeableId)).
+		Where(query.Gte("liked_at", since))
+	for _, condition := range conditions {
+		sb = sb.Where(condition)
+	}
+
+	q, args, err := sb.Build()
+	if err != nil {
+		return 0, fmt.Errorf("build fraud count query: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var n int64
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return 0, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// countSubnet counts the likes the object of like received since then from
+// the network of its liker. Raw IP addresses are stored with their network;
+// hashed ones only tell networks apart when they are truncated before
+// hashing.
+func (s *LikeService) countSubnet(ctx context.Context, like *Like, since time.Time) (int64, error) {
+	if s.tracking != nil {
+		if !s.tracking.truncate {
+			return 0, nil
+		}
+		return s.countRecent(ctx, like, since, query.Eq("ip_address", *like.IpAddress))
+	}
+	return s.countRecent(ctx, like, since, query.Eq("ip_network", truncateIP(*like.IpAddress)))
+}
+
+// recordBlock records the blocked attempt like made, unless its liker was
+// already blocked on the same object within FraudWindow: a like farm retrying
+// would otherwise write a flag with each request it sends.
+func (s *LikeService) recordBlock(ctx context.Context, like *Like, flag *LikeFlag) error {
+	q, args, err := query.New(s.db.Dialect()).
+		Select("id").
+		From(likeFlagsTable).
+		Where(query.Eq("likeable", like.Likeable)).
+		Where(query.Eq("likeable_id", like.LikeableId)).
+		Where(query.Eq("action", FraudActionBlock)).
+		Where(query.Gte("flagged_at", flag.FlaggedAt.Add(-s.config.FraudWindow))).
+		Where(likerCondition(like)).
+		Limit(1).
+		Build()
+	if err != nil {
+		return fmt.Errorf("build blocked flag query: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	blocked := rows.Next()
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if blocked {
+		return nil
+	}
+	return s.recordFlag(ctx, s.db, flag)
+}
+
+func (s *LikeService) recordFlag(ctx context.Context, db database.Database, flag *LikeFlag) error {
+	return crud.New[LikeFlag](db).Create(ctx, *flag)
+}
+
+// FlagsOptions selects the flags listed by Flags.
+type FlagsOptions struct {
+	Likeable string
+	Action   string
+	Limit    int
+	// Cursor resumes the listing after the page that returned it.
+	Cursor string
+}
+
+// FlagsPage is a page of flags. NextCursor is empty on the last page.
+type FlagsPage struct {
+	Items      []LikeFlag
+	NextCursor string
+}
+
+// Flags lists the likes fraud detection flagged, newest first, chained with
+// a keyset cursor on (flagged_at, id) like Liked.
+func (s *LikeService) Flags(ctx context.Context, opts FlagsOptions) (FlagsPage, error) {
+	if opts.Limit < 1 {
+		opts.Limit = s.config.PaginationLimit
+	}
+
+	var filters []query.Condition
+	if opts.Likeable != "" {
+		filters = append(filters, query.Eq("likeable", opts.Likeable))
+	}
+	if opts.Action != "" {
+		filters = append(filters, query.Eq("action", opts.Action))
+	}
+
+	items, next, err := keysetPage(opts.Cursor, "flagged_at", opts.Limit,
+		func(conditions []query.Condition, limit int) ([]LikeFlag, error) {
+			result, err := crud.New[LikeFlag](s.db).GetAllPaginated(ctx, crud.PaginationOptions{
+				Limit:      limit,
+				Conditions: append(conditions, filters...),
+				OrderBy:    keysetOrder("flagged_at"),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return result.Items, nil
+		},
+		func(flag LikeFlag) (time.Time, string) { return flag.FlaggedAt, flag.Id },
+	)
+	if err != nil {
+		return FlagsPage{}, err
+	}
+	return FlagsPage{Items: items, NextCursor: next}, nil
+}
@@ -0,0 +1,120 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type accountAges map[string]time.Time
+
+func (a accountAges) AccountCreatedAt(ctx context.Context, userID string) (time.Time, error) {
+	return a[userID], nil
+}
+
+func TestFraudActionFor(t *testing.T) {
+	cfg := DefaultConfig()
+	for score, want := range []string{"", "", FraudActionFlag, FraudActionShadow, FraudActionBlock, FraudActionBlock} {
+		if got := cfg.FraudActionFor(score); got != want {
+			t.Errorf("FraudActionFor(%d) = %q, want %q", score, got, want)
+		}
+	}
+
+	cfg.FraudShadowScore = 0
+	if got := cfg.FraudActionFor(3); got != FraudActionFlag {
+		t.Errorf("FraudActionFor(3) = %q with shadowing off, want a flag", got)
+	}
+}
+
+func TestScreenLike(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FraudDetection = true
+	cfg.FraudVelocity = 3
+	cfg.FraudSubnetLikes = 2
+	cfg.FraudUserAgentLikes = 0
+	cfg.FraudFlagScore, cfg.FraudShadowScore, cfg.FraudBlockScore = 1, 2, 3
+	cfg.AccountAges = accountAges{"user-new": time.Now().Add(-time.Hour), "user-old": time.Now().Add(-time.Hour * 24 * 30)}
+	hooks := NewLikeHooks(newTestDB(t), &cfg)
+	ctx := context.Background()
+
+	like := func(likerID, ip string) *Like {
+		l := newLike(likerID, "post-1", "like")
+		l.IpAddress = ptr(ip)
+		return l
+	}
+	for i, ip := range []string{"203.0.113.1", "203.0.113.2", "198.51.100.1"} {
+		l := like(fmt.Sprintf("user-%d", i), ip)
+		if err := hooks.screenLike(ctx, l); err != nil || l.flag != nil {
+			t.Fatalf("like %d = %v with flag %+v, want it let through", i, err, l.flag)
+		}
+		if err := hooks.service.Create(ctx, l); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	// Velocity and subnet concentration: shadow counted.
+	shadowed := like("user-old", "203.0.113.3")
+	if err := hooks.screenLike(ctx, shadowed); err != nil {
+		t.Fatalf("screenLike: %v", err)
+	}
+	if shadowed.Shadow == nil || *shadowed.Shadow != ShadowFraud || shadowed.flag == nil || shadowed.flag.Signals != "velocity,subnet" {
+		t.Fatalf("shadowed like = %+v with flag %+v", shadowed, shadowed.flag)
+	}
+	if err := hooks.service.Create(ctx, shadowed); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	count, err := hooks.service.Count(ctx, "post", "post-1")
+	if err != nil || count.Total != 3 {
+		t.Errorf("Count = %+v, %v, want the shadow like left out", count, err)
+	}
+	liked, err := hooks.service.LikedByBatch(ctx, "user-old", "post", []string{"post-1"})
+	if err != nil || !liked["post-1"] {
+		t.Errorf("LikedByBatch = %v, %v, want the shadow like shown to its liker", liked, err)
+	}
+
+	// A young account on top of it: blocked.
+	blocked := like("user-new", "203.0.113.4")
+	var fiberErr *fiber.Error
+	if err := hooks.screenLike(ctx, blocked); !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusForbidden {
+		t.Fatalf("screenLike = %v, want the like rejected", err)
+	}
+	// Retrying is rejected again without recording another flag.
+	if err := hooks.screenLike(ctx, like("user-new", "203.0.113.4")); !errors.As(err, &fiberErr) || fiberErr.Code != fiber.StatusForbidden {
+		t.Fatalf("screenLike = %v, want the retry rejected", err)
+	}
+	blocks, err := hooks.service.Flags(ctx, FlagsOptions{Action: FraudActionBlock})
+	if err != nil || len(blocks.Items) != 1 {
+		t.Errorf("blocked flags = %+v, %v, want the attempts recorded once", blocks.Items, err)
+	}
+
+	page, err := hooks.service.Flags(ctx, FlagsOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("Flags: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Action != FraudActionBlock || page.Items[0].LikeId != nil || page.Items[0].Score != 3 {
+		t.Errorf("latest flag = %+v, want the blocked like", page.Items)
+	}
+	page, err = hooks.service.Flags(ctx, FlagsOptions{Limit: 1, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("Flags: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Action != FraudActionShadow || *page.Items[0].LikeId != shadowed.Id || page.NextCursor != "" {
+		t.Errorf("next flag = %+v, want the shadowed like", page.Items)
+	}
+
+	report, err := hooks.service.Reconcile(ctx, ReconcileOptions{})
+	if err != nil || len(report.Discrepancies) != 0 {
+		t.Errorf("Reconcile = %+v, %v, want the shadow like left out of counters", report, err)
+	}
+	if err := hooks.service.Delete(ctx, shadowed.Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if count, err := hooks.service.Count(ctx, "post", "post-1"); err != nil || count.Total != 3 {
+		t.Errorf("Count = %+v, %v, want deleting a shadow like to leave it alone", count, err)
+	}
+}
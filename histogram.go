@@ -0,0 +1,211 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// HistogramInterval is the width of the buckets of a like histogram.
+type HistogramInterval string
+
+const (
+	HistogramHour HistogramInterval = "hour"
+	HistogramDay  HistogramInterval = "day"
+	// HistogramWeek buckets start on Mondays, as ISO weeks do.
+	HistogramWeek HistogramInterval = "week"
+)
+
+// ErrHistogramTooLarge is returned when a histogram range spans more buckets
+// than Config.HistogramMaxBuckets allows.
+var ErrHistogramTooLarge = errors.New("histogram range spans too many buckets")
+
+// defaultHistogramBuckets is the number of buckets shown when no range is
+// given.
+const defaultHistogramBuckets = 30
+
+// bucketLayout is the wall clock format bucket starts are read back in from
+// every dialect.
+const bucketLayout = "2006-01-02 15:04:05"
+
+// HistogramOptions selects the likes counted by Histogram.
+type HistogramOptions struct {
+	Likeable    string
+	LikeableIds []string
+	Interval    HistogramInterval
+	// From is inclusive and To exclusive.
+	From time.Time
+	To   time.Time
+	// Location aligns buckets on its local midnight; UTC when nil.
+	Location *time.Location
+}
+
+// HistogramBucket counts the likes received from Start until the next bucket.
+type HistogramBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// ParseHistogramInterval validates an interval name.
+func ParseHistogramInterval(s string) (HistogramInterval, error) {
+	switch interval := HistogramInterval(s); interval {
+	case HistogramHour, HistogramDay, HistogramWeek:
+		return interval, nil
+	}
+	return "", fmt.Errorf("interval must be %q, %q or %q", HistogramHour, HistogramDay, HistogramWeek)
+}
+
+// truncate returns the start of the bucket t falls in, in t's location.
+func (i HistogramInterval) truncate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch i {
+	case HistogramHour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case HistogramWeek:
+		day -= (int(t.Weekday()) + 6) % 7
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// add moves t by n intervals, backwards when n is negative.
+func (i HistogramInterval) add(t time.Time, n int) time.Time {
+	switch i {
+	case HistogramHour:
+		return t.Add(time.Duration(n) * time.Hour)
+	case HistogramWeek:
+		return t.AddDate(0, 0, 7*n)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// Histogram counts the likes each object received per interval between From
+// and To. Every object gets the full series of buckets, empty ones included,
+// so callers can chart them as is.
+//
+// Likes are bucketed by the database. Postgres applies the location's rules
+// to every like, while MySQL and SQLite lack a portable time zone database
+// and use the location's UTC offset at From for the whole range, which may
+// shift buckets by the DST difference when a transition falls within it.
+func (s *LikeService) Histogram(ctx context.Context, opts HistogramOptions) (map[string][]HistogramBucket, error) {
+	if _, err := ParseHistogramInterval(string(opts.Interval)); err != nil {
+		return nil, err
+	}
+	if !opts.To.After(opts.From) {
+		return nil, errors.New("histogram range must end after it starts")
+	}
+
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	bucket, bucketArgs, zone := s.bucketExpr(opts.Interval, loc, opts.From)
+
+	var starts []time.Time
+	for t := opts.Interval.truncate(opts.From.In(zone)); t.Before(opts.To); t = opts.Interval.add(t, 1) {
+		if len(starts) == s.config.HistogramMaxBuckets {
+			return nil, ErrHistogramTooLarge
+		}
+		starts = append(starts, t)
+	}
+
+	series := make(map[string][]HistogramBucket, len(opts.LikeableIds))
+	index := make(map[int64]int, len(starts))
+	for i, start := range starts {
+		index[start.Unix()] = i
+	}
+	for _, id := range opts.LikeableIds {
+		buckets := make([]HistogramBucket, len(starts))
+		for i, start := range starts {
+			buckets[i].Start = start
+		}
+		series[id] = buckets
+	}
+	if len(opts.LikeableIds) == 0 {
+		return series, nil
+	}
+
+	q, args, err := query.New(s.db.Dialect()).
+		Select("likeable_id").
+		SelectExpr(
+			query.As(query.RawExpr(bucket, bucketArgs...), "bucket"),
+			query.As(query.Count(query.Col("*")), "n"),
+		).
+		From(likesTable).
+		Where(query.Eq("likeable", opts.Likeable)).
+		Where(query.In("likeable_id", toAnySlice(opts.LikeableIds)...)).
+		Where(query.Gte("liked_at", opts.From.UTC())).
+		Where(query.Lt("liked_at", opts.To.UTC())).
+		Where(countedCondition()).
+		GroupBy("likeable_id", "bucket").
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("build histogram query: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, wallClock string
+		var n int64
+		if err := rows.Scan(&id, &wallClock, &n); err != nil {
+			return nil, err
+		}
+
+		start, err := time.ParseInLocation(bucketLayout, wallClock, zone)
+		if err != nil {
+			return nil, fmt.Errorf("parse histogram bucket %q: %w", wallClock, err)
+		}
+		if i, ok := index[start.Unix()]; ok {
+			series[id][i].Count += n
+		}
+	}
+	return series, rows.Err()
+}
+
+// bucketExpr returns the SQL expression truncating liked_at to the start of
+// its bucket, formatted as bucketLayout in local time, along with its
+// arguments and the location bucket starts are expressed in.
+func (s *LikeService) bucketExpr(interval HistogramInterval, loc *time.Location, at time.Time) (string, []any, *time.Location) {
+	_, offset := at.In(loc).Zone()
+	zone := time.FixedZone(loc.String(), offset)
+	sign, minutes := "+", offset/60
+	if minutes < 0 {
+		sign, minutes = "-", -minutes
+	}
+
+	switch s.db.DriverName() {
+	case "postgres":
+		expr := fmt.Sprintf("to_char(date_trunc('%s', liked_at AT TIME ZONE CAST(? AS TEXT)), 'YYYY-MM-DD HH24:MI:SS')", interval)
+		return expr, []any{loc.String()}, loc
+	case "mysql":
+		tz := fmt.Sprintf("%s%02d:%02d", sign, minutes/60, minutes%60)
+		local := "CONVERT_TZ(liked_at, @@session.time_zone, ?)"
+		switch interval {
+		case HistogramHour:
+			return "DATE_FORMAT(" + local + ", '%Y-%m-%d %H:00:00')", []any{tz}, zone
+		case HistogramWeek:
+			expr := "DATE_FORMAT(DATE_SUB(" + local + ", INTERVAL WEEKDAY(" + local + ") DAY), '%Y-%m-%d 00:00:00')"
+			return expr, []any{tz, tz}, zone
+		}
+		return "DATE_FORMAT(" + local + ", '%Y-%m-%d 00:00:00')", []any{tz}, zone
+	default:
+		// SQLite stores liked_at as Go formats it, "2006-01-02 15:04:05 +0000 UTC",
+		// which its date functions only parse once cut to the UTC wall clock.
+		shift := fmt.Sprintf("%s%d minutes", sign, minutes)
+		switch interval {
+		case HistogramHour:
+			return "strftime('%Y-%m-%d %H:00:00', substr(liked_at, 1, 19), ?)", []any{shift}, zone
+		case HistogramWeek:
+			// Move forward to Sunday, then back to the Monday opening the week.
+			return "strftime('%Y-%m-%d 00:00:00', substr(liked_at, 1, 19), ?, 'weekday 0', '-6 days')", []any{shift}, zone
+		}
+		return "strftime('%Y-%m-%d 00:00:00', substr(liked_at, 1, 19), ?)", []any{shift}, zone
+	}
+}
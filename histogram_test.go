@@ -0,0 +1,144 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+	day := func(d, h int) time.Time { return time.Date(2026, 3, d, h, 0, 0, 0, time.UTC) }
+
+	insertLikeAt(t, svc, "user-1", "post-1", day(2, 9))
+	insertLikeAt(t, svc, "user-2", "post-1", day(2, 23))
+	insertLikeAt(t, svc, "user-3", "post-1", day(4, 10))
+	insertLikeAt(t, svc, "user-1", "post-2", day(3, 12))
+	// Outside the range.
+	insertLikeAt(t, svc, "user-4", "post-1", day(6, 0))
+
+	series, err := svc.Histogram(ctx, HistogramOptions{
+		Likeable:    "post",
+		LikeableIds: []string{"post-1", "post-2", "post-3"},
+		Interval:    HistogramDay,
+		From:        day(2, 0),
+		To:          day(6, 0),
+	})
+	if err != nil {
+		t.Fatalf("Histogram: %v", err)
+	}
+
+	want := map[string][]int64{
+		"post-1": {2, 0, 1, 0},
+		"post-2": {0, 1, 0, 0},
+		"post-3": {0, 0, 0, 0},
+	}
+	for id, counts := range want {
+		buckets := series[id]
+		if len(buckets) != len(counts) {
+			t.Fatalf("%s has %d buckets, want %d", id, len(buckets), len(counts))
+		}
+		for i, count := range counts {
+			if buckets[i].Count != count || !buckets[i].Start.Equal(day(2+i, 0)) {
+				t.Errorf("%s bucket %d = %+v, want %d likes on March %d", id, i, buckets[i], count, 2+i)
+			}
+		}
+	}
+
+	// In Tokyo the late like of March 2 already falls on March 3.
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	series, err = svc.Histogram(ctx, HistogramOptions{
+		Likeable:    "post",
+		LikeableIds: []string{"post-1"},
+		Interval:    HistogramDay,
+		From:        time.Date(2026, 3, 2, 0, 0, 0, 0, tokyo),
+		To:          time.Date(2026, 3, 5, 0, 0, 0, 0, tokyo),
+		Location:    tokyo,
+	})
+	if err != nil {
+		t.Fatalf("Histogram: %v", err)
+	}
+	if got := bucketCounts(series["post-1"]); !equalCounts(got, []int64{1, 1, 1}) {
+		t.Errorf("Tokyo buckets = %v, want [1 1 1]", got)
+	}
+}
+
+func TestHistogramIntervals(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.HistogramMaxBuckets = 48
+	svc := NewLikeService(db, WithConfig(&cfg))
+	ctx := context.Background()
+
+	// March 1, 2026 is a Sunday.
+	insertLikeAt(t, svc, "user-1", "post-1", time.Date(2026, 3, 1, 10, 15, 0, 0, time.UTC))
+	insertLikeAt(t, svc, "user-2", "post-1", time.Date(2026, 3, 2, 10, 45, 0, 0, time.UTC))
+	insertLikeAt(t, svc, "user-3", "post-1", time.Date(2026, 3, 8, 23, 0, 0, 0, time.UTC))
+	insertLikeAt(t, svc, "user-4", "post-1", time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC))
+
+	opts := HistogramOptions{
+		Likeable:    "post",
+		LikeableIds: []string{"post-1"},
+		Interval:    HistogramWeek,
+		From:        time.Date(2026, 2, 25, 0, 0, 0, 0, time.UTC),
+		To:          time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC),
+	}
+	series, err := svc.Histogram(ctx, opts)
+	if err != nil {
+		t.Fatalf("Histogram: %v", err)
+	}
+	buckets := series["post-1"]
+	if got := bucketCounts(buckets); !equalCounts(got, []int64{1, 2, 1}) {
+		t.Errorf("week buckets = %v, want [1 2 1]", got)
+	}
+	if len(buckets) > 0 && buckets[0].Start.Weekday() != time.Monday {
+		t.Errorf("weeks start on %s, want Monday", buckets[0].Start.Weekday())
+	}
+
+	opts.Interval = HistogramHour
+	opts.From = time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	opts.To = time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	series, err = svc.Histogram(ctx, opts)
+	if err != nil {
+		t.Fatalf("Histogram: %v", err)
+	}
+	if got := bucketCounts(series["post-1"]); !equalCounts(got, []int64{0, 1, 0}) {
+		t.Errorf("hour buckets = %v, want [0 1 0]", got)
+	}
+
+	opts.To = opts.From.Add(72 * time.Hour)
+	if _, err := svc.Histogram(ctx, opts); !errors.Is(err, ErrHistogramTooLarge) {
+		t.Errorf("Histogram over 48 buckets = %v, want ErrHistogramTooLarge", err)
+	}
+
+	opts.Interval = "month"
+	if _, err := svc.Histogram(ctx, opts); err == nil {
+		t.Error("Histogram should reject unknown intervals")
+	}
+}
+
+func bucketCounts(buckets []HistogramBucket) []int64 {
+	counts := make([]int64, len(buckets))
+	for i, bucket := range buckets {
+		counts[i] = bucket.Count
+	}
+	return counts
+}
+
+func equalCounts(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package likeable
 
 import (
 	"context"
+	"strings"
 
 	"github.com/gofiber/fiber/v3"
 	auth "github.com/nicolasbonnici/gorest/auth"
@@ -11,20 +12,97 @@ import (
 )
 
 type LikeHooks struct {
-	db      database.Database
-	config  *Config
-	service *LikeService
+	db         database.Database
+	config     *Config
+	service    *LikeService
+	callbacks  *likeCallbacks
+	hub        *streamHub
+	rateLimits RateLimitStore
+	bots       *botFilter
 }
 
 func NewLikeHooks(db database.Database, config *Config) *LikeHooks {
+	opts := []LikeServiceOption{WithConfig(config)}
+	if config.CacheSize > 0 {
+		opts = append(opts, WithCache(NewLRUCache(config.CacheSize, config.CacheTTL)))
+	}
+
+	rateLimits := config.RateLimitStore
+	if rateLimits == nil {
+		rateLimits = NewMemoryRateLimitStore()
+	}
+
+	service := NewLikeService(db, opts...)
 	return &LikeHooks{
-		db:      db,
-		config:  config,
-		service: NewLikeService(db),
+		db:         db,
+		config:     config,
+		service:    service,
+		callbacks:  &likeCallbacks{},
+		hub:        service.hub,
+		rateLimits: rateLimits,
+		bots:       newBotFilter(config),
 	}
 }
 
+// caller is who a request acts for. It is resolved, and its strings copied
+// out of the request buffers, while the request is available, so WebSocket
+// connections can act for it once upgraded.
+type caller struct {
+	liker     Liker
+	user      *auth.AuthenticatedUser
+	ipAddress string
+	userAgent string
+}
+
+func callerOf(c fiber.Ctx) caller {
+	liker := CallerLiker(c)
+	who := caller{
+		liker:     Liker{UserID: strings.Clone(liker.UserID), AnonymousID: strings.Clone(liker.AnonymousID)},
+		ipAddress: strings.Clone(c.IP()),
+		userAgent: strings.Clone(c.Get("User-Agent")),
+	}
+	if user := auth.GetAuthenticatedUser(c); user != nil {
+		who.user = &auth.AuthenticatedUser{UserID: who.liker.UserID}
+	}
+	return who
+}
+
 func (h *LikeHooks) CreateHook(c fiber.Ctx, dto LikeCreateDTO, model *Like) error {
+	if err := h.prepareLike(c, dto, model); err != nil {
+		return err
+	}
+
+	return h.beforeLike(auth.Context(c), callerOf(c), model)
+}
+
+// ToggleHook validates a like targeted by the toggle, set and remove
+// endpoints. Those can undo likes, so unlike CreateHook they require a caller
+// whose likes can be told apart: an authenticated user or a device sending
+// back a signed anonymous token, mirroring the ownership rule of DeleteHook.
+// A token issued along with the response does not count for the request.
+func (h *LikeHooks) ToggleHook(c fiber.Ctx, dto LikeCreateDTO, model *Like) error {
+	return h.toggleHook(callerOf(c), dto, model)
+}
+
+func (h *LikeHooks) toggleHook(who caller, dto LikeCreateDTO, model *Like) error {
+	if who.liker.IsZero() {
+		return fiber.NewError(401, "Authentication required")
+	}
+	return h.prepare(who, dto, model)
+}
+
+func (h *LikeHooks) prepareLike(c fiber.Ctx, dto LikeCreateDTO, model *Like) error {
+	return h.prepare(callerOf(c), dto, model)
+}
+
+// prepare checks that the caller, the target and the reaction of a like are
+// allowed and stamps it with the identity of the caller. Anonymous callers
+// caught by the bot filter are turned away.
+func (h *LikeHooks) prepare(who caller, dto LikeCreateDTO, model *Like) error {
+	if who.liker.UserID == "" && h.bots.blocks(who.ipAddress, who.userAgent) {
+		return fiber.NewError(403, "Automated clients cannot like")
+	}
+
 	if dto.Likeable == "user" {
 		if !h.config.EnableUserLikes {
 			return fiber.NewError(400, "user likes are not enabled")
@@ -38,19 +116,24 @@ func (h *LikeHooks) CreateHook(c fiber.Ctx, dto LikeCreateDTO, model *Like) erro
 		}
 	}
 
-	user := auth.GetAuthenticatedUser(c)
-	if user != nil {
-		model.LikerId = &user.UserID
+	if model.Reaction == "" {
+		model.Reaction = h.config.DefaultReaction
+	}
+	if !h.config.IsAllowedReaction(dto.Likeable, model.Reaction) {
+		return fiber.NewError(400, "reaction is not allowed for this likeable type")
 	}
 
-	ipAddress := c.IP()
-	userAgent := c.Get("User-Agent")
-	if ipAddress != "" {
+	who.liker.apply(model)
+
+	if who.ipAddress != "" {
+		ipAddress := who.ipAddress
 		model.IpAddress = &ipAddress
 	}
-	if userAgent != "" {
+	if who.userAgent != "" {
+		userAgent := who.userAgent
 		model.UserAgent = &userAgent
 	}
+	h.service.tracking.apply(model)
 
 	return nil
 }
@@ -60,22 +143,152 @@ func (h *LikeHooks) UpdateHook(c fiber.Ctx, dto LikeUpdateDTO, model *Like) erro
 }
 
 func (h *LikeHooks) DeleteHook(c fiber.Ctx, id any) error {
-	ctx := auth.Context(c)
+	_, err := h.deletable(c, id)
+	return err
+}
+
+// deletable loads the like DeleteHook authorizes deleting. Its likeable type
+// is only known once it is loaded, so the lookup is first charged to the
+// caller's unlikes of any type; a type with an unlike limit of its own is
+// charged too once known.
+func (h *LikeHooks) deletable(c fiber.Ctx, id any) (*Like, error) {
+	ctx, who := auth.Context(c), callerOf(c)
+	if err := h.rateLimit(ctx, who, RateLimitUnlike, ""); err != nil {
+		return nil, err
+	}
 
 	existing, err := h.getLike(ctx, id)
 	if err != nil {
-		return fiber.NewError(404, "Not found")
+		return nil, fiber.NewError(404, "Not found")
+	}
+
+	if !who.liker.Owns(existing) {
+		return nil, fiber.NewError(403, "You can only delete your own likes")
 	}
 
-	user := auth.GetAuthenticatedUser(c)
-	if user == nil || existing.LikerId == nil || *existing.LikerId != user.UserID {
+	if _, typed := h.config.RateLimitsByType[existing.Likeable][RateLimitUnlike]; typed {
+		if err := h.rateLimit(ctx, who, RateLimitUnlike, existing.Likeable); err != nil {
+			return nil, err
+		}
+	}
+	return existing, h.vetUnlike(ctx, who, existing)
+}
+
+// UnlikeHook authorizes removing the caller's likes by target. Like
+// DeleteHook, only identified likers can remove likes, and the removal is
+// scoped to their own likes by construction.
+func (h *LikeHooks) UnlikeHook(c fiber.Ctx, likeableType, likeableID string) error {
+	if likeableType == "" || likeableID == "" {
+		return fiber.NewError(400, "likeable and likeableId are required")
+	}
+	if CallerLiker(c).IsZero() {
 		return fiber.NewError(403, "You can only delete your own likes")
 	}
+	return h.beforeUnlike(auth.Context(c), callerOf(c), unlikeTarget(CallerLiker(c), likeableType, likeableID))
+}
+
+// unlikeTarget describes the likes of liker on an object, as given to the
+// unlike callbacks.
+func unlikeTarget(liker Liker, likeableType, likeableID string) *Like {
+	like := &Like{Likeable: likeableType, LikeableId: likeableID}
+	liker.apply(like)
+	return like
+}
+
+// beforeToggle runs the callbacks of what toggling model is about to do, and
+// reports whether that is a like. Telling takes a lookup, which must not
+// escape the rate limit, so toggles are charged as likes whichever way they
+// go.
+func (h *LikeHooks) beforeToggle(ctx context.Context, who caller, model *Like) (bool, error) {
+	if err := h.rateLimit(ctx, who, RateLimitLike, model.Likeable); err != nil {
+		return false, err
+	}
+
+	held, err := h.service.heldReactions(ctx, h.db, model)
+	if err != nil {
+		return false, err
+	}
+	for _, like := range held {
+		if like.Reaction == model.Reaction {
+			return false, h.vetUnlike(ctx, who, model)
+		}
+	}
+	return true, h.vetLike(ctx, who, model)
+}
+
+// ClaimHook authorizes claiming anonymous likes and returns the key
+// identifying them: the device of the caller. Only a signed device token
+// proves the likes were made by the caller; an IP address and user agent are
+// shared by everyone behind the same network and browser, so claims without a
+// token are refused.
+func (h *LikeHooks) ClaimHook(c fiber.Ctx) (AnonymousKey, error) {
+	if auth.GetAuthenticatedUser(c) == nil {
+		return AnonymousKey{}, fiber.NewError(401, "Authentication required")
+	}
+	anonymousID := AnonymousID(c)
+	if anonymousID == "" {
+		return AnonymousKey{}, fiber.NewError(403, "A device token is required to claim likes")
+	}
+	return AnonymousKey{AnonymousID: anonymousID}, nil
+}
+
+// UserDataHook restricts exporting and erasing the data of a user to admins.
+func (h *LikeHooks) UserDataHook(c fiber.Ctx) error {
+	return h.requireAdmin(c)
+}
+
+// FlagsHook restricts reviewing the likes flagged by fraud detection to
+// admins.
+func (h *LikeHooks) FlagsHook(c fiber.Ctx) error {
+	return h.requireAdmin(c)
+}
+
+// ShadowBansHook restricts managing shadow bans to admins.
+func (h *LikeHooks) ShadowBansHook(c fiber.Ctx) error {
+	return h.requireAdmin(c)
+}
+
+// BotsHook restricts reloading the bot list to admins.
+func (h *LikeHooks) BotsHook(c fiber.Ctx) error {
+	return h.requireAdmin(c)
+}
+
+func (h *LikeHooks) requireAdmin(c fiber.Ctx) error {
+	if auth.GetAuthenticatedUser(c) == nil {
+		return fiber.NewError(401, "Authentication required")
+	}
+	if !CallerViewer(c, h.config).Admin {
+		return fiber.NewError(403, "Admin role required")
+	}
+	return nil
+}
 
+// GetByIDHook makes the caller known to the CRUD hooks, which hide shadow
+// likes other than their own and have the converter withhold the non-public
+// fields of likes they did not make.
+func (h *LikeHooks) GetByIDHook(c fiber.Ctx, id any) error {
+	withViewer(c, CallerViewer(c, h.config))
 	return nil
 }
 
+// GetAllHook keeps non-admin callers from filtering or ordering on non-public
+// fields, which would let them probe values they cannot read, and from
+// listing shadow likes other than their own. Like GetByIDHook, it makes the
+// caller known to the converter.
 func (h *LikeHooks) GetAllHook(c fiber.Ctx, conditions *[]query.Condition, orderBy *[]crud.OrderByClause) error {
+	viewer := CallerViewer(c, h.config)
+	withViewer(c, viewer)
+	if viewer.Admin {
+		return nil
+	}
+
+	for key := range c.Queries() {
+		if field := queryField(key); !h.config.IsPublicField(field) {
+			return fiber.NewError(403, "Filtering or ordering on "+field+" is restricted")
+		}
+	}
+
+	*conditions = append(*conditions, viewer.visible())
 	return nil
 }
 
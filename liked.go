@@ -0,0 +1,103 @@
+package likeable
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// LikedOptions selects the page of a liker's likes returned by Liked.
+type LikedOptions struct {
+	// Likeable restricts the likes to one likeable type when not empty.
+	Likeable string
+	Limit    int
+	// Cursor resumes the listing after the page that returned it.
+	Cursor string
+}
+
+// LikedItem references an object a liker liked, without any of the tracking
+// data stored alongside the like.
+type LikedItem struct {
+	Likeable   string    `json:"likeable"`
+	LikeableId string    `json:"likeableId"`
+	Reaction   string    `json:"reaction"`
+	LikedAt    time.Time `json:"likedAt"`
+}
+
+// LikedPage is a page of Liked. NextCursor is empty on the last page.
+type LikedPage struct {
+	Items      []LikedItem
+	NextCursor string
+}
+
+// likedRow is a LikedItem with the id keying its page.
+type likedRow struct {
+	id   string
+	item LikedItem
+}
+
+// Liked lists what liker liked, newest first. Pages are chained with a keyset
+// cursor on (liked_at, id), so likes added in the meantime never shift the
+// following pages.
+func (s *LikeService) Liked(ctx context.Context, liker Liker, opts LikedOptions) (LikedPage, error) {
+	if opts.Limit < 1 {
+		opts.Limit = s.config.PaginationLimit
+	}
+
+	rows, next, err := keysetPage(opts.Cursor, "liked_at", opts.Limit,
+		func(conditions []query.Condition, limit int) ([]likedRow, error) {
+			return s.likedRows(ctx, liker, opts.Likeable, conditions, limit)
+		},
+		func(row likedRow) (time.Time, string) { return row.item.LikedAt, row.id },
+	)
+	if err != nil {
+		return LikedPage{}, err
+	}
+
+	page := LikedPage{Items: make([]LikedItem, len(rows)), NextCursor: next}
+	for i, row := range rows {
+		page.Items[i] = row.item
+	}
+	return page, nil
+}
+
+// likedRows loads up to limit likes of liker matching conditions, in
+// keysetOrder, reading only the columns of a LikedItem.
+func (s *LikeService) likedRows(ctx context.Context, liker Liker, likeableType string, conditions []query.Condition, limit int) ([]likedRow, error) {
+	sb := query.New(s.db.Dialect()).
+		Select("id", "likeable", "likeable_id", "reaction", "liked_at").
+		From(likesTable).
+		Where(liker.condition())
+	if likeableType != "" {
+		sb = sb.Where(query.Eq("likeable", likeableType))
+	}
+	for _, condition := range conditions {
+		sb = sb.Where(condition)
+	}
+	for _, order := range keysetOrder("liked_at") {
+		sb = sb.OrderBy(order.Column, order.Direction)
+	}
+
+	q, args, err := sb.Limit(limit).Build()
+	if err != nil {
+		return nil, fmt.Errorf("build liked query: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	liked := make([]likedRow, 0, limit)
+	for rows.Next() {
+		var row likedRow
+		if err := rows.Scan(&row.id, &row.item.Likeable, &row.item.LikeableId, &row.item.Reaction, &row.item.LikedAt); err != nil {
+			return nil, err
+		}
+		liked = append(liked, row)
+	}
+	return liked, rows.Err()
+}
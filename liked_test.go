@@ -0,0 +1,70 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLiked(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	insertLikeAt(t, svc, "user-1", "post-1", base)
+	// Two likes at the same instant are ordered by id.
+	insertLikeAt(t, svc, "user-1", "post-2", base.Add(time.Hour))
+	insertLikeAt(t, svc, "user-1", "post-3", base.Add(time.Hour))
+	insertLikeAt(t, svc, "user-1", "post-4", base.Add(2*time.Hour))
+	insertLikeAt(t, svc, "user-2", "post-5", base.Add(3*time.Hour))
+	comment := newLike("user-1", "comment-1", "like")
+	comment.Likeable = "comment"
+	comment.LikedAt = base.Add(4 * time.Hour)
+	if err := svc.Create(ctx, comment); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	user := Liker{UserID: "user-1"}
+	var got []string
+	opts := LikedOptions{Likeable: "post", Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatal("pagination does not terminate")
+		}
+		page, err := svc.Liked(ctx, user, opts)
+		if err != nil {
+			t.Fatalf("Liked: %v", err)
+		}
+		for _, item := range page.Items {
+			if item.Likeable != "post" || item.LikedAt.IsZero() {
+				t.Errorf("unexpected item %+v", item)
+			}
+			got = append(got, item.LikeableId)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	if len(got) != 4 || got[0] != "post-4" || got[3] != "post-1" {
+		t.Errorf("Liked = %v, want post-4 first and post-1 last", got)
+	}
+	if seen := map[string]bool{got[1]: true, got[2]: true}; !seen["post-2"] || !seen["post-3"] {
+		t.Errorf("Liked = %v, want post-2 and post-3 in between", got)
+	}
+
+	page, err := svc.Liked(ctx, user, LikedOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Liked: %v", err)
+	}
+	if len(page.Items) != 5 || page.Items[0].LikeableId != "comment-1" {
+		t.Errorf("Liked across types = %+v", page.Items)
+	}
+
+	if _, err := svc.Liked(ctx, user, LikedOptions{Cursor: encodeCursor("yesterday", "id")}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Liked with a bad cursor = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -179,5 +179,810 @@ func GetMigrations() migrations.MigrationSource {
 		},
 	)
 
+	builder.Add(
+		"20261016000004000",
+		"add_reaction_to_likes",
+		func(ctx context.Context, db database.Database) error {
+			// Uniqueness moves from (liker, target) to (liker, target, reaction)
+			// so a liker may hold several distinct reactions on one object.
+			// One-reaction-per-liker mode is enforced by the plugin instead.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					ALTER TABLE likes ADD COLUMN IF NOT EXISTS reaction VARCHAR(32) NOT NULL DEFAULT 'like';
+
+					DROP INDEX IF EXISTS unique_authenticated_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_authenticated_like
+					ON likes(liker_id, likeable, likeable_id, reaction)
+					WHERE liker_id IS NOT NULL;
+
+					DROP INDEX IF EXISTS unique_anonymous_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_anonymous_like
+					ON likes(ip_address, user_agent, likeable, likeable_id, reaction)
+					WHERE liker_id IS NULL;
+
+					CREATE INDEX IF NOT EXISTS idx_likeable_reaction
+					ON likes(likeable, likeable_id, reaction);
+				`,
+				MySQL: `
+					ALTER TABLE likes ADD COLUMN reaction VARCHAR(32) NOT NULL DEFAULT 'like' AFTER likeable;
+
+					DROP INDEX unique_authenticated_like ON likes;
+					CREATE UNIQUE INDEX unique_authenticated_like
+					ON likes(liker_id, likeable, likeable_id, reaction);
+
+					DROP INDEX unique_anonymous_like ON likes;
+					CREATE UNIQUE INDEX unique_anonymous_like
+					ON likes(ip_address(255), user_agent(255), likeable, likeable_id, reaction, liker_id);
+
+					CREATE INDEX idx_likeable_reaction
+					ON likes(likeable, likeable_id, reaction);
+				`,
+				// SQLite cannot drop the UNIQUE table constraint declared by
+				// create_likes_table, so the table is rebuilt without it.
+				SQLite: `
+					CREATE TABLE likes_new (
+						id TEXT PRIMARY KEY,
+						liker_id TEXT,
+						liked_id TEXT,
+						likeable_id TEXT NOT NULL,
+						likeable TEXT NOT NULL,
+						reaction TEXT NOT NULL DEFAULT 'like',
+						ip_address TEXT,
+						user_agent TEXT,
+						liked_at TEXT NOT NULL DEFAULT (datetime('now')),
+						updated_at TEXT,
+						created_at TEXT NOT NULL DEFAULT (datetime('now'))
+					);
+
+					INSERT INTO likes_new (id, liker_id, liked_id, likeable_id, likeable, ip_address, user_agent, liked_at, updated_at, created_at)
+					SELECT id, liker_id, liked_id, likeable_id, likeable, ip_address, user_agent, liked_at, updated_at, created_at FROM likes;
+
+					DROP TABLE likes;
+					ALTER TABLE likes_new RENAME TO likes;
+
+					CREATE INDEX IF NOT EXISTS idx_likeable ON likes(likeable, likeable_id, liked_at);
+					CREATE INDEX IF NOT EXISTS idx_liker_id ON likes(liker_id);
+					CREATE INDEX IF NOT EXISTS idx_anonymous_like ON likes(ip_address, user_agent);
+
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_authenticated_like
+					ON likes(liker_id, likeable, likeable_id, reaction)
+					WHERE liker_id IS NOT NULL;
+
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_anonymous_like
+					ON likes(ip_address, user_agent, likeable, likeable_id, reaction)
+					WHERE liker_id IS NULL;
+
+					CREATE INDEX IF NOT EXISTS idx_likeable_reaction
+					ON likes(likeable, likeable_id, reaction);
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			// Collapsing back to one like per liker and object would violate
+			// the restored indexes, so every reaction but the oldest row of
+			// each liker is dropped first.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					DELETE FROM likes WHERE EXISTS (
+						SELECT 1 FROM likes o
+						WHERE o.likeable = likes.likeable
+						AND o.likeable_id = likes.likeable_id
+						AND o.id < likes.id
+						AND (o.liker_id = likes.liker_id OR (
+							o.liker_id IS NULL AND likes.liker_id IS NULL
+							AND o.ip_address = likes.ip_address
+							AND o.user_agent = likes.user_agent))
+					);
+					DROP INDEX IF EXISTS idx_likeable_reaction;
+
+					DROP INDEX IF EXISTS unique_authenticated_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_authenticated_like
+					ON likes(liker_id, likeable, likeable_id)
+					WHERE liker_id IS NOT NULL;
+
+					DROP INDEX IF EXISTS unique_anonymous_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_anonymous_like
+					ON likes(ip_address, user_agent, likeable, likeable_id)
+					WHERE liker_id IS NULL;
+
+					ALTER TABLE likes DROP COLUMN IF EXISTS reaction;
+				`,
+				MySQL: `
+					DELETE l FROM likes l JOIN likes o
+					ON o.likeable = l.likeable
+					AND o.likeable_id = l.likeable_id
+					AND o.id < l.id
+					AND (o.liker_id = l.liker_id OR (
+						o.liker_id IS NULL AND l.liker_id IS NULL
+						AND o.ip_address = l.ip_address
+						AND o.user_agent = l.user_agent));
+					DROP INDEX idx_likeable_reaction ON likes;
+
+					DROP INDEX unique_authenticated_like ON likes;
+					CREATE UNIQUE INDEX unique_authenticated_like
+					ON likes(liker_id, likeable, likeable_id);
+
+					DROP INDEX unique_anonymous_like ON likes;
+					CREATE UNIQUE INDEX unique_anonymous_like
+					ON likes(ip_address(255), user_agent(255), likeable, likeable_id, liker_id);
+
+					ALTER TABLE likes DROP COLUMN reaction;
+				`,
+				SQLite: `
+					DELETE FROM likes WHERE EXISTS (
+						SELECT 1 FROM likes o
+						WHERE o.likeable = likes.likeable
+						AND o.likeable_id = likes.likeable_id
+						AND o.id < likes.id
+						AND (o.liker_id = likes.liker_id OR (
+							o.liker_id IS NULL AND likes.liker_id IS NULL
+							AND o.ip_address = likes.ip_address
+							AND o.user_agent = likes.user_agent))
+					);
+					DROP INDEX IF EXISTS idx_likeable_reaction;
+
+					DROP INDEX IF EXISTS unique_authenticated_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_authenticated_like
+					ON likes(liker_id, likeable, likeable_id)
+					WHERE liker_id IS NOT NULL;
+
+					DROP INDEX IF EXISTS unique_anonymous_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_anonymous_like
+					ON likes(ip_address, user_agent, likeable, likeable_id)
+					WHERE liker_id IS NULL;
+
+					ALTER TABLE likes DROP COLUMN reaction;
+				`,
+			})
+		},
+	)
+
+	builder.Add(
+		"20261016000005000",
+		"add_anonymous_id_to_likes",
+		func(ctx context.Context, db database.Database) error {
+			// Likes carrying a device id are deduplicated on it, and the IP and
+			// user agent pair only applies to anonymous likes made without one,
+			// so visitors sharing a network and browser no longer collide.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					ALTER TABLE likes ADD COLUMN IF NOT EXISTS anonymous_id VARCHAR(36);
+
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_device_like
+					ON likes(anonymous_id, likeable, likeable_id, reaction)
+					WHERE liker_id IS NULL AND anonymous_id IS NOT NULL;
+
+					DROP INDEX IF EXISTS unique_anonymous_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_anonymous_like
+					ON likes(ip_address, user_agent, likeable, likeable_id, reaction)
+					WHERE liker_id IS NULL AND anonymous_id IS NULL;
+				`,
+				MySQL: `
+					ALTER TABLE likes ADD COLUMN anonymous_id VARCHAR(36) NULL AFTER user_agent;
+
+					CREATE UNIQUE INDEX unique_device_like
+					ON likes(anonymous_id, likeable, likeable_id, reaction);
+
+					DROP INDEX unique_anonymous_like ON likes;
+					CREATE UNIQUE INDEX unique_anonymous_like
+					ON likes(ip_address(255), user_agent(255), likeable, likeable_id, reaction, liker_id, anonymous_id);
+				`,
+				SQLite: `
+					ALTER TABLE likes ADD COLUMN anonymous_id TEXT;
+
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_device_like
+					ON likes(anonymous_id, likeable, likeable_id, reaction)
+					WHERE liker_id IS NULL AND anonymous_id IS NOT NULL;
+
+					DROP INDEX IF EXISTS unique_anonymous_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_anonymous_like
+					ON likes(ip_address, user_agent, likeable, likeable_id, reaction)
+					WHERE liker_id IS NULL AND anonymous_id IS NULL;
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			// Device likes fall back to IP and user agent deduplication, so
+			// the ones that would collide on it are dropped first.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					DELETE FROM likes WHERE liker_id IS NULL AND EXISTS (
+						SELECT 1 FROM likes o
+						WHERE o.liker_id IS NULL
+						AND o.likeable = likes.likeable
+						AND o.likeable_id = likes.likeable_id
+						AND o.reaction = likes.reaction
+						AND o.ip_address = likes.ip_address
+						AND o.user_agent = likes.user_agent
+						AND o.id < likes.id
+					);
+
+					DROP INDEX IF EXISTS unique_anonymous_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_anonymous_like
+					ON likes(ip_address, user_agent, likeable, likeable_id, reaction)
+					WHERE liker_id IS NULL;
+
+					DROP INDEX IF EXISTS unique_device_like;
+					ALTER TABLE likes DROP COLUMN IF EXISTS anonymous_id;
+				`,
+				MySQL: `
+					DELETE l FROM likes l JOIN likes o
+					ON o.liker_id IS NULL AND l.liker_id IS NULL
+					AND o.likeable = l.likeable
+					AND o.likeable_id = l.likeable_id
+					AND o.reaction = l.reaction
+					AND o.ip_address = l.ip_address
+					AND o.user_agent = l.user_agent
+					AND o.id < l.id;
+
+					DROP INDEX unique_anonymous_like ON likes;
+					CREATE UNIQUE INDEX unique_anonymous_like
+					ON likes(ip_address(255), user_agent(255), likeable, likeable_id, reaction, liker_id);
+
+					DROP INDEX unique_device_like ON likes;
+					ALTER TABLE likes DROP COLUMN anonymous_id;
+				`,
+				SQLite: `
+					DELETE FROM likes WHERE liker_id IS NULL AND EXISTS (
+						SELECT 1 FROM likes o
+						WHERE o.liker_id IS NULL
+						AND o.likeable = likes.likeable
+						AND o.likeable_id = likes.likeable_id
+						AND o.reaction = likes.reaction
+						AND o.ip_address = likes.ip_address
+						AND o.user_agent = likes.user_agent
+						AND o.id < likes.id
+					);
+
+					DROP INDEX IF EXISTS unique_anonymous_like;
+					CREATE UNIQUE INDEX IF NOT EXISTS unique_anonymous_like
+					ON likes(ip_address, user_agent, likeable, likeable_id, reaction)
+					WHERE liker_id IS NULL;
+
+					DROP INDEX IF EXISTS unique_device_like;
+					ALTER TABLE likes DROP COLUMN anonymous_id;
+				`,
+			})
+		},
+	)
+
+	builder.Add(
+		"20261016000006000",
+		"create_like_counts_table",
+		func(ctx context.Context, db database.Database) error {
+			// Counters are seeded from the existing likes so switching reads
+			// over to them does not reset any count.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					CREATE TABLE IF NOT EXISTS like_counts (
+						likeable TEXT NOT NULL,
+						likeable_id UUID NOT NULL,
+						reaction VARCHAR(32) NOT NULL,
+						count BIGINT NOT NULL DEFAULT 0,
+						PRIMARY KEY (likeable, likeable_id, reaction)
+					);
+
+					INSERT INTO like_counts (likeable, likeable_id, reaction, count)
+					SELECT likeable, likeable_id, reaction, COUNT(*) FROM likes
+					GROUP BY likeable, likeable_id, reaction
+					ON CONFLICT (likeable, likeable_id, reaction) DO NOTHING;
+				`,
+				MySQL: `
+					CREATE TABLE IF NOT EXISTS like_counts (
+						likeable VARCHAR(255) NOT NULL,
+						likeable_id CHAR(36) NOT NULL,
+						reaction VARCHAR(32) NOT NULL,
+						count BIGINT NOT NULL DEFAULT 0,
+						PRIMARY KEY (likeable, likeable_id, reaction)
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+					INSERT IGNORE INTO like_counts (likeable, likeable_id, reaction, count)
+					SELECT likeable, likeable_id, reaction, COUNT(*) FROM likes
+					GROUP BY likeable, likeable_id, reaction;
+				`,
+				SQLite: `
+					CREATE TABLE IF NOT EXISTS like_counts (
+						likeable TEXT NOT NULL,
+						likeable_id TEXT NOT NULL,
+						reaction TEXT NOT NULL,
+						count INTEGER NOT NULL DEFAULT 0,
+						PRIMARY KEY (likeable, likeable_id, reaction)
+					);
+
+					INSERT OR IGNORE INTO like_counts (likeable, likeable_id, reaction, count)
+					SELECT likeable, likeable_id, reaction, COUNT(*) FROM likes
+					GROUP BY likeable, likeable_id, reaction;
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			return migrations.DropTableIfExists(ctx, db, "like_counts")
+		},
+	)
+
+	builder.Add(
+		"20261016000007000",
+		"add_liker_timeline_index_to_likes",
+		func(ctx context.Context, db database.Database) error {
+			// Serves the liker's own likes, newest first.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `CREATE INDEX IF NOT EXISTS idx_liker_timeline ON likes(liker_id, liked_at, id)`,
+				MySQL:    `CREATE INDEX idx_liker_timeline ON likes(liker_id, liked_at, id)`,
+				SQLite:   `CREATE INDEX IF NOT EXISTS idx_liker_timeline ON likes(liker_id, liked_at, id)`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			return migrations.DropIndex(ctx, db, "idx_liker_timeline", "likes")
+		},
+	)
+
+	builder.Add(
+		"20261016000008000",
+		"create_like_webhook_deliveries_table",
+		func(ctx context.Context, db database.Database) error {
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					CREATE TABLE IF NOT EXISTS like_webhook_deliveries (
+						id UUID PRIMARY KEY,
+						event_id UUID NOT NULL,
+						event VARCHAR(32) NOT NULL,
+						url TEXT NOT NULL,
+						payload TEXT NOT NULL,
+						status VARCHAR(16) NOT NULL,
+						attempts INTEGER NOT NULL DEFAULT 0,
+						next_attempt_at TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+						last_error TEXT,
+						response_status INTEGER,
+						created_at TIMESTAMP(6) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+						delivered_at TIMESTAMP(6) WITH TIME ZONE
+					);
+
+					CREATE INDEX IF NOT EXISTS idx_webhook_due ON like_webhook_deliveries(status, next_attempt_at);
+				`,
+				MySQL: `
+					CREATE TABLE IF NOT EXISTS like_webhook_deliveries (
+						id CHAR(36) PRIMARY KEY,
+						event_id CHAR(36) NOT NULL,
+						event VARCHAR(32) NOT NULL,
+						url TEXT NOT NULL,
+						payload TEXT NOT NULL,
+						status VARCHAR(16) NOT NULL,
+						attempts INT NOT NULL DEFAULT 0,
+						next_attempt_at DATETIME(6) NOT NULL,
+						last_error TEXT,
+						response_status INT,
+						created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+						delivered_at DATETIME(6),
+						INDEX idx_webhook_due (status, next_attempt_at)
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+				`,
+				SQLite: `
+					CREATE TABLE IF NOT EXISTS like_webhook_deliveries (
+						id TEXT PRIMARY KEY,
+						event_id TEXT NOT NULL,
+						event TEXT NOT NULL,
+						url TEXT NOT NULL,
+						payload TEXT NOT NULL,
+						status TEXT NOT NULL,
+						attempts INTEGER NOT NULL DEFAULT 0,
+						next_attempt_at DATETIME NOT NULL,
+						last_error TEXT,
+						response_status INTEGER,
+						created_at DATETIME NOT NULL DEFAULT (datetime('now')),
+						delivered_at DATETIME
+					);
+
+					CREATE INDEX IF NOT EXISTS idx_webhook_due ON like_webhook_deliveries(status, next_attempt_at);
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			return migrations.DropTableIfExists(ctx, db, "like_webhook_deliveries")
+		},
+	)
+
+	builder.Add(
+		"20261016000009000",
+		"create_like_events_outbox",
+		func(ctx context.Context, db database.Database) error {
+			// The lease row is seeded so dispatchers only ever update it.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					CREATE TABLE IF NOT EXISTS like_events (
+						seq BIGSERIAL PRIMARY KEY,
+						id UUID NOT NULL UNIQUE,
+						event VARCHAR(32) NOT NULL,
+						payload TEXT NOT NULL,
+						occurred_at TIMESTAMP(6) WITH TIME ZONE NOT NULL,
+						published_at TIMESTAMP(6) WITH TIME ZONE
+					);
+
+					CREATE INDEX IF NOT EXISTS idx_like_events_pending ON like_events(published_at, seq);
+
+					CREATE TABLE IF NOT EXISTS like_outbox_leases (
+						name VARCHAR(64) PRIMARY KEY,
+						owner VARCHAR(36),
+						expires_at TIMESTAMP(6) WITH TIME ZONE
+					);
+
+					INSERT INTO like_outbox_leases (name) VALUES ('like_events') ON CONFLICT (name) DO NOTHING;
+				`,
+				MySQL: `
+					CREATE TABLE IF NOT EXISTS like_events (
+						seq BIGINT AUTO_INCREMENT PRIMARY KEY,
+						id CHAR(36) NOT NULL UNIQUE,
+						event VARCHAR(32) NOT NULL,
+						payload TEXT NOT NULL,
+						occurred_at DATETIME(6) NOT NULL,
+						published_at DATETIME(6),
+						INDEX idx_like_events_pending (published_at, seq)
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+					CREATE TABLE IF NOT EXISTS like_outbox_leases (
+						name VARCHAR(64) PRIMARY KEY,
+						owner CHAR(36),
+						expires_at DATETIME(6)
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+					INSERT IGNORE INTO like_outbox_leases (name) VALUES ('like_events');
+				`,
+				SQLite: `
+					CREATE TABLE IF NOT EXISTS like_events (
+						seq INTEGER PRIMARY KEY AUTOINCREMENT,
+						id TEXT NOT NULL UNIQUE,
+						event TEXT NOT NULL,
+						payload TEXT NOT NULL,
+						occurred_at DATETIME NOT NULL,
+						published_at DATETIME
+					);
+
+					CREATE INDEX IF NOT EXISTS idx_like_events_pending ON like_events(published_at, seq);
+
+					CREATE TABLE IF NOT EXISTS like_outbox_leases (
+						name TEXT PRIMARY KEY,
+						owner TEXT,
+						expires_at DATETIME
+					);
+
+					INSERT OR IGNORE INTO like_outbox_leases (name) VALUES ('like_events');
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			if err := migrations.DropTableIfExists(ctx, db, "like_outbox_leases"); err != nil {
+				return err
+			}
+			return migrations.DropTableIfExists(ctx, db, "like_events")
+		},
+	)
+
+	builder.Add(
+		"20261016000010000",
+		"add_like_flags",
+		func(ctx context.Context, db database.Database) error {
+			// Shadow likes are kept, and shown to their liker, but left out of
+			// counts; the column holds why.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					ALTER TABLE likes ADD COLUMN IF NOT EXISTS shadow VARCHAR(16);
+
+					CREATE TABLE IF NOT EXISTS like_flags (
+						id UUID PRIMARY KEY,
+						like_id UUID,
+						likeable TEXT NOT NULL,
+						likeable_id UUID NOT NULL,
+						liker_id UUID,
+						anonymous_id VARCHAR(36),
+						ip_address TEXT,
+						user_agent TEXT,
+						score INT NOT NULL,
+						signals TEXT NOT NULL,
+						action VARCHAR(16) NOT NULL,
+						flagged_at TIMESTAMP(6) WITH TIME ZONE NOT NULL
+					);
+
+					CREATE INDEX IF NOT EXISTS idx_like_flags_flagged_at ON like_flags(flagged_at, id);
+				`,
+				MySQL: `
+					ALTER TABLE likes ADD COLUMN shadow VARCHAR(16) NULL AFTER anonymous_id;
+
+					CREATE TABLE IF NOT EXISTS like_flags (
+						id CHAR(36) PRIMARY KEY,
+						like_id CHAR(36),
+						likeable VARCHAR(255) NOT NULL,
+						likeable_id CHAR(36) NOT NULL,
+						liker_id CHAR(36),
+						anonymous_id VARCHAR(36),
+						ip_address VARCHAR(255),
+						user_agent TEXT,
+						score INT NOT NULL,
+						signals VARCHAR(255) NOT NULL,
+						action VARCHAR(16) NOT NULL,
+						flagged_at DATETIME(6) NOT NULL,
+						INDEX idx_like_flags_flagged_at (flagged_at, id)
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+				`,
+				SQLite: `
+					ALTER TABLE likes ADD COLUMN shadow TEXT;
+
+					CREATE TABLE IF NOT EXISTS like_flags (
+						id TEXT PRIMARY KEY,
+						like_id TEXT,
+						likeable TEXT NOT NULL,
+						likeable_id TEXT NOT NULL,
+						liker_id TEXT,
+						anonymous_id TEXT,
+						ip_address TEXT,
+						user_agent TEXT,
+						score INTEGER NOT NULL,
+						signals TEXT NOT NULL,
+						action TEXT NOT NULL,
+						flagged_at DATETIME NOT NULL
+					);
+
+					CREATE INDEX IF NOT EXISTS idx_like_flags_flagged_at ON like_flags(flagged_at, id);
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			if err := migrations.DropTableIfExists(ctx, db, "like_flags"); err != nil {
+				return err
+			}
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `ALTER TABLE likes DROP COLUMN IF EXISTS shadow;`,
+				MySQL:    `ALTER TABLE likes DROP COLUMN shadow;`,
+				SQLite:   `ALTER TABLE likes DROP COLUMN shadow;`,
+			})
+		},
+	)
+
+	builder.Add(
+		"20261016000011000",
+		"create_like_shadow_bans",
+		func(ctx context.Context, db database.Database) error {
+			// A ban targets either an account or an anonymous device.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					CREATE TABLE IF NOT EXISTS like_shadow_bans (
+						id UUID PRIMARY KEY,
+						liker_id UUID UNIQUE,
+						anonymous_id VARCHAR(36) UNIQUE,
+						reason TEXT,
+						banned_at TIMESTAMP(6) WITH TIME ZONE NOT NULL
+					);
+
+					CREATE INDEX IF NOT EXISTS idx_like_shadow_bans_banned_at ON like_shadow_bans(banned_at, id);
+				`,
+				MySQL: `
+					CREATE TABLE IF NOT EXISTS like_shadow_bans (
+						id CHAR(36) PRIMARY KEY,
+						liker_id CHAR(36) UNIQUE,
+						anonymous_id VARCHAR(36) UNIQUE,
+						reason TEXT,
+						banned_at DATETIME(6) NOT NULL,
+						INDEX idx_like_shadow_bans_banned_at (banned_at, id)
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+				`,
+				SQLite: `
+					CREATE TABLE IF NOT EXISTS like_shadow_bans (
+						id TEXT PRIMARY KEY,
+						liker_id TEXT UNIQUE,
+						anonymous_id TEXT UNIQUE,
+						reason TEXT,
+						banned_at DATETIME NOT NULL
+					);
+
+					CREATE INDEX IF NOT EXISTS idx_like_shadow_bans_banned_at ON like_shadow_bans(banned_at, id);
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			return migrations.DropTableIfExists(ctx, db, "like_shadow_bans")
+		},
+	)
+
+	addSQLiteTimestampsMigration(builder)
+
+	builder.Add(
+		"20261016000013000",
+		"create_like_outbox_locks",
+		func(ctx context.Context, db database.Database) error {
+			// Transactions appending to like_events lock this row until they
+			// commit, so events are numbered in commit order.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					CREATE TABLE IF NOT EXISTS like_outbox_locks (
+						name VARCHAR(64) PRIMARY KEY
+					);
+
+					INSERT INTO like_outbox_locks (name) VALUES ('like_events') ON CONFLICT (name) DO NOTHING;
+				`,
+				MySQL: `
+					CREATE TABLE IF NOT EXISTS like_outbox_locks (
+						name VARCHAR(64) PRIMARY KEY
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+					INSERT IGNORE INTO like_outbox_locks (name) VALUES ('like_events');
+				`,
+				SQLite: `
+					CREATE TABLE IF NOT EXISTS like_outbox_locks (
+						name TEXT PRIMARY KEY
+					);
+
+					INSERT OR IGNORE INTO like_outbox_locks (name) VALUES ('like_events');
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			return migrations.DropTableIfExists(ctx, db, "like_outbox_locks")
+		},
+	)
+
+	builder.Add(
+		"20261016000014000",
+		"add_ip_network_to_likes",
+		func(ctx context.Context, db database.Database) error {
+			// The /24 or /64 network of raw IP addresses, stored at write time
+			// so fraud detection counts the likes of a network in SQL. Likes
+			// made before have none, and are not counted by network.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					ALTER TABLE likes ADD COLUMN IF NOT EXISTS ip_network VARCHAR(64);
+
+					CREATE INDEX IF NOT EXISTS idx_likes_network ON likes(likeable, likeable_id, ip_network);
+				`,
+				MySQL: `
+					ALTER TABLE likes ADD COLUMN ip_network VARCHAR(64) NULL AFTER ip_address;
+
+					CREATE INDEX idx_likes_network ON likes(likeable, likeable_id, ip_network);
+				`,
+				SQLite: `
+					ALTER TABLE likes ADD COLUMN ip_network TEXT;
+
+					CREATE INDEX IF NOT EXISTS idx_likes_network ON likes(likeable, likeable_id, ip_network);
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					DROP INDEX IF EXISTS idx_likes_network;
+					ALTER TABLE likes DROP COLUMN IF EXISTS ip_network;
+				`,
+				MySQL: `
+					DROP INDEX idx_likes_network ON likes;
+					ALTER TABLE likes DROP COLUMN ip_network;
+				`,
+				SQLite: `
+					DROP INDEX IF EXISTS idx_likes_network;
+					ALTER TABLE likes DROP COLUMN ip_network;
+				`,
+			})
+		},
+	)
+
+	builder.Add(
+		"20261016000015000",
+		"number_like_events_when_published",
+		func(ctx context.Context, db database.Database) error {
+			// Events are numbered by the dispatcher holding the outbox lease
+			// instead of in the writing transactions, which no longer lock
+			// like_outbox_locks. The lease row keeps the last number given,
+			// so numbers keep growing once published events are cleaned up.
+			// Events already stored keep their insert order.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					ALTER TABLE like_events ADD COLUMN IF NOT EXISTS sequence_number BIGINT;
+					ALTER TABLE like_outbox_leases ADD COLUMN IF NOT EXISTS last_sequence_number BIGINT NOT NULL DEFAULT 0;
+
+					UPDATE like_events SET sequence_number = seq;
+					UPDATE like_outbox_leases SET last_sequence_number = (SELECT COALESCE(MAX(seq), 0) FROM like_events);
+
+					CREATE INDEX IF NOT EXISTS idx_like_events_unnumbered ON like_events(sequence_number, seq);
+					CREATE INDEX IF NOT EXISTS idx_like_events_numbered ON like_events(published_at, sequence_number);
+
+					DROP TABLE IF EXISTS like_outbox_locks;
+				`,
+				MySQL: `
+					ALTER TABLE like_events ADD COLUMN sequence_number BIGINT NULL;
+					ALTER TABLE like_outbox_leases ADD COLUMN last_sequence_number BIGINT NOT NULL DEFAULT 0;
+
+					UPDATE like_events SET sequence_number = seq;
+					UPDATE like_outbox_leases SET last_sequence_number = (SELECT COALESCE(MAX(seq), 0) FROM like_events);
+
+					CREATE INDEX idx_like_events_unnumbered ON like_events(sequence_number, seq);
+					CREATE INDEX idx_like_events_numbered ON like_events(published_at, sequence_number);
+
+					DROP TABLE IF EXISTS like_outbox_locks;
+				`,
+				SQLite: `
+					ALTER TABLE like_events ADD COLUMN sequence_number INTEGER;
+					ALTER TABLE like_outbox_leases ADD COLUMN last_sequence_number INTEGER NOT NULL DEFAULT 0;
+
+					UPDATE like_events SET sequence_number = seq;
+					UPDATE like_outbox_leases SET last_sequence_number = (SELECT COALESCE(MAX(seq), 0) FROM like_events);
+
+					CREATE INDEX IF NOT EXISTS idx_like_events_unnumbered ON like_events(sequence_number, seq);
+					CREATE INDEX IF NOT EXISTS idx_like_events_numbered ON like_events(published_at, sequence_number);
+
+					DROP TABLE IF EXISTS like_outbox_locks;
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					DROP INDEX IF EXISTS idx_like_events_numbered;
+					DROP INDEX IF EXISTS idx_like_events_unnumbered;
+					ALTER TABLE like_outbox_leases DROP COLUMN IF EXISTS last_sequence_number;
+					ALTER TABLE like_events DROP COLUMN IF EXISTS sequence_number;
+
+					CREATE TABLE IF NOT EXISTS like_outbox_locks (
+						name VARCHAR(64) PRIMARY KEY
+					);
+
+					INSERT INTO like_outbox_locks (name) VALUES ('like_events') ON CONFLICT (name) DO NOTHING;
+				`,
+				MySQL: `
+					DROP INDEX idx_like_events_numbered ON like_events;
+					DROP INDEX idx_like_events_unnumbered ON like_events;
+					ALTER TABLE like_outbox_leases DROP COLUMN last_sequence_number;
+					ALTER TABLE like_events DROP COLUMN sequence_number;
+
+					CREATE TABLE IF NOT EXISTS like_outbox_locks (
+						name VARCHAR(64) PRIMARY KEY
+					) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+					INSERT IGNORE INTO like_outbox_locks (name) VALUES ('like_events');
+				`,
+				SQLite: `
+					DROP INDEX IF EXISTS idx_like_events_numbered;
+					DROP INDEX IF EXISTS idx_like_events_unnumbered;
+					ALTER TABLE like_outbox_leases DROP COLUMN last_sequence_number;
+					ALTER TABLE like_events DROP COLUMN sequence_number;
+
+					CREATE TABLE IF NOT EXISTS like_outbox_locks (
+						name TEXT PRIMARY KEY
+					);
+
+					INSERT OR IGNORE INTO like_outbox_locks (name) VALUES ('like_events');
+				`,
+			})
+		},
+	)
+
+	builder.Add(
+		"20261016000016000",
+		"index_like_flags_by_object",
+		func(ctx context.Context, db database.Database) error {
+			// Blocked attempts are recorded once per liker and object within
+			// the fraud window, looked up on each attempt.
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					CREATE INDEX IF NOT EXISTS idx_like_flags_object ON like_flags(likeable, likeable_id, action, flagged_at);
+				`,
+				MySQL: `
+					CREATE INDEX idx_like_flags_object ON like_flags(likeable, likeable_id, action, flagged_at);
+				`,
+				SQLite: `
+					CREATE INDEX IF NOT EXISTS idx_like_flags_object ON like_flags(likeable, likeable_id, action, flagged_at);
+				`,
+			})
+		},
+		func(ctx context.Context, db database.Database) error {
+			return migrations.SQL(ctx, db, migrations.DialectSQL{
+				Postgres: `
+					DROP INDEX IF EXISTS idx_like_flags_object;
+				`,
+				MySQL: `
+					DROP INDEX idx_like_flags_object ON like_flags;
+				`,
+				SQLite: `
+					DROP INDEX IF EXISTS idx_like_flags_object;
+				`,
+			})
+		},
+	)
+
 	return builder.Build()
 }
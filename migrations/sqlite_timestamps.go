@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/migrations"
+)
+
+// addSQLiteTimestampsMigration rebuilds the SQLite likes table with its
+// timestamps declared DATETIME. create_likes_table declared them TEXT, which
+// the driver scans back as strings rather than time.Time, so no like could be
+// read through the CRUD on SQLite; the toggle, looking up the reactions a
+// liker holds, was the first to do so. Column types cannot be altered in
+// SQLite, hence the rebuild; the other dialects already use timestamp types.
+func addSQLiteTimestampsMigration(builder *migrations.MigrationBuilder) {
+	builder.Add(
+		"20261016000012000",
+		"declare_sqlite_like_timestamps_datetime",
+		func(ctx context.Context, db database.Database) error {
+			if db.DriverName() != "sqlite" {
+				return nil
+			}
+			return migrations.SQL(ctx, db, migrations.DialectSQL{SQLite: rebuildSQLiteLikes("DATETIME")})
+		},
+		func(ctx context.Context, db database.Database) error {
+			if db.DriverName() != "sqlite" {
+				return nil
+			}
+			return migrations.SQL(ctx, db, migrations.DialectSQL{SQLite: rebuildSQLiteLikes("TEXT")})
+		},
+	)
+}
+
+// rebuildSQLiteLikes returns the SQLite statements rebuilding the likes table,
+// with its indexes, with its timestamps declared as timestampType.
+func rebuildSQLiteLikes(timestampType string) string {
+	return `
+		CREATE TABLE likes_new (
+			id TEXT PRIMARY KEY,
+			liker_id TEXT,
+			liked_id TEXT,
+			likeable_id TEXT NOT NULL,
+			likeable TEXT NOT NULL,
+			reaction TEXT NOT NULL DEFAULT 'like',
+			ip_address TEXT,
+			user_agent TEXT,
+			anonymous_id TEXT,
+			shadow TEXT,
+			liked_at ` + timestampType + ` NOT NULL DEFAULT (datetime('now')),
+			updated_at ` + timestampType + `,
+			created_at ` + timestampType + ` NOT NULL DEFAULT (datetime('now'))
+		);
+
+		INSERT INTO likes_new (id, liker_id, liked_id, likeable_id, likeable, reaction, ip_address, user_agent, anonymous_id, shadow, liked_at, updated_at, created_at)
+		SELECT id, liker_id, liked_id, likeable_id, likeable, reaction, ip_address, user_agent, anonymous_id, shadow, liked_at, updated_at, created_at FROM likes;
+
+		DROP TABLE likes;
+		ALTER TABLE likes_new RENAME TO likes;
+
+		CREATE INDEX IF NOT EXISTS idx_likeable ON likes(likeable, likeable_id, liked_at);
+		CREATE INDEX IF NOT EXISTS idx_liker_id ON likes(liker_id);
+		CREATE INDEX IF NOT EXISTS idx_anonymous_like ON likes(ip_address, user_agent);
+		CREATE INDEX IF NOT EXISTS idx_likeable_reaction ON likes(likeable, likeable_id, reaction);
+		CREATE INDEX IF NOT EXISTS idx_liker_timeline ON likes(liker_id, liked_at, id);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS unique_authenticated_like
+		ON likes(liker_id, likeable, likeable_id, reaction)
+		WHERE liker_id IS NOT NULL;
+
+		CREATE UNIQUE INDEX IF NOT EXISTS unique_device_like
+		ON likes(anonymous_id, likeable, likeable_id, reaction)
+		WHERE liker_id IS NULL AND anonymous_id IS NOT NULL;
+
+		CREATE UNIQUE INDEX IF NOT EXISTS unique_anonymous_like
+		ON likes(ip_address, user_agent, likeable, likeable_id, reaction)
+		WHERE liker_id IS NULL AND anonymous_id IS NULL;
+	`
+}
@@ -5,16 +5,33 @@ import (
 )
 
 type Like struct {
-	Id         string     `json:"id,omitempty" db:"id"`
-	LikerId    *string    `json:"likerId,omitempty" db:"liker_id"`
-	LikedId    *string    `json:"likedId,omitempty" db:"liked_id"`
-	LikeableId string     `json:"likeableId" db:"likeable_id"`
-	Likeable   string     `json:"likeable" db:"likeable"`
-	IpAddress  *string    `json:"ipAddress,omitempty" db:"ip_address"`
-	UserAgent  *string    `json:"userAgent,omitempty" db:"user_agent"`
-	LikedAt    time.Time  `json:"likedAt" db:"liked_at"`
-	UpdatedAt  *time.Time `json:"updatedAt,omitempty" db:"updated_at"`
-	CreatedAt  *time.Time `json:"createdAt,omitempty" db:"created_at"`
+	Id          string     `json:"id,omitempty" db:"id"`
+	LikerId     *string    `json:"likerId,omitempty" db:"liker_id"`
+	LikedId     *string    `json:"likedId,omitempty" db:"liked_id"`
+	LikeableId  string     `json:"likeableId" db:"likeable_id"`
+	Likeable    string     `json:"likeable" db:"likeable"`
+	Reaction    string     `json:"reaction" db:"reaction"`
+	IpAddress   *string    `json:"ipAddress,omitempty" db:"ip_address"`
+	UserAgent   *string    `json:"userAgent,omitempty" db:"user_agent"`
+	AnonymousId *string    `json:"anonymousId,omitempty" db:"anonymous_id"`
+	LikedAt     time.Time  `json:"likedAt" db:"liked_at"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty" db:"updated_at"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty" db:"created_at"`
+	// Shadow is why the like is left out of counts, nil when it is counted.
+	// Its liker still sees it as liked.
+	Shadow *string `json:"-" db:"shadow"`
+	// IpNetwork is the network of IpAddress while it is stored raw, compared
+	// by fraud detection.
+	IpNetwork *string `json:"-" db:"ip_network"`
+
+	// ipAliases are the hashes of the liker's IP address under retired
+	// peppers, matched alongside IpAddress when looking up their likes.
+	ipAliases []string
+	// flag is recorded along with the like when fraud detection flagged it.
+	flag *LikeFlag
+	// revealed is set on likes read for a viewer allowed to see their
+	// non-public fields, see likeReadHooks.
+	revealed bool
 }
 
 func (Like) TableName() string {
@@ -0,0 +1,344 @@
+package likeable
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/logger"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+const (
+	likeEventsTable  = "like_events"
+	outboxLeaseTable = "like_outbox_leases"
+	// outboxLease is the lease a dispatcher holds while draining like_events.
+	outboxLease = "like_events"
+)
+
+// eventBatchSize is the number of events published per batch.
+const eventBatchSize = 100
+
+// EventPublisher receives the like events drained from the outbox, one at a
+// time and in order. An event whose Publish returns an error is retried,
+// after a poll interval, before any later event is published. Events may be
+// published more than once, for example when the process stops right after
+// Publish returns, so consumers should deduplicate on LikeEvent.Id.
+type EventPublisher interface {
+	Publish(ctx context.Context, event LikeEvent) error
+}
+
+// outboxEvent is a row of the like_events outbox. Seq is its insert order,
+// SequenceNumber the order it is published in, given once it is committed.
+type outboxEvent struct {
+	Seq            int64      `db:"seq"`
+	Id             string     `db:"id"`
+	Event          string     `db:"event"`
+	Payload        string     `db:"payload"`
+	OccurredAt     time.Time  `db:"occurred_at"`
+	PublishedAt    *time.Time `db:"published_at"`
+	SequenceNumber *int64     `db:"sequence_number"`
+}
+
+func (outboxEvent) TableName() string {
+	return likeEventsTable
+}
+
+// appendOutbox stores events in the outbox, in the transaction writing the
+// likes they are about.
+func (s *LikeService) appendOutbox(ctx context.Context, db database.Database, events []LikeEvent) error {
+	if !s.config.Outbox {
+		return nil
+	}
+
+	for _, event := range events {
+		payload, err := json.Marshal(event.Like)
+		if err != nil {
+			return err
+		}
+		q, args, err := query.New(db.Dialect()).
+			Insert(likeEventsTable).
+			Columns("id", "event", "payload", "occurred_at").
+			Values(event.Id, event.Event, string(payload), event.OccurredAt).
+			Build()
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(ctx, q, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EventDispatcher drains the like_events outbox to an EventPublisher. Only the
+// instance holding the outbox lease publishes, so events stay in order when
+// several instances run a dispatcher; another one takes over once the lease
+// expires. Published events are kept for EventRetention, then deleted.
+type EventDispatcher struct {
+	db        database.Database
+	config    *Config
+	publisher EventPublisher
+	owner     string
+}
+
+// NewEventDispatcher returns a dispatcher publishing to publisher.
+func NewEventDispatcher(db database.Database, config *Config, publisher EventPublisher) *EventDispatcher {
+	return &EventDispatcher{
+		db:        db,
+		config:    config,
+		publisher: publisher,
+		owner:     uuid.New().String(),
+	}
+}
+
+// Run drains the outbox every EventPollInterval, and deletes the events
+// published more than EventRetention ago, until ctx is done.
+func (d *EventDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.EventPollInterval)
+	defer ticker.Stop()
+
+	var cleaned time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := d.Drain(ctx); err != nil {
+			logger.Log.Error("likeable: draining like events", "error", err)
+		}
+		if time.Since(cleaned) >= time.Minute {
+			if _, err := d.Cleanup(ctx); err != nil {
+				logger.Log.Error("likeable: cleaning up like events", "error", err)
+			}
+			cleaned = time.Now()
+		}
+	}
+}
+
+// Drain publishes the pending events in order, as long as the dispatcher
+// holds the outbox lease, and returns how many it published. It stops at the
+// first event the publisher fails on, which is retried by the next drain.
+//
+// Events are numbered here rather than when written, so writers never wait
+// on each other for the outbox: see number. The lease is renewed before each
+// event, and Publish is cancelled when it expires, so an instance taking the
+// lease over never publishes alongside a slow one. An event is only marked
+// published while the lease is held.
+func (d *EventDispatcher) Drain(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		if _, held, err := d.acquireLease(ctx); err != nil || !held {
+			return published, err
+		}
+		if err := d.number(ctx); err != nil {
+			return published, err
+		}
+
+		pending, err := crud.New[outboxEvent](d.db).GetAllPaginated(ctx, crud.PaginationOptions{
+			Conditions: []query.Condition{query.IsNull("published_at"), query.IsNotNull("sequence_number")},
+			OrderBy:    []crud.OrderByClause{{Column: "sequence_number", Direction: query.ASC}},
+			Limit:      eventBatchSize,
+		})
+		if err != nil {
+			return published, err
+		}
+
+		for _, row := range pending.Items {
+			expiresAt, held, err := d.acquireLease(ctx)
+			if err != nil || !held {
+				return published, err
+			}
+
+			event := LikeEvent{Sequence: *row.SequenceNumber, Id: row.Id, Event: row.Event, OccurredAt: row.OccurredAt}
+			if err := json.Unmarshal([]byte(row.Payload), &event.Like); err != nil {
+				return published, err
+			}
+			publishCtx, cancel := context.WithDeadline(ctx, expiresAt)
+			err = d.publisher.Publish(publishCtx, event)
+			cancel()
+			if err != nil {
+				return published, err
+			}
+
+			marked, err := d.markPublished(ctx, row.Seq)
+			if err != nil || !marked {
+				return published, err
+			}
+			published++
+		}
+		if len(pending.Items) < eventBatchSize {
+			return published, nil
+		}
+	}
+}
+
+// number gives the next sequence numbers to a batch of the committed events
+// not numbered yet, in insert order. Only committed events are visible, so an
+// event committed after others were numbered gets a later number, however
+// early it was inserted: events are published in commit order, and writers
+// need no lock to get there. Writes touching the same likes or counters
+// already commit one after the other, and insert their events in that order.
+//
+// Numbering happens in a transaction holding the lease row, and only while
+// the dispatcher holds the lease, so numbers are never given twice. The last
+// number given is kept on the lease row, as events are deleted once
+// published.
+func (d *EventDispatcher) number(ctx context.Context) error {
+	return runTx(ctx, d.db, func(tx database.Database) error {
+		q, args, err := query.New(tx.Dialect()).
+			Select("last_sequence_number").
+			From(outboxLeaseTable).
+			Where(query.And(
+				query.Eq("name", outboxLease),
+				query.Eq("owner", d.owner),
+				query.Gt("expires_at", time.Now().UTC()),
+			)).
+			Build()
+		if err != nil {
+			return err
+		}
+		if tx.DriverName() != "sqlite" {
+			q += " FOR UPDATE"
+		}
+		rows, err := tx.Query(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		var last int64
+		held := rows.Next()
+		if held {
+			err = rows.Scan(&last)
+		}
+		rows.Close()
+		if err != nil || !held {
+			return err
+		}
+
+		unnumbered, err := crud.New[outboxEvent](tx).GetAllPaginated(ctx, crud.PaginationOptions{
+			Conditions: []query.Condition{query.IsNull("sequence_number")},
+			OrderBy:    []crud.OrderByClause{{Column: "seq", Direction: query.ASC}},
+			Limit:      eventBatchSize,
+		})
+		if err != nil || len(unnumbered.Items) == 0 {
+			return err
+		}
+		for _, row := range unnumbered.Items {
+			last++
+			q, args, err := query.New(tx.Dialect()).
+				Update(likeEventsTable).
+				Set("sequence_number", last).
+				Where(query.Eq("seq", row.Seq)).
+				Build()
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, q, args...); err != nil {
+				return err
+			}
+		}
+
+		q, args, err = query.New(tx.Dialect()).
+			Update(outboxLeaseTable).
+			Set("last_sequence_number", last).
+			Where(query.Eq("name", outboxLease)).
+			Build()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, q, args...)
+		return err
+	})
+}
+
+// acquireLease takes or renews the outbox lease, and reports whether the
+// dispatcher holds it and until when. The lease row is created by the
+// migration, so taking it is a single conditional update whichever the
+// database.
+func (d *EventDispatcher) acquireLease(ctx context.Context) (time.Time, bool, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(d.config.EventLeaseDuration)
+	q, args, err := query.New(d.db.Dialect()).
+		Update(outboxLeaseTable).
+		Set("owner", d.owner).
+		Set("expires_at", expiresAt).
+		Where(query.And(
+			query.Eq("name", outboxLease),
+			query.Or(query.Eq("owner", d.owner), query.IsNull("owner"), query.Lt("expires_at", now)),
+		)).
+		Build()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	result, err := d.db.Exec(ctx, q, args...)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	affected, err := result.RowsAffected()
+	return expiresAt, affected == 1, err
+}
+
+// ReleaseLease gives the outbox lease up, so another instance can take over
+// without waiting for it to expire, typically on shutdown.
+func (d *EventDispatcher) ReleaseLease(ctx context.Context) error {
+	q, args, err := query.New(d.db.Dialect()).
+		Update(outboxLeaseTable).
+		Set("owner", nil).
+		Where(query.And(query.Eq("name", outboxLease), query.Eq("owner", d.owner))).
+		Build()
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(ctx, q, args...)
+	return err
+}
+
+// markPublished marks the event numbered seq published, unless the
+// dispatcher lost the lease, and reports whether it did.
+func (d *EventDispatcher) markPublished(ctx context.Context, seq int64) (bool, error) {
+	now := time.Now().UTC()
+	lease := query.New(d.db.Dialect()).
+		Select("name").
+		From(outboxLeaseTable).
+		Where(query.And(
+			query.Eq("name", outboxLease),
+			query.Eq("owner", d.owner),
+			query.Gt("expires_at", now),
+		))
+	q, args, err := query.New(d.db.Dialect()).
+		Update(likeEventsTable).
+		Set("published_at", now).
+		Where(query.And(query.Eq("seq", seq), query.Exists(lease))).
+		Build()
+	if err != nil {
+		return false, err
+	}
+	result, err := d.db.Exec(ctx, q, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// Cleanup deletes the events published more than EventRetention ago, and
+// returns how many it deleted.
+func (d *EventDispatcher) Cleanup(ctx context.Context) (int64, error) {
+	q, args, err := query.New(d.db.Dialect()).
+		Delete(likeEventsTable).
+		Where(query.Lt("published_at", time.Now().UTC().Add(-d.config.EventRetention))).
+		Build()
+	if err != nil {
+		return 0, err
+	}
+	result, err := d.db.Exec(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,264 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordingPublisher records the events it is given. With fail set, it fails
+// once, on the event following the first one recorded.
+type recordingPublisher struct {
+	fail   bool
+	events []LikeEvent
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event LikeEvent) error {
+	if p.fail && len(p.events) == 1 {
+		p.fail = false
+		return errors.New("broker unavailable")
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestOutbox(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.Outbox = true
+	svc := NewLikeService(db, WithConfig(&cfg))
+	ctx := context.Background()
+
+	first := newLike("user-1", "post-1", "like")
+	if _, err := svc.Like(ctx, first); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if _, err := svc.Like(ctx, newLike("user-2", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if err := svc.Unlike(ctx, "user-1", "post", "post-1"); err != nil {
+		t.Fatalf("Unlike: %v", err)
+	}
+	if _, err := svc.Like(ctx, newLike("user-3", "post-3", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	duplicate := newLike("user-3", "post-2", "like")
+	if err := svc.Create(ctx, duplicate); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// A write rolled back leaves no event behind.
+	if err := svc.Create(ctx, duplicate); err == nil {
+		t.Fatal("Create with a duplicate id should fail")
+	}
+
+	publisher := &recordingPublisher{}
+	dispatcher := NewEventDispatcher(db, &cfg, publisher)
+	if n, err := dispatcher.Drain(ctx); err != nil || n != 5 {
+		t.Fatalf("Drain = %d, %v, want 5 events published", n, err)
+	}
+
+	want := []string{EventLikeCreated, EventLikeCreated, EventLikeDeleted, EventLikeCreated, EventLikeCreated}
+	for i, event := range publisher.events {
+		if event.Event != want[i] {
+			t.Errorf("event %d = %s, want %s", i, event.Event, want[i])
+		}
+		if i > 0 && event.Sequence <= publisher.events[i-1].Sequence {
+			t.Errorf("event %d is out of order", i)
+		}
+	}
+	if deleted := publisher.events[2]; deleted.Like.Id != first.Id || deleted.Like.LikeableId != "post-1" {
+		t.Errorf("deleted event = %+v", deleted)
+	}
+
+	// The first dispatcher holds the lease until it releases it.
+	if _, err := svc.Like(ctx, newLike("user-4", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	other := NewEventDispatcher(db, &cfg, &recordingPublisher{})
+	if n, err := other.Drain(ctx); err != nil || n != 0 {
+		t.Errorf("Drain without the lease = %d, %v, want nothing published", n, err)
+	}
+	if err := dispatcher.ReleaseLease(ctx); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	if n, err := other.Drain(ctx); err != nil || n != 1 {
+		t.Errorf("Drain after release = %d, %v, want the new event published", n, err)
+	}
+
+	cfg.EventRetention = 0
+	deleted, err := other.Cleanup(ctx)
+	if err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if deleted != 6 {
+		t.Errorf("Cleanup deleted %d events, want 6", deleted)
+	}
+}
+
+func TestOutboxNumbersEventsOnceCommitted(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.Outbox = true
+	svc := NewLikeService(db, WithConfig(&cfg))
+	ctx := context.Background()
+	publisher := &recordingPublisher{}
+	dispatcher := NewEventDispatcher(db, &cfg, publisher)
+
+	if _, err := svc.Like(ctx, newLike("user-1", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if _, err := dispatcher.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	// An event inserted before the first one by a transaction committing
+	// after it was published.
+	_, err := db.Exec(ctx, "INSERT INTO like_events (seq, id, event, payload, occurred_at) VALUES (0, 'late', ?, '{}', ?)",
+		EventLikeCreated, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("insert late event: %v", err)
+	}
+	if _, err := dispatcher.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	cfg.EventRetention = 0
+	if _, err := dispatcher.Cleanup(ctx); err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if _, err := svc.Like(ctx, newLike("user-2", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if _, err := dispatcher.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	if len(publisher.events) != 3 {
+		t.Fatalf("published %d events, want 3", len(publisher.events))
+	}
+	for i, event := range publisher.events {
+		if event.Sequence != int64(i+1) {
+			t.Errorf("event %d (%s) has sequence %d, want %d", i, event.Id, event.Sequence, i+1)
+		}
+	}
+	if publisher.events[1].Id != "late" {
+		t.Errorf("event published second = %s, want the late one", publisher.events[1].Id)
+	}
+}
+
+func TestOutboxRetriesInOrder(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.Outbox = true
+	svc := NewLikeService(db, WithConfig(&cfg))
+	ctx := context.Background()
+
+	for _, id := range []string{"post-1", "post-2", "post-3"} {
+		if _, err := svc.Like(ctx, newLike("user-1", id, "like")); err != nil {
+			t.Fatalf("Like: %v", err)
+		}
+	}
+
+	publisher := &recordingPublisher{fail: true}
+	dispatcher := NewEventDispatcher(db, &cfg, publisher)
+	if n, err := dispatcher.Drain(ctx); err == nil || n != 1 {
+		t.Fatalf("Drain = %d, %v, want to stop at the failing event", n, err)
+	}
+	if n, err := dispatcher.Drain(ctx); err != nil || n != 2 {
+		t.Fatalf("Drain = %d, %v, want the failed event retried first", n, err)
+	}
+	for i, event := range publisher.events {
+		if want := []string{"post-1", "post-2", "post-3"}[i]; event.Like.LikeableId != want {
+			t.Errorf("event %d is about %s, want %s", i, event.Like.LikeableId, want)
+		}
+	}
+}
+
+// publisherFunc adapts a function to EventPublisher.
+type publisherFunc func(ctx context.Context, event LikeEvent) error
+
+func (f publisherFunc) Publish(ctx context.Context, event LikeEvent) error {
+	return f(ctx, event)
+}
+
+func TestPluginDispatcherLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	published := make(chan LikeEvent, 1)
+
+	p := &LikeablePlugin{}
+	if err := p.Initialize(map[string]interface{}{
+		"database":            db,
+		"event_poll_interval": "10ms",
+		"event_publisher": publisherFunc(func(ctx context.Context, event LikeEvent) error {
+			published <- event
+			return nil
+		}),
+	}); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	like := newLike("user-1", "post-1", "like")
+	if _, err := p.hooks.service.Like(ctx, like); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	select {
+	case event := <-published:
+		if event.Like.Id != like.Id {
+			t.Errorf("published %+v, want the event of the like", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the started dispatcher published nothing")
+	}
+
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	var owner *string
+	if err := db.QueryRow(ctx, "SELECT owner FROM like_outbox_leases WHERE name = ?", outboxLease).Scan(&owner); err != nil {
+		t.Fatalf("read lease: %v", err)
+	}
+	if owner != nil {
+		t.Errorf("lease owner = %s after Stop, want it released", *owner)
+	}
+	if err := p.Stop(ctx); err != nil {
+		t.Errorf("second Stop = %v, want nil", err)
+	}
+}
+
+func TestDrainStopsWhenTheLeaseIsLost(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.Outbox = true
+	svc := NewLikeService(db, WithConfig(&cfg))
+	ctx := context.Background()
+
+	for _, likerID := range []string{"user-1", "user-2"} {
+		if _, err := svc.Like(ctx, newLike(likerID, "post-1", "like")); err != nil {
+			t.Fatalf("Like: %v", err)
+		}
+	}
+
+	// The lease is taken over while the first event is being published.
+	slow := NewEventDispatcher(db, &cfg, publisherFunc(func(ctx context.Context, event LikeEvent) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("Publish should be bounded by the lease")
+		}
+		_, err := db.Exec(ctx, "UPDATE like_outbox_leases SET owner = 'other'")
+		return err
+	}))
+	if n, err := slow.Drain(ctx); err != nil || n != 0 {
+		t.Errorf("Drain losing the lease = %d, %v, want nothing marked published", n, err)
+	}
+
+	if _, err := db.Exec(ctx, "UPDATE like_outbox_leases SET owner = NULL"); err != nil {
+		t.Fatalf("release lease: %v", err)
+	}
+	publisher := &recordingPublisher{}
+	if n, err := NewEventDispatcher(db, &cfg, publisher).Drain(ctx); err != nil || n != 2 {
+		t.Errorf("Drain after takeover = %d, %v, want both events published", n, err)
+	}
+}
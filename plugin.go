@@ -1,15 +1,34 @@
 package likeable
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/gofiber/fiber/v3"
 	"github.com/nicolasbonnici/gorest-likeable/migrations"
 	"github.com/nicolasbonnici/gorest/database"
 	"github.com/nicolasbonnici/gorest/plugin"
 )
 
+var errNoDatabase = errors.New("likeable plugin initialized without a database")
+
+var _ UserDataProvider = (*LikeablePlugin)(nil)
+
 type LikeablePlugin struct {
-	config Config
-	db     database.Database
+	config    Config
+	db        database.Database
+	hooks     *LikeHooks
+	callbacks likeCallbacks
+	publisher EventPublisher
+
+	// mu guards the dispatchers run between Start and Stop.
+	mu      sync.Mutex
+	stop    context.CancelFunc
+	running sync.WaitGroup
+	events  *EventDispatcher
 }
 
 func NewPlugin() plugin.Plugin {
@@ -33,13 +52,7 @@ func (p *LikeablePlugin) Initialize(config map[string]interface{}) error {
 	}
 
 	if allowedTypes, ok := config["allowed_types"].([]interface{}); ok {
-		types := make([]string, 0, len(allowedTypes))
-		for _, t := range allowedTypes {
-			if str, ok := t.(string); ok {
-				types = append(types, str)
-			}
-		}
-		if len(types) > 0 {
+		if types := toStringSlice(allowedTypes); len(types) > 0 {
 			p.config.AllowedTypes = types
 		}
 	}
@@ -56,10 +69,399 @@ func (p *LikeablePlugin) Initialize(config map[string]interface{}) error {
 		p.config.EnableUserLikes = enableUserLikes
 	}
 
-	return p.config.Validate()
+	if publicFields, ok := config["public_fields"].([]interface{}); ok {
+		p.config.PublicFields = toStringSlice(publicFields)
+	}
+
+	if adminRoles, ok := config["admin_roles"].([]interface{}); ok {
+		p.config.AdminRoles = toStringSlice(adminRoles)
+	}
+
+	if liveCounts, ok := config["live_counts"].(bool); ok {
+		p.config.LiveCounts = liveCounts
+	}
+
+	if cacheSize, ok := config["cache_size"].(int); ok {
+		p.config.CacheSize = cacheSize
+	}
+
+	if err := parseDuration(config, "cache_ttl", &p.config.CacheTTL); err != nil {
+		return err
+	}
+
+	switch gravity := config["trending_gravity"].(type) {
+	case float64:
+		p.config.TrendingGravity = gravity
+	case int:
+		p.config.TrendingGravity = float64(gravity)
+	}
+
+	if err := parseDuration(config, "trending_offset", &p.config.TrendingOffset); err != nil {
+		return err
+	}
+
+	if err := parseDuration(config, "trending_max_window", &p.config.TrendingMaxWindow); err != nil {
+		return err
+	}
+
+	if maxBuckets, ok := config["histogram_max_buckets"].(int); ok {
+		p.config.HistogramMaxBuckets = maxBuckets
+	}
+
+	if maxObjects, ok := config["histogram_max_objects"].(int); ok {
+		p.config.HistogramMaxObjects = maxObjects
+	}
+
+	if defaultReaction, ok := config["default_reaction"].(string); ok {
+		p.config.DefaultReaction = defaultReaction
+	}
+
+	if reactionMode, ok := config["reaction_mode"].(string); ok {
+		p.config.ReactionMode = reactionMode
+	}
+
+	if secret, ok := config["anonymous_secret"].(string); ok {
+		p.config.AnonymousSecret = secret
+	}
+
+	if cookieName, ok := config["anonymous_cookie_name"].(string); ok {
+		p.config.AnonymousCookieName = cookieName
+	}
+
+	if headerName, ok := config["anonymous_header_name"].(string); ok {
+		p.config.AnonymousHeaderName = headerName
+	}
+
+	if maxAge, ok := config["anonymous_cookie_max_age"].(int); ok {
+		p.config.AnonymousCookieMaxAge = maxAge
+	}
+
+	if secure, ok := config["anonymous_cookie_secure"].(bool); ok {
+		p.config.AnonymousCookieSecure = secure
+	}
+
+	if trackingMode, ok := config["tracking_mode"].(string); ok {
+		p.config.TrackingMode = trackingMode
+	}
+
+	if peppers, ok := config["tracking_peppers"].([]interface{}); ok {
+		p.config.TrackingPeppers = toStringSlice(peppers)
+	}
+
+	if truncateIP, ok := config["tracking_truncate_ip"].(bool); ok {
+		p.config.TrackingTruncateIP = truncateIP
+	}
+
+	if retention, ok := config["retention"].(map[string]interface{}); ok {
+		p.config.Retention = parseRetentionPolicy(retention)
+	}
+
+	if retentionByType, ok := config["retention_by_type"].(map[string]interface{}); ok {
+		for likeableType, raw := range retentionByType {
+			if policy, ok := raw.(map[string]interface{}); ok {
+				p.config.RetentionByType[likeableType] = parseRetentionPolicy(policy)
+			}
+		}
+	}
+
+	if erasureMode, ok := config["erasure_mode"].(string); ok {
+		p.config.ErasureMode = erasureMode
+	}
+
+	if webhooks, ok := config["webhooks"].([]interface{}); ok {
+		for _, raw := range webhooks {
+			if endpoint, ok := raw.(map[string]interface{}); ok {
+				p.config.Webhooks = append(p.config.Webhooks, parseWebhookEndpoint(endpoint))
+			}
+		}
+	}
+
+	if maxAttempts, ok := config["webhook_max_attempts"].(int); ok {
+		p.config.WebhookMaxAttempts = maxAttempts
+	}
+
+	for key, target := range map[string]*time.Duration{
+		"webhook_backoff":       &p.config.WebhookBackoff,
+		"webhook_max_backoff":   &p.config.WebhookMaxBackoff,
+		"webhook_timeout":       &p.config.WebhookTimeout,
+		"webhook_poll_interval": &p.config.WebhookPollInterval,
+	} {
+		if err := parseDuration(config, key, target); err != nil {
+			return err
+		}
+	}
+
+	if outbox, ok := config["outbox"].(bool); ok {
+		p.config.Outbox = outbox
+	}
+
+	for key, target := range map[string]*time.Duration{
+		"event_poll_interval":  &p.config.EventPollInterval,
+		"event_lease_duration": &p.config.EventLeaseDuration,
+		"event_retention":      &p.config.EventRetention,
+	} {
+		if err := parseDuration(config, key, target); err != nil {
+			return err
+		}
+	}
+
+	if maxTargets, ok := config["stream_max_targets"].(int); ok {
+		p.config.StreamMaxTargets = maxTargets
+	}
+
+	if err := parseDuration(config, "stream_heartbeat", &p.config.StreamHeartbeat); err != nil {
+		return err
+	}
+
+	if err := parseDuration(config, "socket_push_interval", &p.config.SocketPushInterval); err != nil {
+		return err
+	}
+
+	if limits, ok := config["rate_limits"].(map[string]interface{}); ok {
+		parsed, err := parseRateLimits(limits)
+		if err != nil {
+			return fmt.Errorf("invalid rate_limits: %w", err)
+		}
+		p.config.RateLimits = parsed
+	}
+
+	if byType, ok := config["rate_limits_by_type"].(map[string]interface{}); ok {
+		for likeableType, raw := range byType {
+			if limits, ok := raw.(map[string]interface{}); ok {
+				parsed, err := parseRateLimits(limits)
+				if err != nil {
+					return fmt.Errorf("invalid rate_limits_by_type for %s: %w", likeableType, err)
+				}
+				p.config.RateLimitsByType[likeableType] = parsed
+			}
+		}
+	}
+
+	if anonymousBy, ok := config["rate_limit_anonymous_by"].(string); ok {
+		p.config.RateLimitAnonymousBy = anonymousBy
+	}
+
+	// Like the database, a shared rate limit store can only be passed in Go.
+	if store, ok := config["rate_limit_store"].(RateLimitStore); ok {
+		p.config.RateLimitStore = store
+	}
+
+	if fraudDetection, ok := config["fraud_detection"].(bool); ok {
+		p.config.FraudDetection = fraudDetection
+	}
+
+	for key, target := range map[string]*int{
+		"fraud_velocity":         &p.config.FraudVelocity,
+		"fraud_subnet_likes":     &p.config.FraudSubnetLikes,
+		"fraud_user_agent_likes": &p.config.FraudUserAgentLikes,
+		"fraud_flag_score":       &p.config.FraudFlagScore,
+		"fraud_shadow_score":     &p.config.FraudShadowScore,
+		"fraud_block_score":      &p.config.FraudBlockScore,
+	} {
+		if value, ok := config[key].(int); ok {
+			*target = value
+		}
+	}
+
+	for key, target := range map[string]*time.Duration{
+		"fraud_window":          &p.config.FraudWindow,
+		"fraud_min_account_age": &p.config.FraudMinAccountAge,
+	} {
+		if err := parseDuration(config, key, target); err != nil {
+			return err
+		}
+	}
+
+	// Accounts belong to the application, which tells their age in Go.
+	if accountAges, ok := config["account_ages"].(AccountAgeProvider); ok {
+		p.config.AccountAges = accountAges
+	}
+
+	if botFilter, ok := config["bot_filter"].(bool); ok {
+		p.config.BotFilter = botFilter
+	}
+
+	for key, target := range map[string]*[]string{
+		"bot_user_agents":       &p.config.BotUserAgents,
+		"bot_allow_user_agents": &p.config.BotAllowUserAgents,
+		"bot_deny_cidrs":        &p.config.BotDenyCIDRs,
+		"bot_allow_cidrs":       &p.config.BotAllowCIDRs,
+	} {
+		if items, ok := config[key].([]interface{}); ok {
+			*target = toStringSlice(items)
+		}
+	}
+
+	if botListFile, ok := config["bot_list_file"].(string); ok {
+		p.config.BotListFile = botListFile
+	}
+
+	// A publisher can only be passed in Go, alongside the database. It turns
+	// the outbox on.
+	publisher, _ := config["event_publisher"].(EventPublisher)
+	p.publisher = publisher
+	if publisher != nil {
+		p.config.Outbox = true
+	}
+
+	if reactions, ok := config["reactions"].(map[string]interface{}); ok {
+		for likeableType, list := range reactions {
+			if items, ok := list.([]interface{}); ok {
+				p.config.Reactions[likeableType] = toStringSlice(items)
+			}
+		}
+	}
+
+	if err := p.config.Validate(); err != nil {
+		return err
+	}
+	if p.db != nil {
+		p.hooks = NewLikeHooks(p.db, &p.config)
+		p.hooks.callbacks = &p.callbacks
+	}
+	return nil
+}
+
+// Start runs the dispatchers the configuration calls for in the background:
+// the webhook dispatcher when webhooks are configured, and the event
+// dispatcher when an event publisher was given. They run until Stop. Start
+// does nothing without a database or when the dispatchers already run.
+func (p *LikeablePlugin) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.hooks == nil || p.stop != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.stop = cancel
+	if len(p.config.Webhooks) > 0 {
+		p.run(ctx, NewWebhookDispatcher(p.db, &p.config).Run)
+	}
+	if p.publisher != nil {
+		p.events = NewEventDispatcher(p.db, &p.config, p.publisher)
+		p.run(ctx, p.events.Run)
+	}
+	return nil
+}
+
+func (p *LikeablePlugin) run(ctx context.Context, dispatch func(context.Context)) {
+	p.running.Add(1)
+	go func() {
+		defer p.running.Done()
+		dispatch(ctx)
+	}()
+}
+
+// Stop stops the dispatchers started by Start and waits for them to return,
+// or for ctx to be done. It then releases the outbox lease, so another
+// instance publishes the events right away instead of once the lease expires.
+func (p *LikeablePlugin) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop == nil {
+		return nil
+	}
+	p.stop()
+	p.stop = nil
+
+	stopped := make(chan struct{})
+	go func() {
+		p.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	events := p.events
+	p.events = nil
+	if events == nil {
+		return nil
+	}
+	return events.ReleaseLease(ctx)
+}
+
+// parseDuration reads a duration such as "30s" or "24h" from config.
+func parseDuration(config map[string]interface{}, key string, target *time.Duration) error {
+	value, ok := config[key].(string)
+	if !ok {
+		return nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	*target = duration
+	return nil
+}
+
+func parseRetentionPolicy(config map[string]interface{}) RetentionPolicy {
+	var policy RetentionPolicy
+	if days, ok := config["anonymize_after_days"].(int); ok {
+		policy.AnonymizeAfterDays = days
+	}
+	if days, ok := config["purge_anonymous_after_days"].(int); ok {
+		policy.PurgeAnonymousAfterDays = days
+	}
+	return policy
+}
+
+func parseWebhookEndpoint(config map[string]interface{}) WebhookEndpoint {
+	var endpoint WebhookEndpoint
+	endpoint.URL, _ = config["url"].(string)
+	endpoint.Secret, _ = config["secret"].(string)
+	if types, ok := config["types"].([]interface{}); ok {
+		endpoint.Types = toStringSlice(types)
+	}
+	if events, ok := config["events"].([]interface{}); ok {
+		endpoint.Events = toStringSlice(events)
+	}
+	return endpoint
+}
+
+// parseRateLimits reads rate limits by action, each given as a map of its
+// rate, per and burst.
+func parseRateLimits(config map[string]interface{}) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit, len(config))
+	for action, raw := range config {
+		values, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var limit RateLimit
+		limit.Rate, _ = values["rate"].(int)
+		limit.Burst, _ = values["burst"].(int)
+		if err := parseDuration(values, "per", &limit.Per); err != nil {
+			return nil, err
+		}
+		limits[action] = limit
+	}
+	return limits, nil
+}
+
+func toStringSlice(values []interface{}) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if str, ok := v.(string); ok {
+			out = append(out, str)
+		}
+	}
+	return out
+}
+
+// Config returns the configuration the plugin was initialized with.
+func (p *LikeablePlugin) Config() Config {
+	return p.config
 }
 
 func (p *LikeablePlugin) Handler() fiber.Handler {
+	if p.config.AnonymousTokensEnabled() {
+		return anonymousMiddleware(NewDeviceTokens(p.config.AnonymousSecret), &p.config)
+	}
+
 	return func(c fiber.Ctx) error {
 		return c.Next()
 	}
@@ -70,10 +472,38 @@ func (p *LikeablePlugin) SetupEndpoints(router fiber.Router) error {
 		return nil
 	}
 
-	RegisterRoutes(router, p.db, &p.config)
+	registerLikeRoutes(router, p.hooks)
 	return nil
 }
 
+// ExportUserData returns the likes made and received by a user, as a
+// UserDataExport.
+func (p *LikeablePlugin) ExportUserData(ctx context.Context, userID string) (any, error) {
+	if p.hooks == nil {
+		return nil, errNoDatabase
+	}
+	return p.hooks.service.ExportUserData(ctx, userID)
+}
+
+// EraseUserData erases the likes of a user according to erasure_mode.
+func (p *LikeablePlugin) EraseUserData(ctx context.Context, userID string) error {
+	if p.hooks == nil {
+		return errNoDatabase
+	}
+	_, err := p.hooks.service.EraseUserData(ctx, userID, p.config.ErasureMode)
+	return err
+}
+
+// ReloadBotList reads the bot list again, including bot_list_file, as
+// POST /likes/bots/reload does, for instance on SIGHUP. The rules in place
+// are kept when it fails.
+func (p *LikeablePlugin) ReloadBotList() error {
+	if p.hooks == nil {
+		return errNoDatabase
+	}
+	return p.hooks.bots.reload()
+}
+
 func (p *LikeablePlugin) MigrationSource() interface{} {
 	return migrations.GetMigrations()
 }
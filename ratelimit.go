@@ -0,0 +1,196 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nicolasbonnici/gorest/logger"
+)
+
+// Rate limited actions.
+const (
+	RateLimitLike   = "like"
+	RateLimitUnlike = "unlike"
+)
+
+// How anonymous callers are told apart by rate limits.
+const (
+	// RateLimitByIP shares a bucket between the anonymous callers of an IP
+	// address. Device tokens are free to obtain, so this is the default.
+	RateLimitByIP = "ip"
+	// RateLimitByDevice gives each device token its own bucket, and falls
+	// back to the IP address for callers without one.
+	RateLimitByDevice = "device"
+)
+
+// rateLimitSweepInterval is how often the in-memory store drops the buckets
+// that refilled.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimit is a token bucket: Rate tokens are added every Per, up to Burst,
+// and each action takes one. Burst defaults to Rate.
+type RateLimit struct {
+	Rate  int           `json:"rate" yaml:"rate"`
+	Per   time.Duration `json:"per" yaml:"per"`
+	Burst int           `json:"burst" yaml:"burst"`
+}
+
+func (l RateLimit) validate() error {
+	if l.Rate < 1 || l.Per <= 0 {
+		return errors.New("rate and per must be positive")
+	}
+	if l.Burst < 0 {
+		return errors.New("burst cannot be negative")
+	}
+	return nil
+}
+
+func (l RateLimit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Rate)
+}
+
+// refill returns the number of tokens added per second.
+func (l RateLimit) refill() float64 {
+	return float64(l.Rate) / l.Per.Seconds()
+}
+
+// RateLimitStore holds the token buckets. The default one keeps them in
+// memory, so each instance enforces limits on its own; a store shared by the
+// instances, such as one backed by Redis, enforces them globally.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of key, filled according to limit.
+	// It returns zero when one was available, and otherwise how long until
+	// one is.
+	Take(ctx context.Context, key string, limit RateLimit) (time.Duration, error)
+}
+
+// MemoryRateLimitStore is a RateLimitStore local to the process.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket is back to its capacity, and can be dropped.
+	full time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+func (m *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= rateLimitSweepInterval {
+		for k, b := range m.buckets {
+			if !now.Before(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	capacity, refill := limit.capacity(), limit.refill()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*refill)
+	b.updated = now
+
+	var wait time.Duration
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		wait = time.Duration(math.Ceil((1 - b.tokens) / refill * float64(time.Second)))
+	}
+	b.full = now.Add(time.Duration((capacity - b.tokens) / refill * float64(time.Second)))
+	return wait, nil
+}
+
+// RateLimitError rejects an action of a caller who ran out of tokens.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "Too many requests"
+}
+
+// retryAfterSeconds is the Retry-After of e, rounded up to whole seconds.
+func (e *RateLimitError) retryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// rateLimitResponse maps a RateLimitError to a 429 carrying a Retry-After
+// header.
+func rateLimitResponse(c fiber.Ctx, err error) (*fiber.Error, bool) {
+	var limited *RateLimitError
+	if !errors.As(err, &limited) {
+		return nil, false
+	}
+	c.Set("Retry-After", strconv.Itoa(limited.retryAfterSeconds()))
+	return fiber.NewError(fiber.StatusTooManyRequests, limited.Error()), true
+}
+
+// rateLimited lets the handlers returning their errors as is answer a
+// RateLimitError with a Retry-After header.
+func rateLimited(handler fiber.Handler) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		err := handler(c)
+		if fiberErr, ok := rateLimitResponse(c, err); ok {
+			return fiberErr
+		}
+		return err
+	}
+}
+
+// rateLimit takes a token for an action of who on a likeable type, and
+// returns a RateLimitError when none is left. A store failing lets the
+// action through rather than taking likes down with it.
+func (h *LikeHooks) rateLimit(ctx context.Context, who caller, action, likeableType string) error {
+	limit, ok := h.config.RateLimitFor(action, likeableType)
+	if !ok {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s:%s:%s", action, likeableType, h.rateLimitSubject(who))
+	wait, err := h.rateLimits.Take(ctx, key, limit)
+	if err != nil {
+		logger.Log.Error("likeable: taking a rate limit token", "error", err)
+		return nil
+	}
+	if wait > 0 {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// rateLimitSubject is who the buckets of a caller belong to.
+func (h *LikeHooks) rateLimitSubject(who caller) string {
+	switch {
+	case who.liker.UserID != "":
+		return "user:" + who.liker.UserID
+	case who.liker.AnonymousID != "" && h.config.RateLimitAnonymousBy == RateLimitByDevice:
+		return "device:" + who.liker.AnonymousID
+	default:
+		return "ip:" + who.ipAddress
+	}
+}
@@ -0,0 +1,128 @@
+package likeable
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	limit := RateLimit{Rate: 1, Per: 10 * time.Second, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if wait, err := store.Take(ctx, "user:1", limit); err != nil || wait != 0 {
+			t.Fatalf("take %d = %v, %v, want a token from the burst", i, wait, err)
+		}
+	}
+	if wait, _ := store.Take(ctx, "user:1", limit); wait != 10*time.Second {
+		t.Errorf("take past the burst = %v, want to wait 10s", wait)
+	}
+	if wait, _ := store.Take(ctx, "user:2", limit); wait != 0 {
+		t.Error("buckets should not be shared between keys")
+	}
+
+	now = now.Add(4 * time.Second)
+	if wait, _ := store.Take(ctx, "user:1", limit); wait != 6*time.Second {
+		t.Errorf("take while refilling = %v, want to wait 6s", wait)
+	}
+	now = now.Add(6 * time.Second)
+	if wait, _ := store.Take(ctx, "user:1", limit); wait != 0 {
+		t.Errorf("take once refilled = %v, want a token", wait)
+	}
+
+	now = now.Add(time.Hour)
+	store.Take(ctx, "user:3", limit)
+	if len(store.buckets) != 1 {
+		t.Errorf("store holds %d buckets, want the refilled ones dropped", len(store.buckets))
+	}
+}
+
+func TestRateLimitFor(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RateLimits[RateLimitLike] = RateLimit{Rate: 10, Per: time.Minute}
+	cfg.RateLimitsByType["comment"] = map[string]RateLimit{RateLimitUnlike: {Rate: 1, Per: time.Minute}}
+
+	if limit, ok := cfg.RateLimitFor(RateLimitLike, "comment"); !ok || limit.Rate != 10 {
+		t.Errorf("like on comment = %+v, %v, want the default limit", limit, ok)
+	}
+	if limit, ok := cfg.RateLimitFor(RateLimitUnlike, "comment"); !ok || limit.Rate != 1 {
+		t.Errorf("unlike on comment = %+v, %v, want the comment limit", limit, ok)
+	}
+	if _, ok := cfg.RateLimitFor(RateLimitUnlike, "post"); ok {
+		t.Error("unlike on post should not be limited")
+	}
+}
+
+func TestRateLimitSubject(t *testing.T) {
+	cfg := DefaultConfig()
+	hooks := NewLikeHooks(nil, &cfg)
+	user := caller{liker: Liker{UserID: "user-1"}, ipAddress: "10.0.0.1"}
+	device := caller{liker: Liker{AnonymousID: "device-1"}, ipAddress: "10.0.0.1"}
+
+	if got := hooks.rateLimitSubject(user); got != "user:user-1" {
+		t.Errorf("user subject = %s", got)
+	}
+	if got := hooks.rateLimitSubject(device); got != "ip:10.0.0.1" {
+		t.Errorf("device subject = %s, want its IP address by default", got)
+	}
+	cfg.RateLimitAnonymousBy = RateLimitByDevice
+	if got := hooks.rateLimitSubject(device); got != "device:device-1" {
+		t.Errorf("device subject = %s, want its device", got)
+	}
+}
+
+func TestRateLimitedEndpoints(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AnonymousSecret = testAnonymousSecret
+	cfg.RateLimits[RateLimitLike] = RateLimit{Rate: 1, Per: time.Minute}
+	hooks := NewLikeHooks(newTestDB(t), &cfg)
+
+	app := fiber.New()
+	app.Use(anonymousMiddleware(NewDeviceTokens(cfg.AnonymousSecret), &cfg))
+	registerLikeRoutes(app, hooks)
+	_, token := NewDeviceTokens(testAnonymousSecret).Issue()
+
+	send := func(method, target string, body ...string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(strings.Join(body, "")))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(cfg.AnonymousHeaderName, token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+		return resp.StatusCode, resp.Header.Get("Retry-After")
+	}
+
+	if status, _ := send("PUT", "/likes/post/post-1"); status != fiber.StatusOK {
+		t.Fatalf("first like = %d, want 200", status)
+	}
+	if status, retryAfter := send("PUT", "/likes/post/post-2"); status != fiber.StatusTooManyRequests || retryAfter != "60" {
+		t.Errorf("second like = %d with Retry-After %q, want 429 after 60s", status, retryAfter)
+	}
+	if status, _ := send("DELETE", "/likes/post/post-1"); status != fiber.StatusOK {
+		t.Errorf("unlike = %d, want 200 since unlikes are not limited", status)
+	}
+	if status, _ := send("POST", "/likes/toggle", `{"likeable":"post","likeableId":"post-1"}`); status != fiber.StatusTooManyRequests {
+		t.Errorf("toggle = %d, want 429 since toggles count as likes", status)
+	}
+
+	// Deleting by id is limited before the like is looked up, so probing
+	// missing likes is limited too.
+	cfg.RateLimits[RateLimitUnlike] = RateLimit{Rate: 1, Per: time.Minute}
+	if status, _ := send("DELETE", "/likes/"+uuid.New().String()); status != fiber.StatusNotFound {
+		t.Errorf("first delete of a missing like = %d, want 404", status)
+	}
+	if status, _ := send("DELETE", "/likes/"+uuid.New().String()); status != fiber.StatusTooManyRequests {
+		t.Errorf("second delete of a missing like = %d, want 429", status)
+	}
+}
@@ -0,0 +1,251 @@
+package likeable
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+const defaultReconcileBatchSize = 500
+
+// ReconcileOptions controls a counter reconciliation run.
+type ReconcileOptions struct {
+	// Likeable restricts the run to one likeable type. Empty checks all.
+	Likeable string
+	// BatchSize is the number of counters checked, and repaired, per batch.
+	BatchSize int
+	// Repair rewrites drifted counters. Without it the run only reports.
+	Repair bool
+}
+
+// CountDiscrepancy is a counter that does not match the likes it counts.
+type CountDiscrepancy struct {
+	Likeable   string `json:"likeable"`
+	LikeableId string `json:"likeableId"`
+	Reaction   string `json:"reaction"`
+	Stored     int64  `json:"stored"`
+	Actual     int64  `json:"actual"`
+}
+
+// ReconcileReport summarizes a reconciliation run.
+type ReconcileReport struct {
+	Checked       int64              `json:"checked"`
+	Discrepancies []CountDiscrepancy `json:"discrepancies"`
+	Repaired      int64              `json:"repaired"`
+}
+
+// Reconcile recomputes the like_counts counters from the likes table and
+// reports the ones that drifted, repairing them when asked to. Counters are
+// walked in batches in key order, each batch being compared with a grouped
+// COUNT over its own objects only, and repaired in its own short transaction,
+// so the tables are never locked for the whole run. Repairs recompute the
+// count at write time, which absorbs likes made while the run is in progress.
+func (s *LikeService) Reconcile(ctx context.Context, opts ReconcileOptions) (ReconcileReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultReconcileBatchSize
+	}
+	report := ReconcileReport{Discrepancies: []CountDiscrepancy{}}
+
+	// Counters are checked against likes, then likes against counters to
+	// catch objects whose counter row is missing altogether.
+	for _, source := range []string{likeCountsTable, likesTable} {
+		var after *counterKey
+		for {
+			batch, err := s.reconcileBatch(ctx, source, opts, after)
+			if err != nil {
+				return report, err
+			}
+			if len(batch) == 0 {
+				break
+			}
+			last := batch[len(batch)-1].key
+			after = &last
+
+			drifted, err := s.compareBatch(ctx, source, batch)
+			if err != nil {
+				return report, err
+			}
+			// Likes whose counter exists were checked in the counters pass;
+			// the others all drifted, having no counter at all.
+			if source == likeCountsTable {
+				report.Checked += int64(len(batch))
+			} else {
+				report.Checked += int64(len(drifted))
+			}
+			report.Discrepancies = append(report.Discrepancies, drifted...)
+
+			if opts.Repair && len(drifted) > 0 {
+				if err := s.repairCounts(ctx, drifted); err != nil {
+					return report, err
+				}
+				report.Repaired += int64(len(drifted))
+			}
+			if len(batch) < opts.BatchSize {
+				break
+			}
+		}
+	}
+	return report, nil
+}
+
+type keyedCount struct {
+	key   counterKey
+	count int64
+}
+
+// reconcileBatch loads the next batch of counters from source, the counters
+// table or the likes table aggregated, in key order after the given key.
+func (s *LikeService) reconcileBatch(ctx context.Context, source string, opts ReconcileOptions, after *counterKey) ([]keyedCount, error) {
+	var sb *query.SelectBuilder
+	if source == likesTable {
+		sb = query.New(s.db.Dialect()).Select("likeable", "likeable_id", "reaction", "COUNT(*)").From(likesTable).Where(countedCondition())
+	} else {
+		sb = query.New(s.db.Dialect()).Select("likeable", "likeable_id", "reaction", "count").From(likeCountsTable)
+	}
+	if opts.Likeable != "" {
+		sb = sb.Where(query.Eq("likeable", opts.Likeable))
+	}
+	if after != nil {
+		sb = sb.Where(query.Or(
+			query.Gt("likeable", after.likeable),
+			query.And(query.Eq("likeable", after.likeable), query.Gt("likeable_id", after.likeableID)),
+			query.And(query.Eq("likeable", after.likeable), query.Eq("likeable_id", after.likeableID), query.Gt("reaction", after.reaction)),
+		))
+	}
+	if source == likesTable {
+		sb = sb.GroupBy("likeable", "likeable_id", "reaction")
+	}
+
+	q, args, err := sb.OrderBy("likeable", query.ASC).
+		OrderBy("likeable_id", query.ASC).
+		OrderBy("reaction", query.ASC).
+		Limit(opts.BatchSize).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("build reconcile query: %w", err)
+	}
+	return s.scanKeyedCounts(ctx, q, args)
+}
+
+// compareBatch looks up the other side of every counter in batch and returns
+// the ones that differ. Likes are compared with counters, counters with live
+// counts; a counter whose likes are all gone only shows up in the latter.
+func (s *LikeService) compareBatch(ctx context.Context, source string, batch []keyedCount) ([]CountDiscrepancy, error) {
+	byType := make(map[string][]string)
+	var types []string
+	for _, kc := range batch {
+		if _, ok := byType[kc.key.likeable]; !ok {
+			types = append(types, kc.key.likeable)
+		}
+		byType[kc.key.likeable] = append(byType[kc.key.likeable], kc.key.likeableID)
+	}
+
+	other := make(map[counterKey]int64)
+	for _, likeableType := range types {
+		var sb *query.SelectBuilder
+		if source == likesTable {
+			sb = query.New(s.db.Dialect()).Select("likeable", "likeable_id", "reaction", "count").From(likeCountsTable)
+		} else {
+			sb = query.New(s.db.Dialect()).Select("likeable", "likeable_id", "reaction", "COUNT(*)").From(likesTable).Where(countedCondition())
+		}
+		sb = sb.Where(query.Eq("likeable", likeableType)).
+			Where(query.In("likeable_id", toAnySlice(byType[likeableType])...))
+		if source != likesTable {
+			sb = sb.GroupBy("likeable", "likeable_id", "reaction")
+		}
+
+		q, args, err := sb.Build()
+		if err != nil {
+			return nil, fmt.Errorf("build reconcile query: %w", err)
+		}
+		counts, err := s.scanKeyedCounts(ctx, q, args)
+		if err != nil {
+			return nil, err
+		}
+		for _, kc := range counts {
+			other[kc.key] = kc.count
+		}
+	}
+
+	var drifted []CountDiscrepancy
+	for _, kc := range batch {
+		stored, actual := kc.count, other[kc.key]
+		if source == likesTable {
+			stored, actual = actual, kc.count
+			// Keys with a counter row were already compared in the
+			// counters pass, drifted or not.
+			if _, ok := other[kc.key]; ok {
+				continue
+			}
+		}
+		if stored != actual {
+			drifted = append(drifted, CountDiscrepancy{
+				Likeable:   kc.key.likeable,
+				LikeableId: kc.key.likeableID,
+				Reaction:   kc.key.reaction,
+				Stored:     stored,
+				Actual:     actual,
+			})
+		}
+	}
+	return drifted, nil
+}
+
+// repairCounts resets each drifted counter to the live count of its likes.
+func (s *LikeService) repairCounts(ctx context.Context, drifted []CountDiscrepancy) error {
+	return s.withTx(ctx, func(tx database.Database) error {
+		dialect := tx.Dialect()
+		count := dialect.QuoteIdentifier("count")
+		table := dialect.QuoteIdentifier(likeCountsTable)
+		likeable := dialect.QuoteIdentifier("likeable")
+		likeableID := dialect.QuoteIdentifier("likeable_id")
+		reaction := dialect.QuoteIdentifier("reaction")
+
+		q := fmt.Sprintf("UPDATE %s SET %s = (SELECT COUNT(*) FROM %s l WHERE l.%s = %s.%s AND l.%s = %s.%s AND l.%s = %s.%s AND l.%s IS NULL) WHERE %s = %s AND %s = %s AND %s = %s",
+			table, count, dialect.QuoteIdentifier(likesTable),
+			likeable, table, likeable,
+			likeableID, table, likeableID,
+			reaction, table, reaction,
+			dialect.QuoteIdentifier("shadow"),
+			likeable, dialect.Placeholder(1),
+			likeableID, dialect.Placeholder(2),
+			reaction, dialect.Placeholder(3),
+		)
+
+		repaired := make([]Like, len(drifted))
+		for i, d := range drifted {
+			repaired[i] = Like{Likeable: d.Likeable, LikeableId: d.LikeableId, Reaction: d.Reaction}
+		}
+		s.invalidate(ctx, tx, repaired)
+
+		for _, d := range drifted {
+			if err := s.ensureCounter(ctx, tx, counterKey{d.Likeable, d.LikeableId, d.Reaction}); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, q, d.Likeable, d.LikeableId, d.Reaction); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *LikeService) scanKeyedCounts(ctx context.Context, q string, args []any) ([]keyedCount, error) {
+	rows, err := s.db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []keyedCount
+	for rows.Next() {
+		var kc keyedCount
+		if err := rows.Scan(&kc.key.likeable, &kc.key.likeableID, &kc.key.reaction, &kc.count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, kc)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,88 @@
+package likeable
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	insertLike(t, db, ptr("user-1"), "post", "post-1")
+	insertLike(t, db, ptr("user-2"), "post", "post-1")
+	insertLike(t, db, ptr("user-1"), "post", "post-2")
+	insertLike(t, db, ptr("user-1"), "comment", "comment-1")
+
+	// Drift three ways: a wrong counter, a missing counter, and a counter
+	// left behind by likes deleted outside the service.
+	if _, err := db.Exec(ctx, "UPDATE like_counts SET count = 5 WHERE likeable_id = 'post-1'"); err != nil {
+		t.Fatalf("tamper counter: %v", err)
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM like_counts WHERE likeable_id = 'post-2'"); err != nil {
+		t.Fatalf("drop counter: %v", err)
+	}
+	if _, err := db.Exec(ctx, "DELETE FROM likes WHERE likeable_id = 'comment-1'"); err != nil {
+		t.Fatalf("drop likes: %v", err)
+	}
+
+	report, err := svc.Reconcile(ctx, ReconcileOptions{BatchSize: 1})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	want := map[string]CountDiscrepancy{
+		"post-1":    {Likeable: "post", LikeableId: "post-1", Reaction: "like", Stored: 5, Actual: 2},
+		"post-2":    {Likeable: "post", LikeableId: "post-2", Reaction: "like", Stored: 0, Actual: 1},
+		"comment-1": {Likeable: "comment", LikeableId: "comment-1", Reaction: "like", Stored: 1, Actual: 0},
+	}
+	if len(report.Discrepancies) != len(want) {
+		t.Fatalf("Discrepancies = %+v, want %d", report.Discrepancies, len(want))
+	}
+	for _, d := range report.Discrepancies {
+		if want[d.LikeableId] != d {
+			t.Errorf("discrepancy = %+v, want %+v", d, want[d.LikeableId])
+		}
+	}
+	if report.Checked != 3 {
+		t.Errorf("Checked = %d, want 3", report.Checked)
+	}
+	if report.Repaired != 0 {
+		t.Errorf("Repaired = %d without Repair", report.Repaired)
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 5 {
+		t.Errorf("report-only run changed a counter to %d", count.Total)
+	}
+
+	report, err = svc.Reconcile(ctx, ReconcileOptions{Likeable: "post", BatchSize: 1, Repair: true})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(report.Discrepancies) != 2 || report.Repaired != 2 {
+		t.Errorf("post repair run = %+v, want 2 repaired", report)
+	}
+
+	counts, err := svc.CountBatch(ctx, "post", []string{"post-1", "post-2"})
+	if err != nil {
+		t.Fatalf("CountBatch: %v", err)
+	}
+	if counts["post-1"].Total != 2 || counts["post-2"].Total != 1 {
+		t.Errorf("repaired counts = %+v", counts)
+	}
+
+	if _, err := svc.Reconcile(ctx, ReconcileOptions{Repair: true}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	report, err = svc.Reconcile(ctx, ReconcileOptions{})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("Discrepancies after repair = %+v", report.Discrepancies)
+	}
+}
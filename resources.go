@@ -1,36 +1,57 @@
 package likeable
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gofiber/fiber/v3"
 	auth "github.com/nicolasbonnici/gorest/auth"
 	"github.com/nicolasbonnici/gorest/crud"
 	"github.com/nicolasbonnici/gorest/database"
 	"github.com/nicolasbonnici/gorest/processor"
+	"github.com/nicolasbonnici/gorest/response"
 )
 
 type LikeResource struct {
-	processor processor.Processor[Like, LikeCreateDTO, LikeUpdateDTO, LikeResponseDTO]
-	service   *LikeService
+	processor    processor.Processor[Like, LikeCreateDTO, LikeUpdateDTO, LikeResponseDTO]
+	service      *LikeService
+	hooks        *LikeHooks
+	converter    *LikeConverter
+	errorHandler *LikeErrorHandler
+}
+
+// likeFieldMap maps the fields likes can be filtered and ordered on to their
+// columns.
+var likeFieldMap = map[string]string{
+	"id":         "id",
+	"likerId":    "liker_id",
+	"likedId":    "liked_id",
+	"likeableId": "likeable_id",
+	"likeable":   "likeable",
+	"reaction":   "reaction",
+	"ipAddress":  "ip_address",
+	"userAgent":  "user_agent",
+	"likedAt":    "liked_at",
+	"updatedAt":  "updated_at",
+	"createdAt":  "created_at",
 }
 
 func RegisterLikeRoutes(router fiber.Router, db database.Database, config *Config) {
-	likeCRUD := crud.New[Like](db)
-	hooks := NewLikeHooks(db, config)
-	converter := &LikeConverter{}
-	errorHandler := &LikeErrorHandler{}
+	registerLikeRoutes(router, NewLikeHooks(db, config))
+}
 
-	fieldMapping := map[string]string{
-		"id":         "id",
-		"likerId":    "liker_id",
-		"likedId":    "liked_id",
-		"likeableId": "likeable_id",
-		"likeable":   "likeable",
-		"ipAddress":  "ip_address",
-		"userAgent":  "user_agent",
-		"likedAt":    "liked_at",
-		"updatedAt":  "updated_at",
-		"createdAt":  "created_at",
-	}
+// registerLikeRoutes registers the like routes around hooks, whose service is
+// shared with the caller.
+func registerLikeRoutes(router fiber.Router, hooks *LikeHooks) {
+	db, config := hooks.db, hooks.config
+	likeCRUD := crud.NewWithHooks[Like](db, newLikeReadHooks())
+	converter := NewLikeConverter(config)
+	errorHandler := &LikeErrorHandler{}
 
 	proc := processor.New(processor.ProcessorConfig[Like, LikeCreateDTO, LikeUpdateDTO, LikeResponseDTO]{
 		DB:                 db,
@@ -38,33 +59,79 @@ func RegisterLikeRoutes(router fiber.Router, db database.Database, config *Confi
 		Converter:          converter,
 		PaginationLimit:    config.PaginationLimit,
 		PaginationMaxLimit: config.MaxPaginationLimit,
-		FieldMap:           fieldMapping,
-		AllowedFields:      []string{"id", "likerId", "likedId", "likeableId", "likeable", "ipAddress", "userAgent", "likedAt", "updatedAt", "createdAt"},
+		FieldMap:           likeFieldMap,
+		AllowedFields:      []string{"id", "likerId", "likedId", "likeableId", "likeable", "reaction", "ipAddress", "userAgent", "likedAt", "updatedAt", "createdAt"},
 		ErrorHandler:       errorHandler,
 	}).
-		WithCreateHook(hooks.CreateHook).
 		WithUpdateHook(hooks.UpdateHook).
-		WithDeleteHook(hooks.DeleteHook).
+		WithGetByIDHook(hooks.GetByIDHook).
 		WithGetAllHook(hooks.GetAllHook)
 
 	res := &LikeResource{
-		processor: proc,
-		service:   NewLikeService(db),
+		processor:    proc,
+		service:      hooks.service,
+		hooks:        hooks,
+		converter:    converter,
+		errorHandler: errorHandler,
 	}
 
 	router.Get("/likes", res.GetAll)
 	// Static routes are registered before the "/likes/:id" parameter route so
 	// they are not shadowed by it.
 	router.Get("/likes/count", res.Count)
+	router.Get("/likes/trending", res.Trending)
+	router.Get("/likes/histogram", res.Histogram)
+	router.Get("/likes/top", res.Top)
+	router.Get("/likes/me", res.Me)
+	router.Get("/likes/stream", res.Stream)
+	router.Get("/likes/socket", res.Socket)
+	router.Get("/likes/flags", res.Flags)
+	router.Get("/likes/shadow-bans", res.ShadowBans)
+	router.Post("/likes/shadow-bans", res.CreateShadowBan)
+	router.Delete("/likes/shadow-bans/:id", res.LiftShadowBan)
+	router.Post("/likes/bots/reload", res.ReloadBots)
 	router.Post("/likes/state", res.State)
+	router.Post("/likes/toggle", rateLimited(res.Toggle))
+	router.Post("/likes/claim", res.Claim)
+	router.Get("/likes/users/:userId/data", res.ExportUserData)
+	router.Delete("/likes/users/:userId/data", res.EraseUserData)
 	router.Get("/likes/:id", res.GetByID)
 	router.Post("/likes", res.Create)
+	router.Delete("/likes", rateLimited(res.Unlike))
 	router.Put("/likes/:id", res.Update)
 	router.Delete("/likes/:id", res.Delete)
+	router.Put("/likes/:likeable/:likeableId", rateLimited(res.Set))
+	router.Delete("/likes/:likeable/:likeableId", rateLimited(res.Remove))
 }
 
+// Create follows the processor flow, but writes through the service so the
+// like and its counter are stored in one transaction. The processor cannot do
+// this from its hooks: its create hook runs before the insert, which its CRUD
+// then makes on its own connection outside any transaction, and nothing runs
+// after it. A counter bumped from there would drift whenever either write
+// failed.
 func (r *LikeResource) Create(c fiber.Ctx) error {
-	return r.processor.Create(c)
+	var dto LikeCreateDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return r.errorHandler.HandleError(c, err, "parse")
+	}
+
+	model := r.converter.CreateDTOToModel(dto)
+	if err := r.hooks.CreateHook(c, dto, &model); err != nil {
+		return r.errorHandler.HandleError(c, err, "hook")
+	}
+
+	ctx := auth.Context(c)
+	if err := r.service.Create(ctx, &model); err != nil {
+		return r.errorHandler.HandleError(c, err, "create")
+	}
+
+	if created, err := r.service.GetByID(ctx, model.Id); err == nil {
+		model = *created
+	}
+	r.hooks.afterLike(ctx, callerOf(c), &model)
+	viewer := CallerViewer(c, r.hooks.config)
+	return response.SendFormatted(c, fiber.StatusCreated, r.converter.ModelToResponseDTOFor(model, viewer))
 }
 
 func (r *LikeResource) GetByID(c fiber.Ctx) error {
@@ -79,8 +146,93 @@ func (r *LikeResource) Update(c fiber.Ctx) error {
 	return r.processor.Update(c)
 }
 
+// Delete follows the processor flow, but removes the like and decrements its
+// counter in one transaction, for the reasons given on Create. The
+// processor's delete would also not report whether a concurrent request
+// removed the like first, which the counter has to know.
 func (r *LikeResource) Delete(c fiber.Ctx) error {
-	return r.processor.Delete(c)
+	id := c.Params("id")
+	existing, err := r.hooks.deletable(c, id)
+	if err != nil {
+		return r.errorHandler.HandleError(c, err, "hook")
+	}
+
+	if err := r.service.Delete(auth.Context(c), id); err != nil {
+		return r.errorHandler.HandleError(c, err, "delete")
+	}
+	r.hooks.afterUnlike(auth.Context(c), callerOf(c), existing)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Unlike removes the caller's like on the target given by the "likeable" and
+// "likeableId" query parameters, so clients do not need to know like ids.
+func (r *LikeResource) Unlike(c fiber.Ctx) error {
+	likeableType := c.Query("likeable")
+	likeableID := c.Query("likeableId")
+	if err := r.hooks.UnlikeHook(c, likeableType, likeableID); err != nil {
+		return err
+	}
+
+	ctx, who := auth.Context(c), callerOf(c)
+	err := r.service.UnlikeByLiker(ctx, who.liker, likeableType, likeableID)
+	if errors.Is(err, ErrLikeNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+	if err != nil {
+		return err
+	}
+	r.hooks.afterUnlike(ctx, who, unlikeTarget(who.liker, likeableType, likeableID))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Claim reassigns the likes the caller made anonymously, before signing in,
+// to their account.
+func (r *LikeResource) Claim(c fiber.Ctx) error {
+	key, err := r.hooks.ClaimHook(c)
+	if err != nil {
+		return err
+	}
+
+	user := auth.GetAuthenticatedUser(c)
+	result, err := r.service.ClaimAnonymous(auth.Context(c), user.UserID, key)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(LikeClaimResponseDTO{Migrated: result.Migrated, Collapsed: result.Collapsed})
+}
+
+// ExportUserData returns everything stored about a user, for data subject
+// access requests. Admins only.
+func (r *LikeResource) ExportUserData(c fiber.Ctx) error {
+	if err := r.hooks.UserDataHook(c); err != nil {
+		return err
+	}
+
+	export, err := r.service.ExportUserData(auth.Context(c), c.Params("userId"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(export)
+}
+
+// EraseUserData erases the likes of a user, deleting or anonymizing the ones
+// they made as the "mode" query parameter, or erasure_mode, says. Admins only.
+func (r *LikeResource) EraseUserData(c fiber.Ctx) error {
+	if err := r.hooks.UserDataHook(c); err != nil {
+		return err
+	}
+
+	mode := c.Query("mode", r.hooks.config.ErasureMode)
+	if mode != ErasureDelete && mode != ErasureAnonymize {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("mode must be %q or %q", ErasureDelete, ErasureAnonymize))
+	}
+
+	result, err := r.service.EraseUserData(auth.Context(c), c.Params("userId"), mode)
+	if err != nil {
+		return err
+	}
+	return c.JSON(result)
 }
 
 func (r *LikeResource) Count(c fiber.Ctx) error {
@@ -96,23 +248,326 @@ func (r *LikeResource) Count(c fiber.Ctx) error {
 		return err
 	}
 
-	liked := false
-	if user := auth.GetAuthenticatedUser(c); user != nil {
-		states, err := r.service.LikedByBatch(ctx, user.UserID, likeableType, []string{likeableID})
-		if err != nil {
-			return err
-		}
-		liked = states[likeableID]
+	states, err := r.service.LikedByLikerBatch(ctx, CallerLiker(c), likeableType, []string{likeableID})
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(LikeCountResponseDTO{
 		Likeable:   likeableType,
 		LikeableId: likeableID,
-		Count:      count,
-		Liked:      liked,
+		Count:      count.Total,
+		Reactions:  count.Reactions,
+		Liked:      states[likeableID],
+	})
+}
+
+// Trending lists the objects of a likeable type ranked by like velocity over
+// the "window" query parameter, 24h by default.
+func (r *LikeResource) Trending(c fiber.Ctx) error {
+	likeableType := c.Query("likeable")
+	if likeableType == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "likeable is required")
+	}
+
+	windowParam := c.Query("window", "24h")
+	window, err := time.ParseDuration(windowParam)
+	if err != nil || window <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "window must be a positive duration such as 24h")
+	}
+	if window > r.hooks.config.TrendingMaxWindow {
+		return fiber.NewError(fiber.StatusBadRequest, "window exceeds the maximum of "+r.hooks.config.TrendingMaxWindow.String())
+	}
+
+	limit, err := r.queryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	items, err := r.service.Trending(auth.Context(c), TrendingOptions{
+		Likeable: likeableType,
+		Window:   window,
+		Limit:    limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(LikeTrendingResponseDTO{Likeable: likeableType, Window: windowParam, Items: items})
+}
+
+// Me lists what the authenticated user liked, newest first, optionally for a
+// single likeable type. Pages are chained with the returned "nextCursor".
+func (r *LikeResource) Me(c fiber.Ctx) error {
+	user := auth.GetAuthenticatedUser(c)
+	if user == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Authentication required")
+	}
+
+	limit, err := r.queryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := r.service.Liked(auth.Context(c), Liker{UserID: user.UserID}, LikedOptions{
+		Likeable: c.Query("likeable"),
+		Limit:    limit,
+		Cursor:   c.Query("cursor"),
+	})
+	if errors.Is(err, ErrInvalidCursor) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(LikeMeResponseDTO{Items: page.Items, NextCursor: page.NextCursor})
+}
+
+// Flags lists the likes fraud detection flagged, newest first, optionally
+// only those of a likeable type or action. Pages are chained with the returned
+// "nextCursor". Admins only.
+func (r *LikeResource) Flags(c fiber.Ctx) error {
+	if err := r.hooks.FlagsHook(c); err != nil {
+		return err
+	}
+
+	limit, err := r.queryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := r.service.Flags(auth.Context(c), FlagsOptions{
+		Likeable: c.Query("likeable"),
+		Action:   c.Query("action"),
+		Limit:    limit,
+		Cursor:   c.Query("cursor"),
+	})
+	if errors.Is(err, ErrInvalidCursor) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(LikeFlagsResponseDTO{Items: page.Items, NextCursor: page.NextCursor})
+}
+
+// ShadowBans lists the shadow-banned likers, newest ban first. Pages are
+// chained with the returned "nextCursor". Admins only.
+func (r *LikeResource) ShadowBans(c fiber.Ctx) error {
+	if err := r.hooks.ShadowBansHook(c); err != nil {
+		return err
+	}
+
+	limit, err := r.queryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := r.service.ShadowBans(auth.Context(c), ShadowBansOptions{Limit: limit, Cursor: c.Query("cursor")})
+	if errors.Is(err, ErrInvalidCursor) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(LikeShadowBansResponseDTO{Items: page.Items, NextCursor: page.NextCursor})
+}
+
+// CreateShadowBan shadow bans the account or anonymous device given in the
+// body. Admins only.
+func (r *LikeResource) CreateShadowBan(c fiber.Ctx) error {
+	if err := r.hooks.ShadowBansHook(c); err != nil {
+		return err
+	}
+
+	var dto LikeShadowBanCreateDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if (dto.LikerId == "") == (dto.AnonymousId == "") {
+		return fiber.NewError(fiber.StatusBadRequest, "either likerId or anonymousId is required")
+	}
+
+	liker := Liker{UserID: dto.LikerId}
+	if dto.LikerId == "" {
+		liker = Liker{AnonymousID: dto.AnonymousId}
+	}
+	ban, err := r.service.ShadowBan(auth.Context(c), liker, dto.Reason)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(ban)
+}
+
+// LiftShadowBan lifts a shadow ban, counting the likes of its liker again.
+// Admins only.
+func (r *LikeResource) LiftShadowBan(c fiber.Ctx) error {
+	if err := r.hooks.ShadowBansHook(c); err != nil {
+		return err
+	}
+
+	_, err := r.service.LiftShadowBan(auth.Context(c), c.Params("id"))
+	if errors.Is(err, ErrShadowBanNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ReloadBots reads the bot list again, including its file, and responds with
+// the number of rules now in place. Admins only.
+func (r *LikeResource) ReloadBots(c fiber.Ctx) error {
+	if err := r.hooks.BotsHook(c); err != nil {
+		return err
+	}
+
+	if err := r.hooks.bots.reload(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Bot list not reloaded: "+err.Error())
+	}
+	return c.JSON(r.hooks.bots.size())
+}
+
+// Top lists the most liked objects of a likeable type, all time or between
+// the "since" and "until" query parameters, optionally among the
+// comma-separated "likeableIds" candidates. Pages are chained with the
+// returned "nextCursor".
+func (r *LikeResource) Top(c fiber.Ctx) error {
+	likeableType := c.Query("likeable")
+	if likeableType == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "likeable is required")
+	}
+
+	opts := TopOptions{Likeable: likeableType, Cursor: c.Query("cursor")}
+	if ids := c.Query("likeableIds"); ids != "" {
+		opts.LikeableIds = strings.Split(ids, ",")
+	}
+
+	var err error
+	if raw := c.Query("since"); raw != "" {
+		if opts.Since, err = parseTimeQuery(raw, time.UTC); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "since must be an RFC 3339 timestamp or a date")
+		}
+	}
+	if raw := c.Query("until"); raw != "" {
+		if opts.Until, err = parseTimeQuery(raw, time.UTC); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "until must be an RFC 3339 timestamp or a date")
+		}
+	}
+
+	if opts.Limit, err = r.queryLimit(c); err != nil {
+		return err
+	}
+
+	page, err := r.service.Top(auth.Context(c), opts)
+	if errors.Is(err, ErrInvalidCursor) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(LikeTopResponseDTO{Likeable: likeableType, Items: page.Items, NextCursor: page.NextCursor})
+}
+
+// Histogram returns the likes received per interval by one object, or by
+// several at once when "likeableIds" lists them comma-separated. The range
+// defaults to the last 30 intervals and "from"/"to" accept RFC 3339
+// timestamps or dates, read in the "tz" time zone.
+func (r *LikeResource) Histogram(c fiber.Ctx) error {
+	likeableType := c.Query("likeable")
+	var likeableIDs []string
+	if ids := c.Query("likeableIds"); ids != "" {
+		likeableIDs = strings.Split(ids, ",")
+	} else if id := c.Query("likeableId"); id != "" {
+		likeableIDs = []string{id}
+	}
+	if likeableType == "" || len(likeableIDs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "likeable and likeableId or likeableIds are required")
+	}
+	if len(likeableIDs) > r.hooks.config.HistogramMaxObjects {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("likeableIds exceeds the maximum of %d", r.hooks.config.HistogramMaxObjects))
+	}
+
+	interval, err := ParseHistogramInterval(c.Query("interval", string(HistogramDay)))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	loc, err := time.LoadLocation(c.Query("tz", "UTC"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "tz must be an IANA time zone such as Europe/Paris")
+	}
+
+	to := time.Now().In(loc)
+	if raw := c.Query("to"); raw != "" {
+		if to, err = parseTimeQuery(raw, loc); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "to must be an RFC 3339 timestamp or a date")
+		}
+	}
+	from := interval.add(interval.truncate(to), 1-defaultHistogramBuckets)
+	if raw := c.Query("from"); raw != "" {
+		if from, err = parseTimeQuery(raw, loc); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "from must be an RFC 3339 timestamp or a date")
+		}
+	}
+	if !to.After(from) {
+		return fiber.NewError(fiber.StatusBadRequest, "to must be after from")
+	}
+
+	series, err := r.service.Histogram(auth.Context(c), HistogramOptions{
+		Likeable:    likeableType,
+		LikeableIds: likeableIDs,
+		Interval:    interval,
+		From:        from,
+		To:          to,
+		Location:    loc,
+	})
+	if errors.Is(err, ErrHistogramTooLarge) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("range exceeds the maximum of %d buckets", r.hooks.config.HistogramMaxBuckets))
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(LikeHistogramResponseDTO{
+		Likeable: likeableType,
+		Interval: interval,
+		From:     from,
+		To:       to,
+		Timezone: loc.String(),
+		Series:   series,
 	})
 }
 
+// parseTimeQuery reads a time query parameter given as an RFC 3339 timestamp
+// or as a date, the latter being taken at midnight in loc.
+func parseTimeQuery(raw string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, raw, loc)
+}
+
+// queryLimit reads the "limit" query parameter, bounded like list pagination.
+func (r *LikeResource) queryLimit(c fiber.Ctx) (int, error) {
+	config := r.hooks.config
+	raw := c.Query("limit")
+	if raw == "" {
+		return config.PaginationLimit, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "limit must be a positive integer")
+	}
+	return min(limit, config.MaxPaginationLimit), nil
+}
+
 func (r *LikeResource) State(c fiber.Ctx) error {
 	var req LikeStateRequestDTO
 	if err := c.Bind().Body(&req); err != nil {
@@ -122,25 +577,186 @@ func (r *LikeResource) State(c fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "likeable is required")
 	}
 
-	ctx := auth.Context(c)
-	counts, err := r.service.CountBatch(ctx, req.Likeable, req.LikeableIds)
+	states, err := r.states(auth.Context(c), CallerLiker(c), req.Likeable, req.LikeableIds)
+	if err != nil {
+		return err
+	}
+	return c.JSON(LikeStateResponseDTO{States: states})
+}
+
+// states returns the state of objects of a likeable type for liker.
+func (r *LikeResource) states(ctx context.Context, liker Liker, likeableType string, likeableIDs []string) (map[string]LikeStateDTO, error) {
+	counts, err := r.service.CountBatch(ctx, likeableType, likeableIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	liked, err := r.service.LikedByLikerBatch(ctx, liker, likeableType, likeableIDs)
 	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]LikeStateDTO, len(likeableIDs))
+	for _, id := range likeableIDs {
+		count := counts[id]
+		states[id] = LikeStateDTO{Count: count.Total, Reactions: count.Reactions, Liked: liked[id]}
+	}
+	return states, nil
+}
+
+// Stream pushes the state of the comma-separated "likeableIds" objects of
+// the "likeable" type as server-sent events: a "state" event with all of
+// them first, then one whenever likes on some of them change, and a
+// "heartbeat" event every stream_heartbeat.
+func (r *LikeResource) Stream(c fiber.Ctx) error {
+	likeableType := c.Query("likeable")
+	var likeableIDs []string
+	if ids := c.Query("likeableIds"); ids != "" {
+		likeableIDs = strings.Split(ids, ",")
+	}
+	if likeableType == "" || len(likeableIDs) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "likeable and likeableIds are required")
+	}
+
+	sub := r.hooks.hub.subscribe(r.hooks.config.StreamMaxTargets)
+	if err := sub.add(likeableType, likeableIDs...); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("likeableIds exceeds the maximum of %d", r.hooks.config.StreamMaxTargets))
+	}
+	// The stream outlives the request context, so the caller is resolved
+	// beforehand.
+	liker := CallerLiker(c)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		defer sub.close()
+		r.stream(w, sub, liker)
+	})
+}
+
+// Toggle likes the target for the caller when they do not hold the requested
+// reaction yet and unlikes it otherwise, then responds with the new state so
+// clients do not need a follow-up count request.
+func (r *LikeResource) Toggle(c fiber.Ctx) error {
+	var dto LikeCreateDTO
+	if err := c.Bind().Body(&dto); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	model := r.converter.CreateDTOToModel(dto)
+	if err := r.hooks.ToggleHook(c, dto, &model); err != nil {
 		return err
 	}
 
-	likerID := ""
-	if user := auth.GetAuthenticatedUser(c); user != nil {
-		likerID = user.UserID
+	ctx, who := auth.Context(c), callerOf(c)
+	if _, err := r.hooks.beforeToggle(ctx, who, &model); err != nil {
+		return err
 	}
-	liked, err := r.service.LikedByBatch(ctx, likerID, req.Likeable, req.LikeableIds)
+
+	liked, changed, err := r.service.toggle(ctx, &model)
 	if err != nil {
 		return err
 	}
+	switch {
+	case !changed:
+		// A concurrent request made the change the callbacks are told of.
+	case liked:
+		r.hooks.afterLike(ctx, who, &model)
+	default:
+		r.hooks.afterUnlike(ctx, who, &model)
+	}
+	return r.sendState(c, model.Likeable, model.LikeableId)
+}
 
-	states := make(map[string]LikeStateDTO, len(req.LikeableIds))
-	for _, id := range req.LikeableIds {
-		states[id] = LikeStateDTO{Count: counts[id], Liked: liked[id]}
+// Set idempotently likes the target addressed by the path. An optional JSON
+// body may carry the reaction and, for user likes, the liked user id.
+func (r *LikeResource) Set(c fiber.Ctx) error {
+	var dto LikeCreateDTO
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&dto); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
 	}
+	dto.Likeable = c.Params("likeable")
+	dto.LikeableId = c.Params("likeableId")
 
-	return c.JSON(LikeStateResponseDTO{States: states})
+	if err := r.like(auth.Context(c), callerOf(c), dto); err != nil {
+		return err
+	}
+	return r.sendState(c, dto.Likeable, dto.LikeableId)
+}
+
+// like idempotently likes the target of dto for who.
+func (r *LikeResource) like(ctx context.Context, who caller, dto LikeCreateDTO) error {
+	model := r.converter.CreateDTOToModel(dto)
+	if err := r.hooks.toggleHook(who, dto, &model); err != nil {
+		return err
+	}
+	if err := r.hooks.beforeLike(ctx, who, &model); err != nil {
+		return err
+	}
+
+	created, err := r.service.Like(ctx, &model)
+	if err != nil {
+		return err
+	}
+	if created {
+		r.hooks.afterLike(ctx, who, &model)
+	}
+	return nil
+}
+
+// Remove idempotently unlikes the target addressed by the path. The optional
+// "reaction" query parameter limits the removal to that reaction.
+func (r *LikeResource) Remove(c fiber.Ctx) error {
+	dto := LikeCreateDTO{
+		Likeable:   c.Params("likeable"),
+		LikeableId: c.Params("likeableId"),
+		Reaction:   c.Query("reaction"),
+	}
+
+	if err := r.unlike(auth.Context(c), callerOf(c), dto); err != nil {
+		return err
+	}
+	return r.sendState(c, dto.Likeable, dto.LikeableId)
+}
+
+// unlike idempotently removes the reaction of dto, or all reactions when it
+// has none, from the target of dto for who.
+func (r *LikeResource) unlike(ctx context.Context, who caller, dto LikeCreateDTO) error {
+	model := r.converter.CreateDTOToModel(dto)
+	if err := r.hooks.toggleHook(who, dto, &model); err != nil {
+		return err
+	}
+	// toggleHook fills in the default reaction; an absent one means all.
+	model.Reaction = dto.Reaction
+	if err := r.hooks.beforeUnlike(ctx, who, &model); err != nil {
+		return err
+	}
+
+	removed, err := r.service.Withdraw(ctx, &model)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		r.hooks.afterUnlike(ctx, who, &model)
+	}
+	return nil
+}
+
+func (r *LikeResource) sendState(c fiber.Ctx, likeableType, likeableID string) error {
+	ctx := auth.Context(c)
+	count, err := r.service.Count(ctx, likeableType, likeableID)
+	if err != nil {
+		return err
+	}
+
+	states, err := r.service.LikedByLikerBatch(ctx, CallerLiker(c), likeableType, []string{likeableID})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(LikeStateDTO{Count: count.Total, Reactions: count.Reactions, Liked: states[likeableID]})
 }
@@ -0,0 +1,205 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+const defaultRetentionBatchSize = 500
+
+// RetentionPolicy bounds how long likes keep tracking data, in days. Zero
+// keeps it forever.
+type RetentionPolicy struct {
+	// AnonymizeAfterDays clears the IP address and user agent of likes older
+	// than it. The likes themselves are kept and still counted. Anonymous
+	// likes without a device are told apart by nothing else, so their visitor
+	// can no longer withdraw them and may like the object again.
+	AnonymizeAfterDays int `json:"anonymize_after_days" yaml:"anonymize_after_days"`
+	// PurgeAnonymousAfterDays deletes anonymous likes older than it, counters
+	// included. Likes of authenticated users are never purged.
+	PurgeAnonymousAfterDays int `json:"purge_anonymous_after_days" yaml:"purge_anonymous_after_days"`
+}
+
+func (p RetentionPolicy) validate() error {
+	if p.AnonymizeAfterDays < 0 || p.PurgeAnonymousAfterDays < 0 {
+		return errors.New("retention days cannot be negative")
+	}
+	return nil
+}
+
+// RetentionOptions controls a retention run.
+type RetentionOptions struct {
+	// Likeable restricts the run to one likeable type. Empty applies the
+	// policies of all types.
+	Likeable string
+	// BatchSize is the number of likes anonymized, or purged, per statement.
+	BatchSize int
+	// Now is the time the age of likes is measured from. Defaults to the
+	// current time.
+	Now time.Time
+}
+
+// RetentionResult reports the likes affected by a retention run.
+type RetentionResult struct {
+	Anonymized int64 `json:"anonymized"`
+	Purged     int64 `json:"purged"`
+}
+
+// retentionScope is a set of likeable types sharing a retention policy.
+type retentionScope struct {
+	condition query.Condition
+	policy    RetentionPolicy
+}
+
+// ApplyRetention enforces the retention policies: anonymous likes past their
+// purge age are deleted, then the remaining likes past their anonymization age
+// lose their IP address and user agent. Both walk the likes in batches, each
+// written in its own short statement or transaction, so a run can be stopped
+// and resumed at any time.
+func (s *LikeService) ApplyRetention(ctx context.Context, opts RetentionOptions) (RetentionResult, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultRetentionBatchSize
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	var result RetentionResult
+	for _, scope := range s.retentionScopes(opts.Likeable) {
+		if days := scope.policy.PurgeAnonymousAfterDays; days > 0 {
+			purged, err := s.purgeAnonymous(ctx, scope.condition, retentionCutoff(opts.Now, days), opts.BatchSize)
+			result.Purged += purged
+			if err != nil {
+				return result, err
+			}
+		}
+		if days := scope.policy.AnonymizeAfterDays; days > 0 {
+			anonymized, err := s.anonymize(ctx, scope.condition, retentionCutoff(opts.Now, days), opts.BatchSize)
+			result.Anonymized += anonymized
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// retentionScopes splits the likes into the types with their own policy and
+// all the others, which follow the default one.
+func (s *LikeService) retentionScopes(likeableType string) []retentionScope {
+	if likeableType != "" {
+		return []retentionScope{{query.Eq("likeable", likeableType), s.config.RetentionPolicyFor(likeableType)}}
+	}
+
+	types := make([]string, 0, len(s.config.RetentionByType))
+	for t := range s.config.RetentionByType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	scopes := make([]retentionScope, 0, len(types)+1)
+	for _, t := range types {
+		scopes = append(scopes, retentionScope{query.Eq("likeable", t), s.config.RetentionByType[t]})
+	}
+	others := query.And()
+	if len(types) > 0 {
+		others = query.NotIn("likeable", toAnySlice(types)...)
+	}
+	return append(scopes, retentionScope{others, s.config.Retention})
+}
+
+func retentionCutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days).UTC()
+}
+
+// purgeAnonymous deletes the anonymous likes of scope made before cutoff.
+func (s *LikeService) purgeAnonymous(ctx context.Context, scope query.Condition, cutoff time.Time, batchSize int) (int64, error) {
+	var purged int64
+	for {
+		var n, removed int
+		err := s.withTx(ctx, func(tx database.Database) error {
+			page, err := crud.New[Like](tx).GetAllPaginated(ctx, crud.PaginationOptions{
+				Conditions: []query.Condition{scope, query.IsNull("liker_id"), query.Lt("liked_at", cutoff)},
+				Limit:      batchSize,
+			})
+			if err != nil {
+				return err
+			}
+			n = len(page.Items)
+			deleted, err := s.deleteLikes(ctx, tx, page.Items)
+			removed = len(deleted)
+			return err
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += int64(removed)
+		if n < batchSize {
+			return purged, nil
+		}
+	}
+}
+
+// anonymize clears the tracking data of the likes of scope made before cutoff.
+func (s *LikeService) anonymize(ctx context.Context, scope query.Condition, cutoff time.Time, batchSize int) (int64, error) {
+	var anonymized int64
+	for {
+		q, args, err := query.New(s.db.Dialect()).
+			Select("id").
+			From(likesTable).
+			Where(scope).
+			Where(query.Lt("liked_at", cutoff)).
+			Where(query.Or(query.IsNotNull("ip_address"), query.IsNotNull("user_agent"))).
+			Limit(batchSize).
+			Build()
+		if err != nil {
+			return anonymized, err
+		}
+		ids, err := s.scanIDs(ctx, q, args)
+		if err != nil || len(ids) == 0 {
+			return anonymized, err
+		}
+
+		q, args, err = query.New(s.db.Dialect()).
+			Update(likesTable).
+			Set("ip_address", nil).
+			Set("ip_network", nil).
+			Set("user_agent", nil).
+			Where(query.In("id", ids...)).
+			Build()
+		if err != nil {
+			return anonymized, err
+		}
+		if _, err := s.db.Exec(ctx, q, args...); err != nil {
+			return anonymized, err
+		}
+		anonymized += int64(len(ids))
+		if len(ids) < batchSize {
+			return anonymized, nil
+		}
+	}
+}
+
+func (s *LikeService) scanIDs(ctx context.Context, q string, args []any) ([]any, error) {
+	rows, err := s.db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []any
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
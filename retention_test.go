@@ -0,0 +1,94 @@
+package likeable
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestApplyRetention(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.AllowedTypes = []string{"post", "comment"}
+	cfg.Retention = RetentionPolicy{AnonymizeAfterDays: 30, PurgeAnonymousAfterDays: 90}
+	cfg.RetentionByType["comment"] = RetentionPolicy{AnonymizeAfterDays: 7}
+	svc := NewLikeService(db, WithConfig(&cfg))
+	ctx := context.Background()
+	now := time.Now()
+
+	likeAt := func(like *Like, likeableType string, age time.Duration) {
+		t.Helper()
+		like.Likeable = likeableType
+		like.LikedAt = now.Add(-age)
+		if _, err := svc.Like(ctx, like); err != nil {
+			t.Fatalf("Like: %v", err)
+		}
+	}
+	day := 24 * time.Hour
+	tracked := func(likerID, likeableID string) *Like {
+		like := newLike(likerID, likeableID, "like")
+		if likerID == "" {
+			like.LikerId = nil
+		}
+		like.IpAddress = ptr("203.0.113.7")
+		like.UserAgent = ptr(likeableID)
+		return like
+	}
+	device := func(likeableID string) *Like {
+		like := tracked("", likeableID)
+		like.AnonymousId = ptr("device-1")
+		return like
+	}
+
+	likeAt(tracked("", "post-old"), "post", 100*day)       // purged
+	likeAt(tracked("user-1", "post-old"), "post", 100*day) // anonymized, never purged
+	likeAt(device("post-month"), "post", 40*day)           // anonymized
+	likeAt(tracked("", "post-month"), "post", 40*day)      // anonymized, still counted
+	likeAt(tracked("", "post-new"), "post", day)           // kept
+	likeAt(device("comment-1"), "comment", 10*day)         // anonymized
+	likeAt(device("comment-2"), "comment", 200*day)        // anonymized, no purge for comments
+	likeAt(tracked("", "comment-3"), "comment", 10*day)    // anonymized, not purged before its purge age
+
+	result, err := svc.ApplyRetention(ctx, RetentionOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+	if result != (RetentionResult{Anonymized: 6, Purged: 1}) {
+		t.Errorf("ApplyRetention = %+v, want 6 anonymized and 1 purged", result)
+	}
+
+	count, err := svc.Count(ctx, "post", "post-old")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 {
+		t.Errorf("Count = %d, want the purged like uncounted", count.Total)
+	}
+	if count, err := svc.Count(ctx, "comment", "comment-3"); err != nil || count.Total != 1 {
+		t.Errorf("Count = %+v, %v, want the anonymized visitor like still counted", count, err)
+	}
+
+	var tracking int
+	if err := db.QueryRow(ctx, "SELECT COUNT(*) FROM likes WHERE ip_address IS NOT NULL OR user_agent IS NOT NULL").Scan(&tracking); err != nil {
+		t.Fatalf("count tracked likes: %v", err)
+	}
+	if tracking != 1 {
+		t.Errorf("%d likes keep tracking data, want only the recent one", tracking)
+	}
+
+	again, err := svc.ApplyRetention(ctx, RetentionOptions{})
+	if err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+	if again != (RetentionResult{}) {
+		t.Errorf("second run = %+v, want nothing left to do", again)
+	}
+
+	only, err := svc.ApplyRetention(ctx, RetentionOptions{Likeable: "post", Now: now.Add(2 * day)})
+	if err != nil {
+		t.Fatalf("ApplyRetention: %v", err)
+	}
+	if only != (RetentionResult{}) {
+		t.Errorf("run two days later = %+v, want the recent like kept", only)
+	}
+}
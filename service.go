@@ -4,89 +4,189 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/nicolasbonnici/gorest/crud"
 	"github.com/nicolasbonnici/gorest/database"
 	"github.com/nicolasbonnici/gorest/query"
+	"golang.org/x/sync/singleflight"
 )
 
 // LikeService exposes read-optimized access to like data. Counts and
 // membership are resolved by the database so callers never materialize
 // individual rows just to tally them, and list views resolve their whole
 // page of objects in a single round-trip instead of one query per item.
+// Writes that touch several rows run in a single transaction. Counts and
+// liked states can additionally be cached, see WithCache.
 type LikeService struct {
-	db   database.Database
-	crud *crud.CRUD[Like]
+	db     database.Database
+	crud   *crud.CRUD[Like]
+	config *Config
+
+	cache   Cache
+	flights singleflight.Group
+	stats   cacheStats
+	// generation is bumped by every cache invalidation, so loads that raced
+	// with one can tell their results may be stale.
+	generation atomic.Uint64
+
+	tracking *trackingHasher
+	hub      *streamHub
+}
+
+// LikeServiceOption customizes a LikeService built by NewLikeService.
+type LikeServiceOption func(*LikeService)
+
+// WithConfig makes the service follow the plugin configuration, such as the
+// reaction mode. Without it the service uses DefaultConfig.
+func WithConfig(config *Config) LikeServiceOption {
+	return func(s *LikeService) {
+		s.config = config
+	}
+}
+
+// WithCache serves Count, CountBatch and LikedByLikerBatch from cache, loading
+// only the objects it misses. Entries are invalidated when the service writes
+// likes, after the transaction commits, and concurrent misses on the same
+// objects share a single query.
+func WithCache(cache Cache) LikeServiceOption {
+	return func(s *LikeService) {
+		s.cache = cache
+	}
 }
 
-func NewLikeService(db database.Database) *LikeService {
-	return &LikeService{
-		db:   db,
-		crud: crud.New[Like](db),
+func NewLikeService(db database.Database, opts ...LikeServiceOption) *LikeService {
+	defaults := DefaultConfig()
+	s := &LikeService{
+		db:     db,
+		crud:   crud.New[Like](db),
+		config: &defaults,
+		hub:    newStreamHub(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.tracking = newTrackingHasher(s.config)
+	return s
 }
 
 func (s *LikeService) GetByID(ctx context.Context, id string) (*Like, error) {
 	return s.crud.GetByID(ctx, id)
 }
 
-// Count returns the number of likes for a single object using a COUNT
-// aggregate, which lets the database answer from the (likeable, likeable_id)
-// index without transferring any rows.
-func (s *LikeService) Count(ctx context.Context, likeableType, likeableID string) (int64, error) {
-	q, args, err := query.New(s.db.Dialect()).
-		Select("COUNT(*)").
-		From(likesTable).
-		Where(query.Eq("likeable", likeableType)).
-		Where(query.Eq("likeable_id", likeableID)).
-		Build()
-	if err != nil {
-		return 0, fmt.Errorf("build count query: %w", err)
+// LikeCount is the number of likes on a single object together with its
+// per-reaction breakdown. Total is always the sum of Reactions.
+type LikeCount struct {
+	Total     int64            `json:"total"`
+	Reactions map[string]int64 `json:"reactions"`
+}
+
+func newLikeCount() LikeCount {
+	return LikeCount{Reactions: map[string]int64{}}
+}
+
+func (lc *LikeCount) add(reaction string, count int64) {
+	lc.Reactions[reaction] += count
+	lc.Total += count
+}
+
+// clone copies the breakdown so cached counts are never shared with callers.
+func (lc LikeCount) clone() LikeCount {
+	out := newLikeCount()
+	for reaction, count := range lc.Reactions {
+		out.add(reaction, count)
 	}
+	return out
+}
 
-	var count int64
-	if err := s.db.QueryRow(ctx, q, args...).Scan(&count); err != nil {
-		return 0, err
+// Count returns the number of likes for a single object, per reaction. It
+// reads the like_counts counters, or aggregates the likes table with a COUNT
+// grouped by reaction when live counts are enabled; either way no individual
+// likes are transferred.
+func (s *LikeService) Count(ctx context.Context, likeableType, likeableID string) (LikeCount, error) {
+	counts, err := s.CountBatch(ctx, likeableType, []string{likeableID})
+	if err != nil {
+		return newLikeCount(), err
 	}
-	return count, nil
+	return counts[likeableID], nil
 }
 
-// CountBatch resolves like counts for a whole list of objects in one grouped
-// aggregate query, avoiding the N+1 pattern of counting each object
-// separately. Every requested id is present in the result; objects with no
-// likes map to zero.
-func (s *LikeService) CountBatch(ctx context.Context, likeableType string, likeableIDs []string) (map[string]int64, error) {
-	counts := make(map[string]int64, len(likeableIDs))
+// CountBatch resolves like counts for a whole list of objects in one query,
+// avoiding the N+1 pattern of counting each object separately. Every
+// requested id is present in the result; objects with no likes map to a zero
+// count.
+func (s *LikeService) CountBatch(ctx context.Context, likeableType string, likeableIDs []string) (map[string]LikeCount, error) {
+	if s.cache == nil {
+		return s.loadCounts(ctx, likeableType, likeableIDs)
+	}
+
+	counts := make(map[string]LikeCount, len(likeableIDs))
+	var missing []string
 	for _, id := range likeableIDs {
-		counts[id] = 0
+		if cached, ok := s.cache.Get(ctx, countCacheKey(likeableType, id)); ok {
+			if count, ok := cached.(LikeCount); ok {
+				counts[id] = count.clone()
+				continue
+			}
+		}
+		missing = append(missing, id)
 	}
-	if len(likeableIDs) == 0 {
+	s.stats.hits.Add(uint64(len(likeableIDs) - len(missing)))
+	if len(missing) == 0 {
 		return counts, nil
 	}
+	s.stats.misses.Add(uint64(len(missing)))
 
-	q, args, err := query.New(s.db.Dialect()).
-		Select("likeable_id", "COUNT(*)").
-		From(likesTable).
-		Where(query.Eq("likeable", likeableType)).
-		Where(query.In("likeable_id", toAnySlice(likeableIDs)...)).
-		GroupBy("likeable_id").
-		Build()
+	gen := s.generation.Load()
+	loaded, err := s.sharedLoad(flightKey(fmt.Sprintf("count:%d:%s", gen, likeableType), missing), func() (any, error) {
+		// The load is shared with other callers, so it must not be cut
+		// short when the one that started it goes away.
+		ctx := context.WithoutCancel(ctx)
+		loaded, err := s.loadCounts(ctx, likeableType, missing)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(loaded))
+		for id, count := range loaded {
+			key := countCacheKey(likeableType, id)
+			s.cache.Set(ctx, key, count.clone())
+			keys = append(keys, key)
+		}
+		s.dropIfInvalidated(ctx, gen, keys)
+		return loaded, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("build batch count query: %w", err)
+		return nil, err
 	}
+	for id, count := range loaded.(map[string]LikeCount) {
+		counts[id] = count.clone()
+	}
+	return counts, nil
+}
 
-	rows, err := s.db.Query(ctx, q, args...)
+func (s *LikeService) loadCounts(ctx context.Context, likeableType string, likeableIDs []string) (map[string]LikeCount, error) {
+	counts := make(map[string]LikeCount, len(likeableIDs))
+	for _, id := range likeableIDs {
+		counts[id] = newLikeCount()
+	}
+	if len(likeableIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := s.countsFrom(ctx, likeableType, likeableIDs)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var id string
-		var count int64
-		if err := rows.Scan(&id, &count); err != nil {
+		var id, reaction string
+		var n int64
+		if err := rows.Scan(&id, &reaction, &n); err != nil {
 			return nil, err
 		}
+		count := counts[id]
+		count.add(reaction, n)
 		counts[id] = count
 	}
 	return counts, rows.Err()
@@ -97,11 +197,64 @@ func (s *LikeService) CountBatch(ctx context.Context, likeableType string, likea
 // object. Every requested id is present in the result; an empty likerID yields
 // an all-false map without touching the database.
 func (s *LikeService) LikedByBatch(ctx context.Context, likerID, likeableType string, likeableIDs []string) (map[string]bool, error) {
+	return s.LikedByLikerBatch(ctx, Liker{UserID: likerID}, likeableType, likeableIDs)
+}
+
+// LikedByLikerBatch is LikedByBatch for any liker, authenticated or
+// anonymous. A zero liker yields an all-false map.
+func (s *LikeService) LikedByLikerBatch(ctx context.Context, liker Liker, likeableType string, likeableIDs []string) (map[string]bool, error) {
+	if s.cache == nil || liker.IsZero() {
+		return s.loadLiked(ctx, liker, likeableType, likeableIDs)
+	}
+
+	liked := make(map[string]bool, len(likeableIDs))
+	var missing []string
+	for _, id := range likeableIDs {
+		if cached, ok := s.cache.Get(ctx, likedCacheKey(liker, likeableType, id)); ok {
+			if state, ok := cached.(bool); ok {
+				liked[id] = state
+				continue
+			}
+		}
+		missing = append(missing, id)
+	}
+	s.stats.hits.Add(uint64(len(likeableIDs) - len(missing)))
+	if len(missing) == 0 {
+		return liked, nil
+	}
+	s.stats.misses.Add(uint64(len(missing)))
+
+	gen := s.generation.Load()
+	loaded, err := s.sharedLoad(flightKey(fmt.Sprintf("%d:%s", gen, likedCacheKey(liker, likeableType, "")), missing), func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+		loaded, err := s.loadLiked(ctx, liker, likeableType, missing)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(loaded))
+		for id, state := range loaded {
+			key := likedCacheKey(liker, likeableType, id)
+			s.cache.Set(ctx, key, state)
+			keys = append(keys, key)
+		}
+		s.dropIfInvalidated(ctx, gen, keys)
+		return loaded, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for id, state := range loaded.(map[string]bool) {
+		liked[id] = state
+	}
+	return liked, nil
+}
+
+func (s *LikeService) loadLiked(ctx context.Context, liker Liker, likeableType string, likeableIDs []string) (map[string]bool, error) {
 	liked := make(map[string]bool, len(likeableIDs))
 	for _, id := range likeableIDs {
 		liked[id] = false
 	}
-	if likerID == "" || len(likeableIDs) == 0 {
+	if liker.IsZero() || len(likeableIDs) == 0 {
 		return liked, nil
 	}
 
@@ -109,7 +262,7 @@ func (s *LikeService) LikedByBatch(ctx context.Context, likerID, likeableType st
 		Select("likeable_id").
 		Distinct().
 		From(likesTable).
-		Where(query.Eq("liker_id", likerID)).
+		Where(liker.condition()).
 		Where(query.Eq("likeable", likeableType)).
 		Where(query.In("likeable_id", toAnySlice(likeableIDs)...)).
 		Build()
@@ -133,8 +286,145 @@ func (s *LikeService) LikedByBatch(ctx context.Context, likerID, likeableType st
 	return liked, rows.Err()
 }
 
+// CacheStats returns the hit and miss counters of the cache set up with
+// WithCache. They stay at zero without a cache.
+func (s *LikeService) CacheStats() CacheStats {
+	return s.stats.snapshot()
+}
+
+// sharedLoad runs load once for all concurrent callers using the same key.
+func (s *LikeService) sharedLoad(key string, load func() (any, error)) (any, error) {
+	executed := false
+	v, err, _ := s.flights.Do(key, func() (any, error) {
+		executed = true
+		return load()
+	})
+	if !executed {
+		s.stats.shared.Add(1)
+	}
+	return v, err
+}
+
+// invalidate drops the cache entries made stale by writing likes, and tells
+// the stream subscribers watching their objects. Inside a transaction this
+// waits for the commit, so that readers cannot cache the state being replaced
+// in the meantime, nor be told of a write that is rolled back. Loads already
+// running may still have read that state; bumping the generation makes them
+// drop what they cache, see dropIfInvalidated, and keeps later readers from
+// joining them.
+func (s *LikeService) invalidate(ctx context.Context, db database.Database, likes []Like) {
+	if len(likes) == 0 {
+		return
+	}
+	var keys []string
+	targets := make([]likeTarget, len(likes))
+	for i, like := range likes {
+		if s.cache != nil {
+			keys = append(keys, likeCacheKeys(like)...)
+		}
+		targets[i] = likeTarget{like.Likeable, like.LikeableId}
+	}
+	afterCommit(db, func() {
+		if s.cache != nil {
+			s.generation.Add(1)
+			s.cache.Delete(ctx, keys...)
+		}
+		for _, target := range targets {
+			s.hub.publish(target.likeable, target.likeableID)
+		}
+	})
+}
+
+// dropIfInvalidated deletes keys, just cached by a load started at
+// generation gen, when an invalidation ran since. Checking after caching
+// rather than before leaves no window for an invalidation to slip in between.
+func (s *LikeService) dropIfInvalidated(ctx context.Context, gen uint64, keys []string) {
+	if s.generation.Load() != gen {
+		s.cache.Delete(ctx, keys...)
+	}
+}
+
+// HasLiked reports whether the author of like already reacted to the same
+// object, with any reaction. Authenticated likers are matched on liker_id,
+// anonymous ones on their device id, or on the IP address and user agent pair
+// when device tokens are disabled.
+func (s *LikeService) HasLiked(ctx context.Context, like *Like) (bool, error) {
+	q, args, err := query.New(s.db.Dialect()).
+		Select("id").
+		From(likesTable).
+		Where(likerCondition(like)).
+		Where(query.Eq("likeable", like.Likeable)).
+		Where(query.Eq("likeable_id", like.LikeableId)).
+		Limit(1).
+		Build()
+	if err != nil {
+		return false, fmt.Errorf("build has-liked query: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, q, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+func likerCondition(like *Like) query.Condition {
+	if like.LikerId != nil {
+		return query.Eq("liker_id", *like.LikerId)
+	}
+	if like.AnonymousId != nil {
+		return query.And(query.IsNull("liker_id"), query.Eq("anonymous_id", *like.AnonymousId))
+	}
+	ipAddress := nullableEq("ip_address", like.IpAddress)
+	if like.IpAddress != nil && len(like.ipAliases) > 0 {
+		ipAddress = query.In("ip_address", toAnySlice(append([]string{*like.IpAddress}, like.ipAliases...))...)
+	}
+	return query.And(
+		query.IsNull("liker_id"),
+		query.IsNull("anonymous_id"),
+		ipAddress,
+		nullableEq("user_agent", like.UserAgent),
+	)
+}
+
+// countedCondition leaves out shadow likes, which counts and rankings do not
+// include.
+func countedCondition() query.Condition {
+	return query.IsNull("shadow")
+}
+
+func nullableEq(column string, value *string) query.Condition {
+	if value == nil {
+		return query.IsNull(column)
+	}
+	return query.Eq(column, *value)
+}
+
+// deleteRows deletes the rows of table matching condition.
+func (s *LikeService) deleteRows(ctx context.Context, db database.Database, table string, condition query.Condition) error {
+	q, args, err := query.New(db.Dialect()).
+		Delete(table).
+		Where(condition).
+		Build()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, q, args...)
+	return err
+}
+
 var errInvalidIDType = errors.New("invalid ID type")
 
+// ErrLikeNotFound is returned when an operation targets a like that does not
+// exist.
+var ErrLikeNotFound = errors.New("like not found")
+
+// ErrAlreadyLiked is returned by Create when the liker already holds the
+// reaction, or any reaction in single reaction mode.
+var ErrAlreadyLiked = errors.New("already liked")
+
 var likesTable = Like{}.TableName()
 
 func toAnySlice(values []string) []any {
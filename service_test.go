@@ -37,15 +37,24 @@ func newTestDB(t *testing.T) database.Database {
 
 func insertLike(t *testing.T, db database.Database, likerID *string, likeableType, likeableID string) {
 	t.Helper()
+	insertReaction(t, db, likerID, likeableType, likeableID, "like")
+}
+
+func insertReaction(t *testing.T, db database.Database, likerID *string, likeableType, likeableID, reaction string) {
+	t.Helper()
 
 	like := Like{
 		Id:         uuid.New().String(),
 		LikerId:    likerID,
 		LikeableId: likeableID,
 		Likeable:   likeableType,
+		Reaction:   reaction,
 		LikedAt:    time.Now(),
 	}
-	if err := NewLikeService(db).crud.Create(context.Background(), like); err != nil {
+	// Fixtures may hold several reactions per liker, whatever the default mode.
+	config := DefaultConfig()
+	config.ReactionMode = ReactionModeMultiple
+	if err := NewLikeService(db, WithConfig(&config)).Create(context.Background(), &like); err != nil {
 		t.Fatalf("insert like: %v", err)
 	}
 }
@@ -65,16 +74,16 @@ func TestCount(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Count: %v", err)
 	}
-	if got != 2 {
-		t.Errorf("post-1 count = %d, want 2", got)
+	if got.Total != 2 {
+		t.Errorf("post-1 count = %d, want 2", got.Total)
 	}
 
 	got, err = svc.Count(ctx, "post", "missing")
 	if err != nil {
 		t.Fatalf("Count: %v", err)
 	}
-	if got != 0 {
-		t.Errorf("missing count = %d, want 0", got)
+	if got.Total != 0 {
+		t.Errorf("missing count = %d, want 0", got.Total)
 	}
 }
 
@@ -95,8 +104,8 @@ func TestCountBatch(t *testing.T) {
 
 	want := map[string]int64{"post-1": 2, "post-2": 1, "post-3": 0}
 	for id, w := range want {
-		if counts[id] != w {
-			t.Errorf("count[%s] = %d, want %d", id, counts[id], w)
+		if counts[id].Total != w {
+			t.Errorf("count[%s] = %d, want %d", id, counts[id].Total, w)
 		}
 	}
 	if len(counts) != len(want) {
@@ -104,6 +113,57 @@ func TestCountBatch(t *testing.T) {
 	}
 }
 
+func TestCountReactionBreakdown(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	insertReaction(t, db, ptr("user-1"), "post", "post-1", "like")
+	insertReaction(t, db, ptr("user-1"), "post", "post-1", "love")
+	insertReaction(t, db, ptr("user-2"), "post", "post-1", "love")
+	insertReaction(t, db, ptr("user-2"), "post", "post-2", "laugh")
+
+	got, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if got.Total != 3 || got.Reactions["like"] != 1 || got.Reactions["love"] != 2 {
+		t.Errorf("post-1 count = %+v, want total 3 with like=1 love=2", got)
+	}
+
+	counts, err := svc.CountBatch(ctx, "post", []string{"post-1", "post-2"})
+	if err != nil {
+		t.Fatalf("CountBatch: %v", err)
+	}
+	if counts["post-1"].Reactions["love"] != 2 || counts["post-2"].Reactions["laugh"] != 1 {
+		t.Errorf("unexpected batch breakdown: %+v", counts)
+	}
+}
+
+func TestHasLiked(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	insertReaction(t, db, ptr("user-1"), "post", "post-1", "love")
+
+	liked, err := svc.HasLiked(ctx, &Like{LikerId: ptr("user-1"), Likeable: "post", LikeableId: "post-1", Reaction: "like"})
+	if err != nil {
+		t.Fatalf("HasLiked: %v", err)
+	}
+	if !liked {
+		t.Error("any existing reaction should count as liked")
+	}
+
+	liked, err = svc.HasLiked(ctx, &Like{LikerId: ptr("user-2"), Likeable: "post", LikeableId: "post-1"})
+	if err != nil {
+		t.Fatalf("HasLiked: %v", err)
+	}
+	if liked {
+		t.Error("user-2 has not liked post-1")
+	}
+}
+
 func TestCountBatchEmpty(t *testing.T) {
 	db := newTestDB(t)
 	counts, err := NewLikeService(db).CountBatch(context.Background(), "post", nil)
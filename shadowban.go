@@ -0,0 +1,245 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// ShadowBanned is the Shadow of the likes of shadow-banned likers.
+const ShadowBanned = "banned"
+
+// ErrShadowBanNotFound is returned when lifting a shadow ban that does not
+// exist.
+var ErrShadowBanNotFound = errors.New("shadow ban not found")
+
+var errNoShadowBanLiker = errors.New("a shadow ban needs a liker")
+
+// ShadowBan shadow counts the likes of a liker, an account or an anonymous
+// device: they keep appearing to the liker as liked, but are left out of
+// counts, rankings and listings.
+type ShadowBan struct {
+	Id          string    `json:"id" db:"id"`
+	LikerId     *string   `json:"likerId,omitempty" db:"liker_id"`
+	AnonymousId *string   `json:"anonymousId,omitempty" db:"anonymous_id"`
+	Reason      *string   `json:"reason,omitempty" db:"reason"`
+	BannedAt    time.Time `json:"bannedAt" db:"banned_at"`
+}
+
+func (ShadowBan) TableName() string {
+	return "like_shadow_bans"
+}
+
+var shadowBansTable = ShadowBan{}.TableName()
+
+func (b ShadowBan) liker() Liker {
+	if b.LikerId != nil {
+		return Liker{UserID: *b.LikerId}
+	}
+	return Liker{AnonymousID: *b.AnonymousId}
+}
+
+// ShadowBan bans liker, shadowing the likes they made and the ones they will
+// make, and returns the ban. Banning a liker already banned returns their
+// ban, including when a concurrent call banned them first.
+func (s *LikeService) ShadowBan(ctx context.Context, liker Liker, reason string) (ShadowBan, error) {
+	if liker.IsZero() {
+		return ShadowBan{}, errNoShadowBanLiker
+	}
+
+	ban, err := s.shadowBan(ctx, liker, reason)
+	if err != nil && isUniqueViolation(err) {
+		// The ban that won is in place now.
+		return s.shadowBan(ctx, liker, reason)
+	}
+	return ban, err
+}
+
+func (s *LikeService) shadowBan(ctx context.Context, liker Liker, reason string) (ShadowBan, error) {
+	var ban ShadowBan
+	err := s.withTx(ctx, func(tx database.Database) error {
+		existing, err := s.shadowBanOf(ctx, tx, liker)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			ban = *existing
+		} else {
+			ban = ShadowBan{Id: uuid.New().String(), BannedAt: time.Now().UTC()}
+			if liker.UserID != "" {
+				ban.LikerId = &liker.UserID
+			} else {
+				ban.AnonymousId = &liker.AnonymousID
+			}
+			if reason != "" {
+				ban.Reason = &reason
+			}
+			if err := crud.New[ShadowBan](tx).Create(ctx, ban); err != nil {
+				return err
+			}
+		}
+
+		banned := ShadowBanned
+		return s.reshadow(ctx, tx, liker, nil, &banned)
+	})
+	return ban, err
+}
+
+// LiftShadowBan lifts the ban with the given id, counting the likes it
+// shadowed again, and returns it. Likes shadowed for another reason, such
+// as fraud, stay shadowed. It returns ErrShadowBanNotFound when there is no
+// such ban.
+func (s *LikeService) LiftShadowBan(ctx context.Context, id string) (ShadowBan, error) {
+	var ban ShadowBan
+	err := s.withTx(ctx, func(tx database.Database) error {
+		result, err := crud.New[ShadowBan](tx).GetAllPaginated(ctx, crud.PaginationOptions{
+			Conditions: []query.Condition{query.Eq("id", id)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(result.Items) == 0 {
+			return ErrShadowBanNotFound
+		}
+		ban = result.Items[0]
+
+		if err := s.deleteRows(ctx, tx, shadowBansTable, query.Eq("id", id)); err != nil {
+			return err
+		}
+		banned := ShadowBanned
+		return s.reshadow(ctx, tx, ban.liker(), &banned, nil)
+	})
+	return ban, err
+}
+
+// shadowBanOf returns the ban of liker, or nil when they are not banned.
+func (s *LikeService) shadowBanOf(ctx context.Context, db database.Database, liker Liker) (*ShadowBan, error) {
+	if liker.IsZero() {
+		return nil, nil
+	}
+
+	condition := query.Eq("anonymous_id", liker.AnonymousID)
+	if liker.UserID != "" {
+		condition = query.Eq("liker_id", liker.UserID)
+	}
+	result, err := crud.New[ShadowBan](db).GetAllPaginated(ctx, crud.PaginationOptions{
+		Conditions: []query.Condition{condition},
+		Limit:      1,
+	})
+	if err != nil || len(result.Items) == 0 {
+		return nil, err
+	}
+	return &result.Items[0], nil
+}
+
+// shadowLike shadows like when its liker is banned, unless it already is.
+func (s *LikeService) shadowLike(ctx context.Context, db database.Database, like *Like) error {
+	if like.Shadow != nil {
+		return nil
+	}
+
+	var liker Liker
+	if like.LikerId != nil {
+		liker.UserID = *like.LikerId
+	} else if like.AnonymousId != nil {
+		liker.AnonymousID = *like.AnonymousId
+	}
+	ban, err := s.shadowBanOf(ctx, db, liker)
+	if err != nil || ban == nil {
+		return err
+	}
+	banned := ShadowBanned
+	like.Shadow = &banned
+	return nil
+}
+
+// reshadow moves the likes of liker shadowed as from, nil meaning counted,
+// to to, keeping the counters in step.
+func (s *LikeService) reshadow(ctx context.Context, db database.Database, liker Liker, from, to *string) error {
+	result, err := crud.New[Like](db).GetAllPaginated(ctx, crud.PaginationOptions{
+		Conditions: []query.Condition{liker.condition(), nullableEq("shadow", from)},
+	})
+	if err != nil {
+		return err
+	}
+	likes := result.Items
+	if len(likes) == 0 {
+		return nil
+	}
+
+	ids := make([]any, len(likes))
+	for i, like := range likes {
+		ids[i] = like.Id
+	}
+	var shadow any
+	if to != nil {
+		shadow = *to
+	}
+	q, args, err := query.New(db.Dialect()).
+		Update(likesTable).
+		Set("shadow", shadow).
+		Where(query.In("id", ids...)).
+		Build()
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(ctx, q, args...); err != nil {
+		return err
+	}
+	s.invalidate(ctx, db, likes)
+
+	// Only one of the two adjustments applies, counters skipping shadow
+	// likes.
+	if err := s.adjustCounts(ctx, db, likes, -1); err != nil {
+		return err
+	}
+	for i := range likes {
+		likes[i].Shadow = to
+	}
+	return s.adjustCounts(ctx, db, likes, 1)
+}
+
+// ShadowBansOptions selects the bans listed by ShadowBans.
+type ShadowBansOptions struct {
+	Limit int
+	// Cursor resumes the listing after the page that returned it.
+	Cursor string
+}
+
+// ShadowBansPage is a page of bans. NextCursor is empty on the last page.
+type ShadowBansPage struct {
+	Items      []ShadowBan
+	NextCursor string
+}
+
+// ShadowBans lists the shadow bans, newest first, chained with a keyset
+// cursor on (banned_at, id) like Liked.
+func (s *LikeService) ShadowBans(ctx context.Context, opts ShadowBansOptions) (ShadowBansPage, error) {
+	if opts.Limit < 1 {
+		opts.Limit = s.config.PaginationLimit
+	}
+
+	items, next, err := keysetPage(opts.Cursor, "banned_at", opts.Limit,
+		func(conditions []query.Condition, limit int) ([]ShadowBan, error) {
+			result, err := crud.New[ShadowBan](s.db).GetAllPaginated(ctx, crud.PaginationOptions{
+				Limit:      limit,
+				Conditions: conditions,
+				OrderBy:    keysetOrder("banned_at"),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return result.Items, nil
+		},
+		func(ban ShadowBan) (time.Time, string) { return ban.BannedAt, ban.Id },
+	)
+	if err != nil {
+		return ShadowBansPage{}, err
+	}
+	return ShadowBansPage{Items: items, NextCursor: next}, nil
+}
@@ -0,0 +1,149 @@
+package likeable
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestShadowBan(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db, WithCache(NewLRUCache(100, time.Minute)))
+	ctx := context.Background()
+	banned := Liker{UserID: "user-1"}
+
+	fraud := newLike("user-1", "post-3", "like")
+	fraud.Shadow = ptr(ShadowFraud)
+	for _, like := range []*Like{newLike("user-1", "post-1", "like"), newLike("user-2", "post-1", "like"), newLike("user-2", "post-2", "like"), fraud} {
+		if err := svc.Create(ctx, like); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	// Warm the cache, which the ban has to invalidate.
+	if _, err := svc.Count(ctx, "post", "post-1"); err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+
+	ban, err := svc.ShadowBan(ctx, banned, "spam")
+	if err != nil {
+		t.Fatalf("ShadowBan: %v", err)
+	}
+	if again, err := svc.ShadowBan(ctx, banned, ""); err != nil || again.Id != ban.Id {
+		t.Errorf("banning twice = %+v, %v, want the first ban", again, err)
+	}
+	if _, err := svc.Like(ctx, newLike("user-1", "post-2", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+
+	counts, err := svc.CountBatch(ctx, "post", []string{"post-1", "post-2", "post-3"})
+	if err != nil {
+		t.Fatalf("CountBatch: %v", err)
+	}
+	if counts["post-1"].Total != 1 || counts["post-2"].Total != 1 || counts["post-3"].Total != 0 {
+		t.Errorf("counts while banned = %+v, want the banned likes left out", counts)
+	}
+	liked, err := svc.LikedByLikerBatch(ctx, banned, "post", []string{"post-1", "post-2"})
+	if err != nil || !liked["post-1"] || !liked["post-2"] {
+		t.Errorf("LikedByLikerBatch = %v, %v, want the banned liker to see their likes", liked, err)
+	}
+	trending, err := svc.Trending(ctx, TrendingOptions{Likeable: "post", Window: time.Hour})
+	if err != nil {
+		t.Fatalf("Trending: %v", err)
+	}
+	for _, item := range trending {
+		if item.Count != 1 {
+			t.Errorf("trending %s counts %d likes, want 1", item.LikeableId, item.Count)
+		}
+	}
+	if report, err := svc.Reconcile(ctx, ReconcileOptions{}); err != nil || len(report.Discrepancies) != 0 {
+		t.Errorf("Reconcile = %+v, %v, want counters in step", report, err)
+	}
+
+	page, err := svc.ShadowBans(ctx, ShadowBansOptions{})
+	if err != nil || len(page.Items) != 1 || *page.Items[0].Reason != "spam" {
+		t.Errorf("ShadowBans = %+v, %v", page, err)
+	}
+
+	if _, err := svc.LiftShadowBan(ctx, ban.Id); err != nil {
+		t.Fatalf("LiftShadowBan: %v", err)
+	}
+	if _, err := svc.LiftShadowBan(ctx, ban.Id); !errors.Is(err, ErrShadowBanNotFound) {
+		t.Errorf("lifting twice = %v, want ErrShadowBanNotFound", err)
+	}
+	counts, err = svc.CountBatch(ctx, "post", []string{"post-1", "post-2", "post-3"})
+	if err != nil {
+		t.Fatalf("CountBatch: %v", err)
+	}
+	if counts["post-1"].Total != 2 || counts["post-2"].Total != 2 || counts["post-3"].Total != 0 {
+		t.Errorf("counts once lifted = %+v, want the banned likes back and the fraud one still out", counts)
+	}
+}
+
+func TestShadowBanListings(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AnonymousSecret = testAnonymousSecret
+	hooks := NewLikeHooks(newTestDB(t), &cfg)
+	ctx := context.Background()
+
+	app := fiber.New()
+	app.Use(anonymousMiddleware(NewDeviceTokens(cfg.AnonymousSecret), &cfg))
+	registerLikeRoutes(app, hooks)
+	tokens := NewDeviceTokens(testAnonymousSecret)
+	bannedID, bannedToken := tokens.Issue()
+	_, otherToken := tokens.Issue()
+
+	bannedLike := newDeviceLike(bannedID, "post-1")
+	for _, like := range []*Like{bannedLike, newDeviceLike("device-2", "post-1")} {
+		if err := hooks.service.Create(ctx, like); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if _, err := hooks.service.ShadowBan(ctx, Liker{AnonymousID: bannedID}, ""); err != nil {
+		t.Fatalf("ShadowBan: %v", err)
+	}
+
+	listed := func(token string) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/likes?likeableId=post-1", nil)
+		req.Header.Set(cfg.AnonymousHeaderName, token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("GET /likes: %v", err)
+		}
+		var body struct {
+			Members []LikeResponseDTO `json:"hydra:member"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return len(body.Members)
+	}
+	if n := listed(otherToken); n != 1 {
+		t.Errorf("other caller lists %d likes, want the banned one hidden", n)
+	}
+	if n := listed(bannedToken); n != 2 {
+		t.Errorf("banned caller lists %d likes, want their own too", n)
+	}
+
+	fetched := func(token string) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/likes/"+bannedLike.Id, nil)
+		req.Header.Set(cfg.AnonymousHeaderName, token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("GET /likes/:id: %v", err)
+		}
+		return resp.StatusCode
+	}
+	if code := fetched(otherToken); code != fiber.StatusNotFound {
+		t.Errorf("other caller gets the shadow like with %d, want 404", code)
+	}
+	if code := fetched(bannedToken); code != fiber.StatusOK {
+		t.Errorf("banned caller gets their shadow like with %d, want 200", code)
+	}
+}
@@ -0,0 +1,244 @@
+package likeable
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nicolasbonnici/gorest/logger"
+)
+
+// Message types of the WebSocket protocol. Clients send the first five;
+// "state" is also what the server answers them and pushes with, and "error"
+// answers a message that failed.
+const (
+	socketSubscribe   = "subscribe"
+	socketUnsubscribe = "unsubscribe"
+	socketLike        = "like"
+	socketUnlike      = "unlike"
+	socketState       = "state"
+	socketError       = "error"
+)
+
+// maxSocketMessageSize bounds the messages clients send. A subscription to
+// StreamMaxTargets ids fits comfortably.
+const maxSocketMessageSize = 64 << 10
+
+// LikeSocketRequestDTO is a message sent by WebSocket clients. Id is echoed
+// in the reply, so clients can match them.
+type LikeSocketRequestDTO struct {
+	Type        string   `json:"type"`
+	Id          string   `json:"id,omitempty"`
+	Likeable    string   `json:"likeable"`
+	LikeableId  string   `json:"likeableId,omitempty"`
+	LikeableIds []string `json:"likeableIds,omitempty"`
+	Reaction    string   `json:"reaction,omitempty"`
+	LikedId     *string  `json:"likedId,omitempty"`
+}
+
+// LikeSocketMessageDTO is a message sent to WebSocket clients: the reply to
+// one of theirs, carrying its Id, or a state change of the objects they
+// subscribed to.
+type LikeSocketMessageDTO struct {
+	Type     string                  `json:"type"`
+	Id       string                  `json:"id,omitempty"`
+	Likeable string                  `json:"likeable,omitempty"`
+	States   map[string]LikeStateDTO `json:"states,omitempty"`
+	Status   int                     `json:"status,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+	// RetryAfter is the number of seconds to wait before retrying an action
+	// rejected by rate limits.
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+// likeSocket is a WebSocket connection of a caller.
+type likeSocket struct {
+	res  *LikeResource
+	conn *websocket.Conn
+	who  caller
+	sub  *subscription
+
+	// writeMu serializes writes, which replies and pushes both make.
+	writeMu sync.Mutex
+}
+
+// Socket upgrades the request to a WebSocket connection speaking a JSON
+// protocol: clients subscribe to and unsubscribe from the state of objects,
+// request their state, and like and unlike them, as the caller who opened
+// the connection.
+func (r *LikeResource) Socket(c fiber.Ctx) error {
+	if !websocket.FastHTTPIsWebSocketUpgrade(c.RequestCtx()) {
+		return fiber.NewError(fiber.StatusUpgradeRequired, "WebSocket upgrade required")
+	}
+
+	who := callerOf(c)
+	upgrader := websocket.FastHTTPUpgrader{}
+	// Failed upgrades are answered by the upgrader itself.
+	_ = upgrader.Upgrade(c.RequestCtx(), func(conn *websocket.Conn) {
+		s := &likeSocket{
+			res:  r,
+			conn: conn,
+			who:  who,
+			sub:  r.hooks.hub.subscribe(r.hooks.config.StreamMaxTargets),
+		}
+		s.serve()
+	})
+	return nil
+}
+
+// serve answers the messages of the client, and pushes it the changes of its
+// subscriptions, until the connection is closed.
+func (s *likeSocket) serve() {
+	defer s.conn.Close()
+	defer s.sub.close()
+
+	heartbeat := s.res.hooks.config.StreamHeartbeat
+	s.conn.SetReadLimit(maxSocketMessageSize)
+	_ = s.conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.push(done)
+
+	ctx := context.Background()
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = s.conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+
+		var req LikeSocketRequestDTO
+		if err := json.Unmarshal(data, &req); err != nil {
+			err = s.write(LikeSocketMessageDTO{Type: socketError, Status: fiber.StatusBadRequest, Error: "Invalid message"})
+		} else {
+			err = s.write(s.handle(ctx, req))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle runs a client message and returns the reply: the state of the
+// objects it is about, or the error it failed with.
+func (s *likeSocket) handle(ctx context.Context, req LikeSocketRequestDTO) LikeSocketMessageDTO {
+	ids := req.LikeableIds
+	if len(ids) == 0 && req.LikeableId != "" {
+		ids = []string{req.LikeableId}
+	}
+	if req.Likeable == "" || len(ids) == 0 {
+		return socketErrorMessage(req.Id, fiber.NewError(fiber.StatusBadRequest, "likeable and likeableId or likeableIds are required"))
+	}
+	if len(ids) > s.res.hooks.config.StreamMaxTargets {
+		return socketErrorMessage(req.Id, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("likeableIds exceeds the maximum of %d", s.res.hooks.config.StreamMaxTargets)))
+	}
+
+	var err error
+	switch req.Type {
+	case socketSubscribe:
+		if s.sub.add(req.Likeable, ids...) != nil {
+			err = fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("subscriptions exceed the maximum of %d", s.res.hooks.config.StreamMaxTargets))
+		}
+	case socketUnsubscribe:
+		s.sub.remove(req.Likeable, ids...)
+		return LikeSocketMessageDTO{Type: socketUnsubscribe, Id: req.Id, Likeable: req.Likeable}
+	case socketState:
+	case socketLike, socketUnlike:
+		if len(ids) != 1 {
+			return socketErrorMessage(req.Id, fiber.NewError(fiber.StatusBadRequest, "like and unlike take a single likeableId"))
+		}
+		dto := LikeCreateDTO{Likeable: req.Likeable, LikeableId: ids[0], Reaction: req.Reaction, LikedId: req.LikedId}
+		if req.Type == socketLike {
+			err = s.res.like(ctx, s.who, dto)
+		} else {
+			err = s.res.unlike(ctx, s.who, dto)
+		}
+	default:
+		err = fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unknown message type %q", req.Type))
+	}
+	if err != nil {
+		return socketErrorMessage(req.Id, err)
+	}
+
+	states, err := s.res.states(ctx, s.who.liker, req.Likeable, ids)
+	if err != nil {
+		return socketErrorMessage(req.Id, err)
+	}
+	return LikeSocketMessageDTO{Type: socketState, Id: req.Id, Likeable: req.Likeable, States: states}
+}
+
+// push sends the client the state of its subscriptions that changed, at
+// most once per SocketPushInterval: changes coming in the meantime are
+// coalesced into the next push. It also pings the client every
+// StreamHeartbeat, and stops on done.
+func (s *likeSocket) push(done <-chan struct{}) {
+	config := s.res.hooks.config
+	heartbeat := time.NewTicker(config.StreamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := context.Background()
+	var last time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case <-heartbeat.C:
+			if s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(config.StreamHeartbeat)) != nil {
+				return
+			}
+			continue
+		case <-s.sub.notify:
+		}
+
+		if wait := config.SocketPushInterval - time.Since(last); wait > 0 {
+			select {
+			case <-done:
+				return
+			case <-time.After(wait):
+			}
+		}
+		last = time.Now()
+
+		for likeableType, ids := range s.sub.take() {
+			states, err := s.res.states(ctx, s.who.liker, likeableType, ids)
+			if err != nil {
+				logger.Log.Error("likeable: pushing like states", "error", err)
+				continue
+			}
+			if s.write(LikeSocketMessageDTO{Type: socketState, Likeable: likeableType, States: states}) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *likeSocket) write(msg LikeSocketMessageDTO) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(s.res.hooks.config.StreamHeartbeat))
+	return s.conn.WriteJSON(msg)
+}
+
+// socketErrorMessage answers a client message with err, as the HTTP
+// endpoints would.
+func socketErrorMessage(id string, err error) LikeSocketMessageDTO {
+	var limited *RateLimitError
+	if errors.As(err, &limited) {
+		return LikeSocketMessageDTO{Type: socketError, Id: id, Status: fiber.StatusTooManyRequests, Error: limited.Error(), RetryAfter: limited.retryAfterSeconds()}
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return LikeSocketMessageDTO{Type: socketError, Id: id, Status: fiberErr.Code, Error: fiberErr.Message}
+	}
+	logger.Log.Error("likeable: handling socket message", "error", err)
+	return LikeSocketMessageDTO{Type: socketError, Id: id, Status: fiber.StatusInternalServerError, Error: "Internal Server Error"}
+}
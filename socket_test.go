@@ -0,0 +1,133 @@
+package likeable
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v3"
+)
+
+// newSocketServer serves the like routes, with anonymous device tokens, and
+// returns the URL of the WebSocket endpoint.
+func newSocketServer(t *testing.T, cfg *Config) (string, *LikeHooks) {
+	t.Helper()
+	cfg.AnonymousSecret = testAnonymousSecret
+	hooks := NewLikeHooks(newTestDB(t), cfg)
+
+	app := fiber.New()
+	app.Use(anonymousMiddleware(NewDeviceTokens(cfg.AnonymousSecret), cfg))
+	registerLikeRoutes(app, hooks)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	return "ws://" + ln.Addr().String() + "/likes/socket", hooks
+}
+
+func dialSocket(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	_, token := NewDeviceTokens(testAnonymousSecret).Issue()
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Likeable-Device": {token}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func roundTrip(t *testing.T, conn *websocket.Conn, req LikeSocketRequestDTO) LikeSocketMessageDTO {
+	t.Helper()
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for {
+		msg := readSocket(t, conn)
+		if msg.Id == req.Id {
+			return msg
+		}
+	}
+}
+
+func readSocket(t *testing.T, conn *websocket.Conn) LikeSocketMessageDTO {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg LikeSocketMessageDTO
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func TestSocket(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.StreamMaxTargets = 2
+	url, _ := newSocketServer(t, &cfg)
+	watcher, liker := dialSocket(t, url), dialSocket(t, url)
+
+	msg := roundTrip(t, watcher, LikeSocketRequestDTO{Type: socketSubscribe, Id: "1", Likeable: "post", LikeableIds: []string{"post-1", "post-2"}})
+	if msg.Type != socketState || len(msg.States) != 2 || msg.States["post-1"].Count != 0 {
+		t.Fatalf("subscribe reply = %+v", msg)
+	}
+	msg = roundTrip(t, watcher, LikeSocketRequestDTO{Type: socketSubscribe, Id: "2", Likeable: "post", LikeableId: "post-3"})
+	if msg.Type != socketError || msg.Status != fiber.StatusBadRequest {
+		t.Errorf("subscribing past the limit = %+v, want an error", msg)
+	}
+
+	msg = roundTrip(t, liker, LikeSocketRequestDTO{Type: socketLike, Id: "3", Likeable: "post", LikeableId: "post-1"})
+	if msg.Type != socketState || msg.States["post-1"].Count != 1 || !msg.States["post-1"].Liked {
+		t.Fatalf("like reply = %+v", msg)
+	}
+	msg = roundTrip(t, liker, LikeSocketRequestDTO{Type: socketLike, Id: "4", Likeable: "article", LikeableId: "post-1"})
+	if msg.Type != socketError || msg.Status != fiber.StatusBadRequest {
+		t.Errorf("liking a type not allowed = %+v, want an error", msg)
+	}
+
+	msg = readSocket(t, watcher)
+	if msg.Type != socketState || msg.Id != "" || msg.States["post-1"].Count != 1 || msg.States["post-1"].Liked {
+		t.Errorf("push = %+v, want post-1 liked once, not by the watcher", msg)
+	}
+
+	msg = roundTrip(t, watcher, LikeSocketRequestDTO{Type: socketUnsubscribe, Id: "5", Likeable: "post", LikeableIds: []string{"post-1"}})
+	if msg.Type != socketUnsubscribe {
+		t.Errorf("unsubscribe reply = %+v", msg)
+	}
+	roundTrip(t, liker, LikeSocketRequestDTO{Type: socketUnlike, Id: "6", Likeable: "post", LikeableId: "post-1"})
+	msg = roundTrip(t, watcher, LikeSocketRequestDTO{Type: socketState, Id: "7", Likeable: "post", LikeableId: "post-1"})
+	if msg.Type != socketState || msg.States["post-1"].Count != 0 {
+		t.Errorf("state reply = %+v, want post-1 unliked", msg)
+	}
+}
+
+func TestSocketCoalescesPushes(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SocketPushInterval = 200 * time.Millisecond
+	url, hooks := newSocketServer(t, &cfg)
+	watcher := dialSocket(t, url)
+	roundTrip(t, watcher, LikeSocketRequestDTO{Type: socketSubscribe, Id: "1", Likeable: "post", LikeableId: "post-1"})
+
+	for i := 0; i < 500; i++ {
+		hooks.hub.publish("post", "post-1")
+	}
+
+	// The first change is pushed right away, and the rest of the burst at
+	// most once more, after the push interval.
+	pushes := 0
+	_ = watcher.SetReadDeadline(time.Now().Add(3 * cfg.SocketPushInterval))
+	for {
+		var msg LikeSocketMessageDTO
+		if watcher.ReadJSON(&msg) != nil {
+			break
+		}
+		pushes++
+	}
+	if pushes < 1 || pushes > 2 {
+		t.Errorf("a burst of 500 changes made %d pushes, want 1 or 2", pushes)
+	}
+}
@@ -0,0 +1,209 @@
+package likeable
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nicolasbonnici/gorest/logger"
+)
+
+var errTooManyTargets = errors.New("too many watched objects")
+
+// streamHub fans the changes of like counts out to the subscriptions
+// watching them. The service publishes every write it commits, so the hub
+// only sees the likes written through this instance.
+type streamHub struct {
+	mu   sync.Mutex
+	subs map[likeTarget]map[*subscription]struct{}
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{subs: make(map[likeTarget]map[*subscription]struct{})}
+}
+
+// publish notifies the subscriptions watching an object that its likes
+// changed.
+func (h *streamHub) publish(likeableType, likeableID string) {
+	target := likeTarget{likeableType, likeableID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[target] {
+		sub.changed(target)
+	}
+}
+
+// subscribe returns a subscription watching up to limit objects.
+func (h *streamHub) subscribe(limit int) *subscription {
+	return &subscription{
+		hub:     h,
+		limit:   limit,
+		targets: make(map[likeTarget]struct{}),
+		pending: make(map[likeTarget]struct{}),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// subscription collects the changes of the objects one connection watches
+// until it takes them, so a burst of likes on an object is taken as one
+// change.
+type subscription struct {
+	hub   *streamHub
+	limit int
+
+	mu      sync.Mutex
+	targets map[likeTarget]struct{}
+	pending map[likeTarget]struct{}
+	notify  chan struct{}
+}
+
+// add starts watching objects of a likeable type. Either all of them are
+// watched, or none when that would exceed the limit.
+func (s *subscription) add(likeableType string, likeableIDs ...string) error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := 0
+	for _, id := range likeableIDs {
+		if _, ok := s.targets[likeTarget{likeableType, id}]; !ok {
+			added++
+		}
+	}
+	if len(s.targets)+added > s.limit {
+		return errTooManyTargets
+	}
+
+	for _, id := range likeableIDs {
+		target := likeTarget{likeableType, id}
+		s.targets[target] = struct{}{}
+		if s.hub.subs[target] == nil {
+			s.hub.subs[target] = make(map[*subscription]struct{})
+		}
+		s.hub.subs[target][s] = struct{}{}
+	}
+	return nil
+}
+
+// remove stops watching objects of a likeable type.
+func (s *subscription) remove(likeableType string, likeableIDs ...string) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range likeableIDs {
+		s.unwatch(likeTarget{likeableType, id})
+	}
+}
+
+// close stops watching every object.
+func (s *subscription) close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for target := range s.targets {
+		s.unwatch(target)
+	}
+}
+
+// unwatch must be called with both the hub and the subscription locked.
+func (s *subscription) unwatch(target likeTarget) {
+	delete(s.targets, target)
+	delete(s.pending, target)
+	delete(s.hub.subs[target], s)
+	if len(s.hub.subs[target]) == 0 {
+		delete(s.hub.subs, target)
+	}
+}
+
+func (s *subscription) changed(target likeTarget) {
+	s.mu.Lock()
+	s.pending[target] = struct{}{}
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the ids of the objects changed since the last call, by
+// likeable type.
+func (s *subscription) take() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := groupTargets(s.pending)
+	s.pending = make(map[likeTarget]struct{})
+	return changed
+}
+
+// watched returns the ids of the objects watched, by likeable type.
+func (s *subscription) watched() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return groupTargets(s.targets)
+}
+
+func groupTargets(targets map[likeTarget]struct{}) map[string][]string {
+	grouped := make(map[string][]string)
+	for target := range targets {
+		grouped[target.likeable] = append(grouped[target.likeable], target.likeableID)
+	}
+	return grouped
+}
+
+// stream writes the state of the objects sub watches as server-sent events:
+// all of them first, then those changing, and a heartbeat every
+// StreamHeartbeat. It returns once the client is gone.
+func (r *LikeResource) stream(w *bufio.Writer, sub *subscription, liker Liker) {
+	ctx := context.Background()
+	heartbeat := time.NewTicker(r.hooks.config.StreamHeartbeat)
+	defer heartbeat.Stop()
+
+	changed := sub.watched()
+	for {
+		for likeableType, ids := range changed {
+			states, err := r.states(ctx, liker, likeableType, ids)
+			if err != nil {
+				logger.Log.Error("likeable: streaming like states", "error", err)
+				return
+			}
+			if err := writeEvent(w, "state", LikeStreamEventDTO{Likeable: likeableType, States: states}); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-sub.notify:
+			changed = sub.take()
+		case now := <-heartbeat.C:
+			changed = nil
+			if err := writeEvent(w, "heartbeat", LikeHeartbeatDTO{Time: now.UTC()}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes a server-sent event and flushes it, which fails once the
+// client is gone.
+func writeEvent(w *bufio.Writer, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
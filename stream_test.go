@@ -0,0 +1,167 @@
+package likeable
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamHub(t *testing.T) {
+	hub := newStreamHub()
+	sub := hub.subscribe(3)
+
+	if err := sub.add("post", "post-1", "post-2"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := sub.add("post", "post-2", "post-3", "post-4"); err != errTooManyTargets {
+		t.Fatalf("add past the limit = %v, want errTooManyTargets", err)
+	}
+	if err := sub.add("comment", "post-1"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	hub.publish("post", "post-1")
+	hub.publish("post", "post-1")
+	hub.publish("comment", "post-1")
+	hub.publish("post", "post-3")
+
+	select {
+	case <-sub.notify:
+	default:
+		t.Fatal("a change should notify the subscription")
+	}
+	changed := sub.take()
+	if len(changed["post"]) != 1 || changed["post"][0] != "post-1" || len(changed["comment"]) != 1 {
+		t.Errorf("changed = %v, want post-1 once for each type", changed)
+	}
+	if changed := sub.take(); len(changed) != 0 {
+		t.Errorf("changes should be taken once, got %v", changed)
+	}
+
+	sub.remove("post", "post-1")
+	hub.publish("post", "post-1")
+	if changed := sub.take(); len(changed) != 0 {
+		t.Errorf("an object no longer watched changed: %v", changed)
+	}
+
+	sub.close()
+	if len(hub.subs) != 0 {
+		t.Errorf("hub still holds %d objects after close", len(hub.subs))
+	}
+}
+
+func TestServiceWritesReachTheHub(t *testing.T) {
+	svc := NewLikeService(newTestDB(t))
+	ctx := context.Background()
+	sub := svc.hub.subscribe(2)
+	if err := sub.add("post", "post-1", "post-2"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	like := newLike("user-1", "post-1", "like")
+	if err := svc.Create(ctx, like); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// A write rolled back is not announced.
+	if err := svc.Create(ctx, like); err == nil {
+		t.Fatal("Create with a duplicate id should fail")
+	}
+	if changed := sub.take(); len(changed["post"]) != 1 || changed["post"][0] != "post-1" {
+		t.Errorf("changed after Create = %v, want post-1", changed)
+	}
+
+	if _, err := svc.EraseUserData(ctx, "user-1", ErasureDelete); err != nil {
+		t.Fatalf("EraseUserData: %v", err)
+	}
+	if changed := sub.take(); len(changed["post"]) != 1 || changed["post"][0] != "post-1" {
+		t.Errorf("changed after EraseUserData = %v, want post-1", changed)
+	}
+}
+
+// readEvent reads the next server-sent event.
+func readEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	var event, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.StreamHeartbeat = 50 * time.Millisecond
+	hooks := NewLikeHooks(db, &cfg)
+	res := &LikeResource{service: hooks.service, hooks: hooks}
+	ctx := context.Background()
+
+	if _, err := hooks.service.Like(ctx, newLike("user-1", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+
+	sub := hooks.hub.subscribe(cfg.StreamMaxTargets)
+	if err := sub.add("post", "post-1", "post-2"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer sub.close()
+		res.stream(bufio.NewWriter(pw), sub, Liker{UserID: "user-2"})
+	}()
+	events := bufio.NewReader(pr)
+
+	var state LikeStreamEventDTO
+	event, data := readEvent(t, events)
+	if err := json.Unmarshal([]byte(data), &state); err != nil || event != "state" {
+		t.Fatalf("first event = %s %s, want the initial state", event, data)
+	}
+	if len(state.States) != 2 || state.States["post-1"].Count != 1 || state.States["post-1"].Liked {
+		t.Errorf("initial state = %+v", state)
+	}
+
+	if _, err := hooks.service.Like(ctx, newLike("user-2", "post-2", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	hooks.hub.publish("post", "post-2")
+	for event, data = readEvent(t, events); event == "heartbeat"; event, data = readEvent(t, events) {
+	}
+	state = LikeStreamEventDTO{}
+	if err := json.Unmarshal([]byte(data), &state); err != nil || event != "state" {
+		t.Fatalf("event = %s %s, want a state change", event, data)
+	}
+	if got := state.States["post-2"]; len(state.States) != 1 || got.Count != 1 || !got.Liked {
+		t.Errorf("change = %+v, want post-2 liked by the caller", state)
+	}
+
+	if event, _ := readEvent(t, events); event != "heartbeat" {
+		t.Errorf("idle stream sent %q, want a heartbeat", event)
+	}
+
+	pr.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream did not end once the client was gone")
+	}
+	if len(hooks.hub.subs) != 0 {
+		t.Error("the subscription should be closed with the stream")
+	}
+}
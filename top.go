@@ -0,0 +1,127 @@
+package likeable
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// TopOptions selects the objects ranked by Top.
+type TopOptions struct {
+	Likeable string
+	// Since (inclusive) and Until (exclusive) restrict the ranking to the
+	// likes given in between; zero values leave the range open.
+	Since time.Time
+	Until time.Time
+	// LikeableIds restricts the ranking to these candidates when not empty.
+	LikeableIds []string
+	Limit       int
+	// Cursor resumes the ranking after the page that returned it.
+	Cursor string
+}
+
+// TopItem is an object ranked by Top with its number of likes.
+type TopItem struct {
+	LikeableId string `json:"likeableId"`
+	Count      int64  `json:"count"`
+}
+
+// TopPage is a page of the Top ranking. NextCursor is empty on the last page.
+type TopPage struct {
+	Items      []TopItem
+	NextCursor string
+}
+
+// Top ranks the objects of a likeable type by number of likes, most liked
+// first and ties broken by id. Pages are chained with a keyset cursor on
+// (count, id), so likes arriving between two requests may move an object
+// across the page boundary but never make a page repeat the previous one.
+//
+// All-time rankings are read from the like_counts counters unless live counts
+// are enabled; ranges aggregate the likes table.
+func (s *LikeService) Top(ctx context.Context, opts TopOptions) (TopPage, error) {
+	if opts.Limit < 1 {
+		opts.Limit = s.config.PaginationLimit
+	}
+
+	dialect := s.db.Dialect()
+	qb := query.New(dialect)
+
+	var sb *query.SelectBuilder
+	var total string
+	if opts.Since.IsZero() && opts.Until.IsZero() && !s.config.LiveCounts {
+		total = "SUM(" + dialect.QuoteIdentifier("count") + ")"
+		sb = qb.Select("likeable_id").From(likeCountsTable)
+	} else {
+		total = "COUNT(*)"
+		sb = qb.Select("likeable_id").From(likesTable).Where(countedCondition())
+		if !opts.Since.IsZero() {
+			sb = sb.Where(query.Gte("liked_at", opts.Since.UTC()))
+		}
+		if !opts.Until.IsZero() {
+			sb = sb.Where(query.Lt("liked_at", opts.Until.UTC()))
+		}
+	}
+
+	sb = sb.SelectExpr(query.RawExpr(total)).
+		Where(query.Eq("likeable", opts.Likeable)).
+		GroupBy("likeable_id").
+		Having(query.Raw(total + " > 0"))
+	if len(opts.LikeableIds) > 0 {
+		sb = sb.Where(query.In("likeable_id", toAnySlice(opts.LikeableIds)...))
+	}
+
+	if opts.Cursor != "" {
+		values, err := decodeCursor(opts.Cursor, 2)
+		if err != nil {
+			return TopPage{}, err
+		}
+		count, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return TopPage{}, ErrInvalidCursor
+		}
+		sb = sb.Having(query.Raw(
+			fmt.Sprintf("(%s < ? OR (%s = ? AND %s > ?))", total, total, dialect.QuoteIdentifier("likeable_id")),
+			count, count, values[1],
+		))
+	}
+
+	// One extra row tells whether another page follows. The builder renders
+	// column orderings before expression ones, hence both being expressions.
+	q, args, err := sb.OrderByExpr(query.RawExpr(total), query.DESC).
+		OrderByExpr(query.Col("likeable_id"), query.ASC).
+		Limit(opts.Limit + 1).
+		Build()
+	if err != nil {
+		return TopPage{}, fmt.Errorf("build top query: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, q, args...)
+	if err != nil {
+		return TopPage{}, err
+	}
+	defer rows.Close()
+
+	items := make([]TopItem, 0, opts.Limit)
+	for rows.Next() {
+		var item TopItem
+		if err := rows.Scan(&item.LikeableId, &item.Count); err != nil {
+			return TopPage{}, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return TopPage{}, err
+	}
+
+	page := TopPage{Items: items}
+	if len(items) > opts.Limit {
+		page.Items = items[:opts.Limit]
+		last := page.Items[opts.Limit-1]
+		page.NextCursor = encodeCursor(strconv.FormatInt(last.Count, 10), last.LikeableId)
+	}
+	return page, nil
+}
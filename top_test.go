@@ -0,0 +1,89 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTop(t *testing.T) {
+	for _, live := range []bool{false, true} {
+		t.Run(fmt.Sprintf("live=%v", live), func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := DefaultConfig()
+			cfg.LiveCounts = live
+			svc := NewLikeService(db, WithConfig(&cfg))
+			ctx := context.Background()
+
+			likes := map[string]int{"post-a": 3, "post-b": 1, "post-c": 3, "post-d": 2}
+			for id, n := range likes {
+				for i := 0; i < n; i++ {
+					insertLike(t, db, ptr(fmt.Sprintf("user-%d", i)), "post", id)
+				}
+			}
+			insertLike(t, db, ptr("user-1"), "comment", "comment-1")
+
+			want := []TopItem{{"post-a", 3}, {"post-c", 3}, {"post-d", 2}, {"post-b", 1}}
+			var got []TopItem
+			opts := TopOptions{Likeable: "post", Limit: 3}
+			for pages := 0; ; pages++ {
+				if pages > len(want) {
+					t.Fatal("pagination does not terminate")
+				}
+				page, err := svc.Top(ctx, opts)
+				if err != nil {
+					t.Fatalf("Top: %v", err)
+				}
+				got = append(got, page.Items...)
+				if page.NextCursor == "" {
+					break
+				}
+				opts.Cursor = page.NextCursor
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("Top = %v, want %v", got, want)
+			}
+
+			page, err := svc.Top(ctx, TopOptions{Likeable: "post", LikeableIds: []string{"post-b", "post-d", "post-z"}, Limit: 10})
+			if err != nil {
+				t.Fatalf("Top: %v", err)
+			}
+			if fmt.Sprint(page.Items) != fmt.Sprint([]TopItem{{"post-d", 2}, {"post-b", 1}}) || page.NextCursor != "" {
+				t.Errorf("Top among candidates = %+v", page)
+			}
+
+			if _, err := svc.Top(ctx, TopOptions{Likeable: "post", Cursor: "not-a-cursor"}); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("Top with a bad cursor = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestTopRange(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		insertLikeAt(t, svc, fmt.Sprintf("user-%d", i), "post-old", now.Add(-60*24*time.Hour))
+	}
+	insertLikeAt(t, svc, "user-1", "post-new", now.Add(-time.Hour))
+
+	page, err := svc.Top(context.Background(), TopOptions{Likeable: "post", Since: now.Add(-30 * 24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Top: %v", err)
+	}
+	if fmt.Sprint(page.Items) != fmt.Sprint([]TopItem{{"post-new", 1}}) {
+		t.Errorf("Top this month = %v", page.Items)
+	}
+
+	page, err = svc.Top(context.Background(), TopOptions{Likeable: "post", Until: now.Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Top: %v", err)
+	}
+	if fmt.Sprint(page.Items) != fmt.Sprint([]TopItem{{"post-old", 3}}) {
+		t.Errorf("Top until yesterday = %v", page.Items)
+	}
+}
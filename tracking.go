@@ -0,0 +1,293 @@
+package likeable
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+const (
+	// TrackingRaw stores the IP address and user agent of likers as received.
+	TrackingRaw = "raw"
+	// TrackingHashed stores a keyed hash of the IP address and the family of
+	// the user agent instead, so neither can be traced back to a person.
+	TrackingHashed = "hashed"
+)
+
+// minTrackingPepperLength keeps hashed IP addresses out of brute-force reach:
+// the IPv4 space is small enough to enumerate without the pepper.
+const minTrackingPepperLength = 32
+
+// hashedIPPrefix marks IP addresses stored as "hmac:<pepper id>:<digest>".
+const hashedIPPrefix = "hmac:"
+
+// trackingHasher turns IP addresses and user agents into the values stored in
+// hashed tracking mode. IP addresses are hashed with the first pepper; the
+// others are retired peppers whose hashes are still matched, so rotating the
+// pepper does not break deduplication of likes made before the rotation.
+type trackingHasher struct {
+	peppers  [][]byte
+	ids      []string
+	truncate bool
+}
+
+// newTrackingHasher returns nil unless hashed tracking is configured.
+func newTrackingHasher(config *Config) *trackingHasher {
+	if config.TrackingMode != TrackingHashed {
+		return nil
+	}
+
+	t := &trackingHasher{truncate: config.TrackingTruncateIP}
+	for _, pepper := range config.TrackingPeppers {
+		sum := sha256.Sum256([]byte(pepper))
+		t.peppers = append(t.peppers, []byte(pepper))
+		t.ids = append(t.ids, hex.EncodeToString(sum[:4]))
+	}
+	return t
+}
+
+// hashIP returns the hash of ip under the current pepper, followed by its
+// hashes under the retired ones.
+func (t *trackingHasher) hashIP(ip string) []string {
+	if t.truncate {
+		ip = truncateIP(ip)
+	}
+
+	hashes := make([]string, len(t.peppers))
+	for i, pepper := range t.peppers {
+		mac := hmac.New(sha256.New, pepper)
+		mac.Write([]byte(ip))
+		hashes[i] = hashedIPPrefix + t.ids[i] + ":" + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	return hashes
+}
+
+// apply replaces the raw tracking values of like with their stored form.
+// Values already in stored form are kept, so likes converted halfway are
+// finished without hashing twice. It is a no-op in raw tracking mode.
+func (t *trackingHasher) apply(like *Like) {
+	if t == nil {
+		return
+	}
+	if like.IpAddress != nil && !strings.HasPrefix(*like.IpAddress, hashedIPPrefix) {
+		hashes := t.hashIP(*like.IpAddress)
+		like.IpAddress = &hashes[0]
+		like.ipAliases = hashes[1:]
+	}
+	if like.UserAgent != nil && !userAgentFamilies[*like.UserAgent] {
+		family := UserAgentFamily(*like.UserAgent)
+		like.UserAgent = &family
+	}
+}
+
+// truncateIP keeps the network part of an address: its /24 for IPv4 and its
+// /64 for IPv6. Unparsable values are returned unchanged.
+func truncateIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+
+	bits := 64
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+var (
+	// Order matters: Edge and Opera user agents also mention Chrome and
+	// Safari, and Chrome's mentions Safari.
+	browserFamilies = []struct{ token, family string }{
+		{"crawler", "Bot"},
+		{"spider", "Bot"},
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"opera", "Opera"},
+		{"firefox/", "Firefox"},
+		{"fxios/", "Firefox"},
+		{"chrome/", "Chrome"},
+		{"crios/", "Chrome"},
+		{"safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	// botName tells crawlers named after "bot", such as "Googlebot/2.1", from
+	// devices such as "CUBOT X30", as DefaultBotUserAgents does. It is
+	// checked before browserFamilies.
+	botName    = regexp.MustCompile(`\bbot\b|[a-z]bot[/;)-]`)
+	osFamilies = []struct{ token, family string }{
+		{"android", "Android"},
+		{"iphone", "iOS"},
+		{"ipad", "iOS"},
+		{"windows", "Windows"},
+		{"mac os x", "macOS"},
+		{"linux", "Linux"},
+	}
+)
+
+// userAgentFamilies holds every value UserAgentFamily returns.
+var userAgentFamilies = func() map[string]bool {
+	browsers := []string{"Other"}
+	for _, f := range browserFamilies {
+		browsers = append(browsers, f.family)
+	}
+	systems := []string{"Other"}
+	for _, f := range osFamilies {
+		systems = append(systems, f.family)
+	}
+
+	families := make(map[string]bool)
+	for _, browser := range browsers {
+		for _, system := range systems {
+			families[browser+"/"+system] = true
+		}
+	}
+	return families
+}()
+
+// UserAgentFamily reduces a user agent to its browser and operating system
+// families, such as "Firefox/Linux", dropping the versions and build details
+// that make user agents fingerprintable.
+func UserAgentFamily(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	browser, system := "Other", "Other"
+	if botName.MatchString(ua) {
+		browser = "Bot"
+	} else {
+		for _, f := range browserFamilies {
+			if strings.Contains(ua, f.token) {
+				browser = f.family
+				break
+			}
+		}
+	}
+	for _, f := range osFamilies {
+		if strings.Contains(ua, f.token) {
+			system = f.family
+			break
+		}
+	}
+	return browser + "/" + system
+}
+
+var errTrackingNotHashed = errors.New("tracking_mode is not hashed")
+
+// ConvertTrackingOptions tunes ConvertTracking.
+type ConvertTrackingOptions struct {
+	// BatchSize is the number of likes converted per transaction. Defaults
+	// to 500.
+	BatchSize int
+}
+
+// ConvertTrackingResult reports the outcome of ConvertTracking.
+type ConvertTrackingResult struct {
+	// Converted is the number of likes whose tracking values were hashed.
+	Converted int64 `json:"converted"`
+	// Collapsed is the number of anonymous likes deleted because, once
+	// hashed, they duplicated another like of the same visitor.
+	Collapsed int64 `json:"collapsed"`
+}
+
+// ConvertTracking hashes the IP addresses and user agents stored in raw form,
+// for deployments switching to hashed tracking. A like is converted when
+// either value is raw, including likes with only a user agent. Truncating IP
+// addresses may make likes of one visitor indistinguishable: only the first
+// of them is kept, the others being deleted with their counters updated.
+func (s *LikeService) ConvertTracking(ctx context.Context, opts ConvertTrackingOptions) (ConvertTrackingResult, error) {
+	var result ConvertTrackingResult
+	if s.tracking == nil {
+		return result, errTrackingNotHashed
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 500
+	}
+
+	families := make([]any, 0, len(userAgentFamilies))
+	for family := range userAgentFamilies {
+		families = append(families, family)
+	}
+	raw := query.Or(
+		query.And(query.IsNotNull("ip_address"), query.NotLike("ip_address", hashedIPPrefix+"%")),
+		query.And(query.IsNotNull("user_agent"), query.NotIn("user_agent", families...)),
+	)
+
+	for {
+		done := false
+		err := s.withTx(ctx, func(tx database.Database) error {
+			page, err := crud.New[Like](tx).GetAllPaginated(ctx, crud.PaginationOptions{
+				Conditions: []query.Condition{raw},
+				OrderBy:    []crud.OrderByClause{{Column: "liked_at", Direction: query.ASC}, {Column: "id", Direction: query.ASC}},
+				Limit:      opts.BatchSize,
+			})
+			if err != nil {
+				return err
+			}
+			done = len(page.Items) == 0
+
+			for _, like := range page.Items {
+				converted, err := s.convertTracking(ctx, tx, like)
+				if err != nil {
+					return err
+				}
+				if converted {
+					result.Converted++
+				} else {
+					result.Collapsed++
+				}
+			}
+			return nil
+		})
+		if err != nil || done {
+			return result, err
+		}
+	}
+}
+
+// convertTracking hashes the tracking values of like, or deletes it when an
+// anonymous like of the same visitor already holds them. It reports whether
+// like was kept.
+func (s *LikeService) convertTracking(ctx context.Context, db database.Database, like Like) (bool, error) {
+	hashed := like
+	s.tracking.apply(&hashed)
+
+	if hashed.LikerId == nil && hashed.AnonymousId == nil {
+		duplicates, err := s.heldReactions(ctx, db, &hashed)
+		if err != nil {
+			return false, err
+		}
+		for _, duplicate := range duplicates {
+			if duplicate.Reaction == like.Reaction && duplicate.Id != like.Id {
+				_, err := s.deleteLikes(ctx, db, []Like{like})
+				return false, err
+			}
+		}
+	}
+
+	q, args, err := query.New(db.Dialect()).
+		Update(likesTable).
+		Set("ip_address", hashed.IpAddress).
+		Set("ip_network", nil).
+		Set("user_agent", hashed.UserAgent).
+		Where(query.Eq("id", like.Id)).
+		Build()
+	if err != nil {
+		return false, err
+	}
+	_, err = db.Exec(ctx, q, args...)
+	return true, err
+}
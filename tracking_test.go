@@ -0,0 +1,195 @@
+package likeable
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const (
+	testPepper        = "0123456789abcdef0123456789abcdef"
+	testRotatedPepper = "fedcba9876543210fedcba9876543210"
+)
+
+func hashedConfig(truncate bool, peppers ...string) *Config {
+	cfg := DefaultConfig()
+	cfg.TrackingMode = TrackingHashed
+	cfg.TrackingPeppers = peppers
+	cfg.TrackingTruncateIP = truncate
+	return &cfg
+}
+
+func newVisitorLike(ip, userAgent, likeableID string) *Like {
+	like := newLike("", likeableID, "like")
+	like.LikerId = nil
+	like.IpAddress = ptr(ip)
+	like.UserAgent = ptr(userAgent)
+	return like
+}
+
+const firefoxLinux = "Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0"
+
+func TestTrackingHasher(t *testing.T) {
+	if newTrackingHasher(hashedConfig(false, testPepper)) == nil {
+		t.Fatal("hashed mode should build a hasher")
+	}
+	raw := DefaultConfig()
+	if newTrackingHasher(&raw) != nil {
+		t.Error("raw mode should not build a hasher")
+	}
+
+	rotated := newTrackingHasher(hashedConfig(false, testRotatedPepper, testPepper))
+	original := newTrackingHasher(hashedConfig(false, testPepper))
+	hashes := rotated.hashIP("203.0.113.7")
+	if len(hashes) != 2 || !strings.HasPrefix(hashes[0], hashedIPPrefix) {
+		t.Fatalf("hashIP = %v, want two prefixed hashes", hashes)
+	}
+	if hashes[1] != original.hashIP("203.0.113.7")[0] {
+		t.Error("the retired pepper should hash as it did before the rotation")
+	}
+	if hashes[0] == hashes[1] || hashes[0] == rotated.hashIP("203.0.113.8")[0] {
+		t.Error("hashes should differ per pepper and per address")
+	}
+
+	truncating := newTrackingHasher(hashedConfig(true, testPepper))
+	if truncating.hashIP("203.0.113.7")[0] != truncating.hashIP("203.0.113.200")[0] {
+		t.Error("addresses of one /24 should hash alike when truncating")
+	}
+
+	like := newVisitorLike("203.0.113.7", firefoxLinux, "post-1")
+	rotated.apply(like)
+	if *like.IpAddress != hashes[0] || len(like.ipAliases) != 1 || *like.UserAgent != "Firefox/Linux" {
+		t.Errorf("apply = %q %v %q", *like.IpAddress, like.ipAliases, *like.UserAgent)
+	}
+}
+
+func TestTruncateIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.7":          "203.0.113.0/24",
+		"::ffff:203.0.113.7":   "203.0.113.0/24",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1:2::/64",
+		"not-an-ip":            "not-an-ip",
+	}
+	for ip, want := range tests {
+		if got := truncateIP(ip); got != want {
+			t.Errorf("truncateIP(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestUserAgentFamily(t *testing.T) {
+	tests := map[string]string{
+		firefoxLinux: "Firefox/Linux",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36 Edg/130.0.0.0":           "Edge/Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Mobile/15E148 Safari/604.1": "Safari/iOS",
+		"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Mobile Safari/537.36":                            "Chrome/Android",
+		"Googlebot/2.1 (+http://www.google.com/bot.html)":                                                                         "Bot/Other",
+		"Mozilla/5.0 (Linux; Android 13; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Mobile Safari/537.36": "Chrome/Android",
+		"": "Other/Other",
+	}
+	for ua, want := range tests {
+		if got := UserAgentFamily(ua); got != want {
+			t.Errorf("UserAgentFamily(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestHashedLikesSurvivePepperRotation(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	before := NewLikeService(db, WithConfig(hashedConfig(false, testPepper)))
+	like := newVisitorLike("203.0.113.7", firefoxLinux, "post-1")
+	before.tracking.apply(like)
+	if _, err := before.Like(ctx, like); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+
+	after := NewLikeService(db, WithConfig(hashedConfig(false, testRotatedPepper, testPepper)))
+	probe := newVisitorLike("203.0.113.7", firefoxLinux, "post-1")
+	after.tracking.apply(probe)
+	liked, err := after.HasLiked(ctx, probe)
+	if err != nil {
+		t.Fatalf("HasLiked: %v", err)
+	}
+	if !liked {
+		t.Error("a like hashed with the retired pepper should still be found")
+	}
+
+	result, err := after.ClaimAnonymous(ctx, "user-1", AnonymousKey{IpAddress: "203.0.113.7", UserAgent: firefoxLinux})
+	if err != nil {
+		t.Fatalf("ClaimAnonymous: %v", err)
+	}
+	if result.Migrated != 1 {
+		t.Errorf("ClaimAnonymous = %+v, want the hashed like migrated", result)
+	}
+}
+
+func TestConvertTracking(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	uaOnly := newLike("user-2", "post-2", "like")
+	uaOnly.UserAgent = ptr(firefoxLinux)
+
+	raw := NewLikeService(db)
+	for _, like := range []*Like{
+		newVisitorLike("203.0.113.7", firefoxLinux, "post-1"),
+		// Same /24 and browser family: a duplicate once truncated and hashed.
+		newVisitorLike("203.0.113.8", strings.Replace(firefoxLinux, "131.0", "130.0", 2), "post-1"),
+		newVisitorLike("203.0.113.7", firefoxLinux, "post-2"),
+		newLike("user-1", "post-1", "like"),
+		uaOnly,
+	} {
+		if _, err := raw.Like(ctx, like); err != nil {
+			t.Fatalf("Like: %v", err)
+		}
+	}
+
+	if _, err := raw.ConvertTracking(ctx, ConvertTrackingOptions{}); err != errTrackingNotHashed {
+		t.Errorf("ConvertTracking in raw mode = %v, want errTrackingNotHashed", err)
+	}
+
+	svc := NewLikeService(db, WithConfig(hashedConfig(true, testPepper)))
+	result, err := svc.ConvertTracking(ctx, ConvertTrackingOptions{BatchSize: 1})
+	if err != nil {
+		t.Fatalf("ConvertTracking: %v", err)
+	}
+	if result.Converted != 3 || result.Collapsed != 1 {
+		t.Errorf("ConvertTracking = %+v, want 3 converted and 1 collapsed", result)
+	}
+
+	converted, err := svc.GetByID(ctx, uaOnly.Id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if converted.UserAgent == nil || *converted.UserAgent != "Firefox/Linux" {
+		t.Errorf("user agent of a like without IP address = %v, want Firefox/Linux", converted.UserAgent)
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 2 {
+		t.Errorf("Count = %d, want 2 after collapsing", count.Total)
+	}
+
+	probe := newVisitorLike("203.0.113.50", firefoxLinux, "post-2")
+	svc.tracking.apply(probe)
+	liked, err := svc.HasLiked(ctx, probe)
+	if err != nil {
+		t.Fatalf("HasLiked: %v", err)
+	}
+	if !liked {
+		t.Error("converted likes should match the hashed form of their visitor")
+	}
+
+	again, err := svc.ConvertTracking(ctx, ConvertTrackingOptions{})
+	if err != nil {
+		t.Fatalf("ConvertTracking: %v", err)
+	}
+	if again != (ConvertTrackingResult{}) {
+		t.Errorf("second conversion = %+v, want nothing to convert", again)
+	}
+}
@@ -0,0 +1,98 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nicolasbonnici/gorest/database"
+)
+
+// withTx runs fn inside a transaction, committing when it returns nil and
+// rolling back otherwise. fn receives the transaction wrapped as a
+// database.Database so the query builder and crud helpers work unchanged.
+func (s *LikeService) withTx(ctx context.Context, fn func(tx database.Database) error) error {
+	return runTx(ctx, s.db, fn)
+}
+
+// runTx is withTx for callers without a service, such as the dispatchers.
+func runTx(ctx context.Context, db database.Database, fn func(tx database.Database) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	txDB := &txDatabase{tx: tx, db: db}
+	if err := fn(txDB); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	for _, hook := range txDB.afterCommit {
+		hook()
+	}
+	return nil
+}
+
+// afterCommit runs hook once the transaction db belongs to has committed, or
+// right away when db is not a transaction.
+func afterCommit(db database.Database, hook func()) {
+	if txDB, ok := db.(*txDatabase); ok {
+		txDB.afterCommit = append(txDB.afterCommit, hook)
+		return
+	}
+	hook()
+}
+
+var errNestedTransaction = errors.New("nested transactions are not supported")
+
+// txDatabase exposes a database.Tx through the database.Database interface.
+type txDatabase struct {
+	tx database.Tx
+	db database.Database
+
+	afterCommit []func()
+}
+
+func (t *txDatabase) Connect(ctx context.Context, dsn string) error {
+	return errors.New("cannot connect using a transaction")
+}
+
+func (t *txDatabase) Close() error {
+	return errors.New("cannot close a transaction")
+}
+
+func (t *txDatabase) Ping(ctx context.Context) error {
+	return t.db.Ping(ctx)
+}
+
+func (t *txDatabase) Query(ctx context.Context, query string, args ...interface{}) (database.Rows, error) {
+	return t.tx.Query(ctx, query, args...)
+}
+
+func (t *txDatabase) QueryRow(ctx context.Context, query string, args ...interface{}) database.Row {
+	return t.tx.QueryRow(ctx, query, args...)
+}
+
+func (t *txDatabase) Exec(ctx context.Context, query string, args ...interface{}) (database.Result, error) {
+	return t.tx.Exec(ctx, query, args...)
+}
+
+func (t *txDatabase) Begin(ctx context.Context) (database.Tx, error) {
+	return nil, errNestedTransaction
+}
+
+func (t *txDatabase) Dialect() database.Dialect {
+	return t.db.Dialect()
+}
+
+func (t *txDatabase) DriverName() string {
+	return t.db.DriverName()
+}
+
+func (t *txDatabase) Introspector() database.SchemaIntrospector {
+	return t.db.Introspector()
+}
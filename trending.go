@@ -0,0 +1,110 @@
+package likeable
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// TrendingOptions selects the objects ranked by Trending.
+type TrendingOptions struct {
+	Likeable string
+	// Window is how far back likes are taken into account.
+	Window time.Duration
+	Limit  int
+}
+
+// TrendingItem is an object ranked by Trending, with its decayed score and
+// the raw number of likes it received within the window.
+type TrendingItem struct {
+	LikeableId string  `json:"likeableId"`
+	Score      float64 `json:"score"`
+	Count      int64   `json:"count"`
+}
+
+// Trending ranks the objects of a likeable type by like velocity. Every like
+// within the window contributes 1 / (age + offset) ^ gravity, its age being
+// measured in hours, so that recent likes weigh more than old ones, in the
+// spirit of the Hacker News ranking.
+//
+// The database counts the likes of each object per hour, so the rows read
+// grow with the objects and hours of the window rather than with its likes.
+// Likes are aged from the middle of their hour, which is within half an hour
+// of their own age.
+func (s *LikeService) Trending(ctx context.Context, opts TrendingOptions) ([]TrendingItem, error) {
+	now := time.Now()
+	bucket, bucketArgs, zone := s.bucketExpr(HistogramHour, time.UTC, now)
+
+	// Likes are stored in UTC, see insertLike, and SQLite compares them as
+	// text, so the bound has to be in UTC as well.
+	q, args, err := query.New(s.db.Dialect()).
+		Select("likeable_id").
+		SelectExpr(
+			query.As(query.RawExpr(bucket, bucketArgs...), "bucket"),
+			query.As(query.Count(query.Col("*")), "n"),
+		).
+		From(likesTable).
+		Where(query.Eq("likeable", opts.Likeable)).
+		Where(query.Gte("liked_at", now.Add(-opts.Window).UTC())).
+		Where(countedCondition()).
+		GroupBy("likeable_id", "bucket").
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("build trending query: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gravity, offset := s.config.TrendingGravity, s.config.TrendingOffset.Hours()
+	ranked := make(map[string]*TrendingItem)
+	for rows.Next() {
+		var id, wallClock string
+		var n int64
+		if err := rows.Scan(&id, &wallClock, &n); err != nil {
+			return nil, err
+		}
+		start, err := time.ParseInLocation(bucketLayout, wallClock, zone)
+		if err != nil {
+			return nil, fmt.Errorf("parse trending bucket %q: %w", wallClock, err)
+		}
+
+		item, ok := ranked[id]
+		if !ok {
+			item = &TrendingItem{LikeableId: id}
+			ranked[id] = item
+		}
+		age := math.Max(now.Sub(start.Add(30*time.Minute)).Hours(), 0)
+		item.Score += float64(n) / math.Pow(age+offset, gravity)
+		item.Count += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	items := make([]TrendingItem, 0, len(ranked))
+	for _, item := range ranked {
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Score != items[j].Score {
+			return items[i].Score > items[j].Score
+		}
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].LikeableId < items[j].LikeableId
+	})
+
+	if opts.Limit > 0 && len(items) > opts.Limit {
+		items = items[:opts.Limit]
+	}
+	return items, nil
+}
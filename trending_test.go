@@ -0,0 +1,85 @@
+package likeable
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func insertLikeAt(t *testing.T, svc *LikeService, likerID, likeableID string, likedAt time.Time) {
+	t.Helper()
+
+	like := newLike(likerID, likeableID, "like")
+	like.LikedAt = likedAt
+	if err := svc.Create(context.Background(), like); err != nil {
+		t.Fatalf("insert like: %v", err)
+	}
+}
+
+func TestTrending(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+	now := time.Now()
+
+	// post-1 has the most likes but they are old, post-2 fewer but fresh.
+	for i := 0; i < 4; i++ {
+		insertLikeAt(t, svc, fmt.Sprintf("user-%d", i), "post-1", now.Add(-20*time.Hour))
+	}
+	for i := 0; i < 2; i++ {
+		insertLikeAt(t, svc, fmt.Sprintf("user-%d", i), "post-2", now.Add(-10*time.Minute))
+	}
+	insertLikeAt(t, svc, "user-1", "post-3", now.Add(-5*time.Hour))
+	// Outside the window.
+	insertLikeAt(t, svc, "user-1", "post-4", now.Add(-48*time.Hour))
+	insertLikeAt(t, svc, "user-2", "post-4", now.Add(-48*time.Hour))
+
+	items, err := svc.Trending(ctx, TrendingOptions{Likeable: "post", Window: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Trending: %v", err)
+	}
+
+	want := []struct {
+		id    string
+		count int64
+	}{{"post-2", 2}, {"post-3", 1}, {"post-1", 4}}
+	if len(items) != len(want) {
+		t.Fatalf("Trending = %+v, want %d items", items, len(want))
+	}
+	for i, w := range want {
+		if items[i].LikeableId != w.id || items[i].Count != w.count {
+			t.Errorf("items[%d] = %+v, want %s with %d likes", i, items[i], w.id, w.count)
+		}
+	}
+
+	items, err = svc.Trending(ctx, TrendingOptions{Likeable: "post", Window: 24 * time.Hour, Limit: 1})
+	if err != nil {
+		t.Fatalf("Trending: %v", err)
+	}
+	if len(items) != 1 || items[0].LikeableId != "post-2" {
+		t.Errorf("limited Trending = %+v", items)
+	}
+}
+
+func TestTrendingGravity(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.TrendingGravity = 0
+	svc := NewLikeService(db, WithConfig(&cfg))
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		insertLikeAt(t, svc, fmt.Sprintf("user-%d", i), "post-1", now.Add(-20*time.Hour))
+	}
+	insertLikeAt(t, svc, "user-1", "post-2", now)
+
+	// Without gravity every like weighs the same, whatever its age.
+	items, err := svc.Trending(context.Background(), TrendingOptions{Likeable: "post", Window: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Trending: %v", err)
+	}
+	if len(items) != 2 || items[0].LikeableId != "post-1" || items[0].Score != 3 {
+		t.Errorf("Trending = %+v, want post-1 first with a score of 3", items)
+	}
+}
@@ -0,0 +1,264 @@
+package likeable
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+const (
+	// ErasureDelete erases a user's likes by deleting them.
+	ErasureDelete = "delete"
+	// ErasureAnonymize erases a user's likes by detaching them from the user
+	// and clearing their tracking data, so they are still counted.
+	ErasureAnonymize = "anonymize"
+)
+
+// UserDataProvider is implemented by plugins storing data about users, so the
+// plugin managing accounts can answer data subject requests: exporting the
+// data of a user, and erasing it when their account is deleted. Plugins
+// depending on "likeable" find the LikeablePlugin, which implements it, among
+// their injected dependencies.
+type UserDataProvider interface {
+	ExportUserData(ctx context.Context, userID string) (any, error)
+	EraseUserData(ctx context.Context, userID string) error
+}
+
+// UserDataExport is everything the plugin stores about a user: the likes they
+// made, in full, and the likes they received as a liked user, stripped of
+// the identity of their likers.
+type UserDataExport struct {
+	UserID     string      `json:"userId"`
+	ExportedAt time.Time   `json:"exportedAt"`
+	Likes      []Like      `json:"likes"`
+	Received   []LikedItem `json:"received"`
+}
+
+// ErasureResult reports the likes affected by EraseUserData.
+type ErasureResult struct {
+	Deleted    int64 `json:"deleted"`
+	Anonymized int64 `json:"anonymized"`
+}
+
+// ExportUserData returns the likes made by userID and the likes they received.
+func (s *LikeService) ExportUserData(ctx context.Context, userID string) (UserDataExport, error) {
+	export := UserDataExport{UserID: userID, ExportedAt: time.Now().UTC(), Likes: []Like{}, Received: []LikedItem{}}
+
+	made, err := s.userLikes(ctx, s.db, query.Eq("liker_id", userID))
+	if err != nil {
+		return export, err
+	}
+	export.Likes = append(export.Likes, made...)
+
+	received, err := s.userLikes(ctx, s.db, query.Eq("liked_id", userID))
+	if err != nil {
+		return export, err
+	}
+	for _, like := range received {
+		export.Received = append(export.Received, LikedItem{
+			Likeable:   like.Likeable,
+			LikeableId: like.LikeableId,
+			Reaction:   like.Reaction,
+			LikedAt:    like.LikedAt,
+		})
+	}
+	return export, nil
+}
+
+// EraseUserData erases the likes made by userID, deleting or anonymizing them
+// according to mode, and deletes the likes they received, whose target goes
+// away with the user, along with their fraud flags and shadow ban. The events
+// logged for webhooks and the outbox are kept for their consumers but lose
+// the user's id, the like.deleted events of the erasure included. Counters
+// are updated in the same transaction.
+func (s *LikeService) EraseUserData(ctx context.Context, userID, mode string) (ErasureResult, error) {
+	var result ErasureResult
+	if mode != ErasureDelete && mode != ErasureAnonymize {
+		return result, fmt.Errorf("erasure mode must be %q or %q", ErasureDelete, ErasureAnonymize)
+	}
+
+	err := s.withTx(ctx, func(tx database.Database) error {
+		received, err := s.userLikes(ctx, tx, query.Eq("liked_id", userID))
+		if err != nil {
+			return err
+		}
+		// A user liking themselves made and received the same like, which is
+		// deleted with the received ones.
+		made, err := s.userLikes(ctx, tx, query.And(query.Eq("liker_id", userID), query.Or(query.IsNull("liked_id"), query.Not(query.Eq("liked_id", userID)))))
+		if err != nil {
+			return err
+		}
+
+		deleted := received
+		if mode == ErasureDelete {
+			deleted = append(deleted, made...)
+		} else if err := s.anonymizeLikes(ctx, tx, made); err != nil {
+			return err
+		}
+		deleted, err = s.deleteLikes(ctx, tx, deleted)
+		if err != nil {
+			return err
+		}
+		// Fraud flags and shadow bans hold the identity of their liker.
+		for _, table := range []string{likeFlagsTable, shadowBansTable} {
+			if err := s.deleteRows(ctx, tx, table, query.Eq("liker_id", userID)); err != nil {
+				return err
+			}
+		}
+		if err := forgetInEvents(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		result.Deleted = int64(len(deleted))
+		if mode == ErasureAnonymize {
+			result.Anonymized = int64(len(made))
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (s *LikeService) userLikes(ctx context.Context, db database.Database, condition query.Condition) ([]Like, error) {
+	result, err := crud.New[Like](db).GetAllPaginated(ctx, crud.PaginationOptions{
+		Conditions: []query.Condition{condition},
+		OrderBy:    []crud.OrderByClause{{Column: "liked_at", Direction: query.ASC}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// anonymizeLikes turns likes into anonymous likes without any identity.
+func (s *LikeService) anonymizeLikes(ctx context.Context, db database.Database, likes []Like) error {
+	if len(likes) == 0 {
+		return nil
+	}
+
+	ids := make([]any, len(likes))
+	for i, like := range likes {
+		ids[i] = like.Id
+	}
+
+	q, args, err := query.New(db.Dialect()).
+		Update(likesTable).
+		Set("liker_id", nil).
+		Set("ip_address", nil).
+		Set("ip_network", nil).
+		Set("user_agent", nil).
+		Set("anonymous_id", nil).
+		Where(query.In("id", ids...)).
+		Build()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(ctx, q, args...); err != nil {
+		return err
+	}
+	s.invalidate(ctx, db, likes)
+	return nil
+}
+
+// forgetInEvents clears userID from the likes of the events logged for
+// webhooks and the outbox, whether already sent or not.
+func forgetInEvents(ctx context.Context, db database.Database, userID string) error {
+	err := rewritePayloads(ctx, db, webhookDeliveriesTable, userID, func(payload []byte) ([]byte, error) {
+		var event LikeEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		event.Like.forget(userID)
+		return json.Marshal(event)
+	})
+	if err != nil {
+		return err
+	}
+	return rewritePayloads(ctx, db, likeEventsTable, userID, func(payload []byte) ([]byte, error) {
+		var like EventLike
+		if err := json.Unmarshal(payload, &like); err != nil {
+			return nil, err
+		}
+		like.forget(userID)
+		return json.Marshal(like)
+	})
+}
+
+// forget clears the liker or liked user of the like when it is userID, and
+// the id of its target when that is the user.
+func (l *EventLike) forget(userID string) {
+	if l.Likeable == "user" && l.LikeableId == userID {
+		l.LikeableId = ""
+	}
+	if l.LikerId != nil && *l.LikerId == userID {
+		l.LikerId = nil
+	}
+	if l.LikedId != nil && *l.LikedId == userID {
+		l.LikedId = nil
+	}
+}
+
+// rewritePayloads passes the JSON payloads of table mentioning userID
+// through rewrite, and stores the ones it changed.
+func rewritePayloads(ctx context.Context, db database.Database, table, userID string, rewrite func([]byte) ([]byte, error)) error {
+	id, err := json.Marshal(userID)
+	if err != nil {
+		return err
+	}
+	q, args, err := query.New(db.Dialect()).
+		Select("id", "payload").
+		From(table).
+		Where(query.Or(
+			query.Like("payload", `%"likerId":`+string(id)+`%`),
+			query.Like("payload", `%"likedId":`+string(id)+`%`),
+			query.Like("payload", `%"likeableId":`+string(id)+`%`),
+		)).
+		Build()
+	if err != nil {
+		return err
+	}
+	rows, err := db.Query(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	payloads := make(map[string]string)
+	for rows.Next() {
+		var rowID, payload string
+		if err := rows.Scan(&rowID, &payload); err != nil {
+			rows.Close()
+			return err
+		}
+		payloads[rowID] = payload
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for rowID, payload := range payloads {
+		rewritten, err := rewrite([]byte(payload))
+		if err != nil {
+			return err
+		}
+		if string(rewritten) == payload {
+			continue
+		}
+		q, args, err := query.New(db.Dialect()).
+			Update(table).
+			Set("payload", string(rewritten)).
+			Where(query.Eq("id", rowID)).
+			Build()
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(ctx, q, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package likeable
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func seedUserData(t *testing.T, svc *LikeService) {
+	t.Helper()
+	ctx := context.Background()
+
+	userLike := func(likerID, likedID string) *Like {
+		like := newLike(likerID, likedID, "like")
+		like.Likeable = "user"
+		like.LikedId = ptr(likedID)
+		return like
+	}
+	made := newLike("user-1", "post-1", "like")
+	made.IpAddress = ptr("203.0.113.7")
+	for _, like := range []*Like{
+		made,
+		newLike("user-1", "post-2", "love"),
+		newLike("user-2", "post-1", "like"),
+		userLike("user-2", "user-1"),
+		userLike("user-1", "user-1"),
+		userLike("user-1", "user-2"),
+	} {
+		if _, err := svc.Like(ctx, like); err != nil {
+			t.Fatalf("Like: %v", err)
+		}
+	}
+}
+
+func TestExportUserData(t *testing.T) {
+	svc := NewLikeService(newTestDB(t))
+	seedUserData(t, svc)
+
+	export, err := svc.ExportUserData(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("ExportUserData: %v", err)
+	}
+	if export.UserID != "user-1" || len(export.Likes) != 4 || len(export.Received) != 2 {
+		t.Fatalf("ExportUserData = %d likes and %d received, want 4 and 2", len(export.Likes), len(export.Received))
+	}
+	for _, like := range export.Likes {
+		if like.LikerId == nil || *like.LikerId != "user-1" {
+			t.Errorf("exported like %s was not made by user-1", like.Id)
+		}
+	}
+	if export.Likes[0].IpAddress == nil {
+		t.Error("exported likes should include their tracking data")
+	}
+}
+
+func TestEraseUserData(t *testing.T) {
+	for _, mode := range []string{ErasureDelete, ErasureAnonymize} {
+		t.Run(mode, func(t *testing.T) {
+			svc := NewLikeService(newTestDB(t))
+			ctx := context.Background()
+			seedUserData(t, svc)
+
+			result, err := svc.EraseUserData(ctx, "user-1", mode)
+			if err != nil {
+				t.Fatalf("EraseUserData: %v", err)
+			}
+			want := ErasureResult{Deleted: 5}
+			if mode == ErasureAnonymize {
+				want = ErasureResult{Deleted: 2, Anonymized: 3}
+			}
+			if result != want {
+				t.Errorf("EraseUserData = %+v, want %+v", result, want)
+			}
+
+			export, err := svc.ExportUserData(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("ExportUserData: %v", err)
+			}
+			if len(export.Likes) != 0 || len(export.Received) != 0 {
+				t.Errorf("user-1 still has %d likes and %d received", len(export.Likes), len(export.Received))
+			}
+
+			wantPost := int64(1)
+			if mode == ErasureAnonymize {
+				wantPost = 2
+			}
+			count, err := svc.Count(ctx, "post", "post-1")
+			if err != nil {
+				t.Fatalf("Count: %v", err)
+			}
+			if count.Total != wantPost {
+				t.Errorf("Count = %d, want %d", count.Total, wantPost)
+			}
+			count, err = svc.Count(ctx, "user", "user-1")
+			if err != nil {
+				t.Fatalf("Count: %v", err)
+			}
+			if count.Total != 0 {
+				t.Errorf("user-1 received likes still counted: %d", count.Total)
+			}
+
+			report, err := svc.Reconcile(ctx, ReconcileOptions{})
+			if err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+			if len(report.Discrepancies) != 0 {
+				t.Errorf("counters drifted: %+v", report.Discrepancies)
+			}
+		})
+	}
+
+	if _, err := NewLikeService(newTestDB(t)).EraseUserData(context.Background(), "user-1", "shred"); err == nil {
+		t.Error("EraseUserData with an unknown mode should fail")
+	}
+}
+
+func TestEraseUserDataForgetsEvents(t *testing.T) {
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.EnableUserLikes = true
+	cfg.Outbox = true
+	cfg.Webhooks = []WebhookEndpoint{{URL: "https://example.com/hooks", Secret: testWebhookSecret}}
+	svc := NewLikeService(db, WithConfig(&cfg))
+	ctx := context.Background()
+	seedUserData(t, svc)
+
+	if _, err := svc.EraseUserData(ctx, "user-1", ErasureDelete); err != nil {
+		t.Fatalf("EraseUserData: %v", err)
+	}
+
+	for _, table := range []string{webhookDeliveriesTable, likeEventsTable} {
+		rows, err := db.Query(ctx, "SELECT event, payload FROM "+table)
+		if err != nil {
+			t.Fatalf("read %s: %v", table, err)
+		}
+		var deleted int
+		for rows.Next() {
+			var event, payload string
+			if err := rows.Scan(&event, &payload); err != nil {
+				t.Fatalf("scan %s: %v", table, err)
+			}
+			if strings.Contains(payload, `"user-1"`) {
+				t.Errorf("%s keeps the erased user in %s", table, payload)
+			}
+			if event == EventLikeDeleted {
+				deleted++
+			}
+		}
+		rows.Close()
+		if deleted != 5 {
+			t.Errorf("%s logged %d deletions, want the 5 erased likes", table, deleted)
+		}
+	}
+}
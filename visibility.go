@@ -0,0 +1,119 @@
+package likeable
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nicolasbonnici/gorest/hooks"
+	"github.com/nicolasbonnici/gorest/query"
+	"github.com/nicolasbonnici/gorest/rbac"
+)
+
+// restrictableFields are the like fields that can be withheld from callers
+// other than the liker and admins. The remaining fields identify the like and
+// its target, and are always public.
+var restrictableFields = map[string]bool{
+	"likerId":   true,
+	"likedId":   true,
+	"ipAddress": true,
+	"userAgent": true,
+	"updatedAt": true,
+	"createdAt": true,
+}
+
+// Viewer is the caller a like is rendered for.
+type Viewer struct {
+	Liker Liker
+	Admin bool
+}
+
+// CallerViewer resolves the viewer of the current request from its liker
+// identity and the roles set by the auth middleware.
+func CallerViewer(c fiber.Ctx, config *Config) Viewer {
+	roles, _ := rbac.GetRoles(c.Context())
+	return Viewer{Liker: CallerLiker(c), Admin: config.IsAdmin(roles)}
+}
+
+// canSee reports whether the viewer may see the non-public fields of like.
+func (v Viewer) canSee(like *Like) bool {
+	return v.Admin || v.Liker.Owns(like)
+}
+
+// visible returns the condition matching the likes the viewer may read at
+// all: every like for admins, likes counted on their target and the viewer's
+// own otherwise, so shadow likes are only seen by their liker. It is nil for
+// admins.
+func (v Viewer) visible() query.Condition {
+	if v.Admin {
+		return nil
+	}
+	if v.Liker.IsZero() {
+		return countedCondition()
+	}
+	return query.Or(countedCondition(), v.Liker.condition())
+}
+
+type viewerContextKey struct{}
+
+// withViewer makes the viewer of a request known to the hooks of the CRUD
+// reading likes for it.
+func withViewer(c fiber.Ctx, viewer Viewer) {
+	c.SetContext(context.WithValue(c.Context(), viewerContextKey{}, viewer))
+}
+
+// viewerFrom returns the viewer set by withViewer, a viewer with no
+// particular rights when there is none.
+func viewerFrom(ctx context.Context) Viewer {
+	viewer, _ := ctx.Value(viewerContextKey{}).(Viewer)
+	return viewer
+}
+
+// likeReadHooks are the CRUD hooks of the like routes. The processor renders
+// likes without knowing who for, so the likes are marked as they are read
+// with whether the viewer may see their non-public fields, which
+// LikeConverter withholds otherwise. Single likes the viewer may not read
+// are not found.
+type likeReadHooks struct {
+	*hooks.NoOpHooks[Like]
+}
+
+func newLikeReadHooks() likeReadHooks {
+	return likeReadHooks{NoOpHooks: hooks.NewNoOpHooks[Like]()}
+}
+
+func (h likeReadHooks) ModifySelectQuery(ctx context.Context, operation hooks.Operation, builder *query.SelectBuilder) (*query.SelectBuilder, bool) {
+	if operation != hooks.OperationGetByID {
+		return builder, false
+	}
+	visible := viewerFrom(ctx).visible()
+	if visible == nil {
+		return builder, false
+	}
+	return builder.Where(visible), true
+}
+
+func (h likeReadHooks) SerializeOne(ctx context.Context, operation hooks.Operation, model *Like) error {
+	model.revealed = viewerFrom(ctx).canSee(model)
+	return nil
+}
+
+func (h likeReadHooks) SerializeMany(ctx context.Context, operation hooks.Operation, models *[]Like) error {
+	viewer := viewerFrom(ctx)
+	for i := range *models {
+		(*models)[i].revealed = viewer.canSee(&(*models)[i])
+	}
+	return nil
+}
+
+// queryField returns the like field a list query parameter filters or
+// orders on: "field", "field[op]" or "order[field]".
+func queryField(key string) string {
+	if strings.HasPrefix(key, "order[") && strings.HasSuffix(key, "]") {
+		return key[len("order[") : len(key)-1]
+	}
+	if i := strings.IndexByte(key, '['); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
@@ -0,0 +1,124 @@
+package likeable
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestLikeConverterVisibility(t *testing.T) {
+	cfg := DefaultConfig()
+	converter := NewLikeConverter(&cfg)
+	like := *newLike("user-1", "post-1", "like")
+	like.IpAddress = ptr("192.0.2.1")
+	like.UserAgent = ptr("Mozilla/5.0")
+
+	tests := []struct {
+		name    string
+		viewer  Viewer
+		visible bool
+	}{
+		{"anonymous", Viewer{}, false},
+		{"other user", Viewer{Liker: Liker{UserID: "user-2"}}, false},
+		{"liker", Viewer{Liker: Liker{UserID: "user-1"}}, true},
+		{"admin", Viewer{Admin: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dto := converter.ModelToResponseDTOFor(like, tt.viewer)
+			if visible := dto.IPAddress != nil && dto.UserAgent != nil; visible != tt.visible {
+				t.Errorf("tracking fields visible = %v, want %v", visible, tt.visible)
+			}
+			if dto.LikerID == nil || dto.LikeableID != "post-1" {
+				t.Errorf("public fields missing from %+v", dto)
+			}
+		})
+	}
+
+	if dto := converter.ModelToResponseDTO(like); dto.IPAddress != nil {
+		t.Error("ModelToResponseDTO should render for a caller without rights")
+	}
+
+	cfg.PublicFields = []string{"userAgent"}
+	dto := converter.ModelToResponseDTOFor(like, Viewer{})
+	if dto.UserAgent == nil || dto.IPAddress != nil || dto.LikerID != nil {
+		t.Errorf("with only userAgent public, got %+v", dto)
+	}
+}
+
+func TestLikeRoutesVisibility(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AnonymousSecret = testAnonymousSecret
+	hooks := NewLikeHooks(newTestDB(t), &cfg)
+
+	app := fiber.New()
+	app.Use(anonymousMiddleware(NewDeviceTokens(cfg.AnonymousSecret), &cfg))
+	registerLikeRoutes(app, hooks)
+	tokens := NewDeviceTokens(testAnonymousSecret)
+	likerID, likerToken := tokens.Issue()
+	_, otherToken := tokens.Issue()
+
+	like := newDeviceLike(likerID, "post-1")
+	like.IpAddress = ptr("192.0.2.1")
+	if err := hooks.service.Create(context.Background(), like); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	get := func(target, token string, body any) {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set(cfg.AnonymousHeaderName, token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+			t.Fatalf("decode %s: %v", target, err)
+		}
+	}
+	for _, tt := range []struct {
+		token   string
+		visible bool
+	}{{likerToken, true}, {otherToken, false}} {
+		var one LikeResponseDTO
+		get("/likes/"+like.Id, tt.token, &one)
+		var list struct {
+			Members []LikeResponseDTO `json:"hydra:member"`
+		}
+		get("/likes", tt.token, &list)
+
+		if visible := one.IPAddress != nil; visible != tt.visible {
+			t.Errorf("GET /likes/:id ipAddress visible = %v, want %v", visible, tt.visible)
+		}
+		if len(list.Members) != 1 || (list.Members[0].IPAddress != nil) != tt.visible {
+			t.Errorf("GET /likes = %+v, want ipAddress visible = %v", list.Members, tt.visible)
+		}
+	}
+}
+
+func TestQueryField(t *testing.T) {
+	tests := map[string]string{
+		"ipAddress":       "ipAddress",
+		"ipAddress[like]": "ipAddress",
+		"order[likedAt]":  "likedAt",
+		"limit":           "limit",
+	}
+	for key, want := range tests {
+		if got := queryField(key); got != want {
+			t.Errorf("queryField(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	cfg := DefaultConfig()
+	if !cfg.IsAdmin([]string{"user", "admin"}) {
+		t.Error("admin role should be recognized")
+	}
+	if cfg.IsAdmin([]string{"user"}) || cfg.IsAdmin(nil) {
+		t.Error("non-admin roles should not be recognized")
+	}
+}
@@ -0,0 +1,344 @@
+package likeable
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/logger"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// minWebhookSecretLength keeps webhook signatures out of brute-force reach.
+const minWebhookSecretLength = 32
+
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+// webhookBatchSize is the number of due deliveries sent per round.
+const webhookBatchSize = 100
+
+// WebhookEndpoint is a URL notified of like events, with the secret signing
+// them. Types and Events restrict the notifications to some likeable types
+// and events; empty means all of them.
+type WebhookEndpoint struct {
+	URL    string   `json:"url" yaml:"url"`
+	Secret string   `json:"secret" yaml:"secret"`
+	Types  []string `json:"types" yaml:"types"`
+	Events []string `json:"events" yaml:"events"`
+}
+
+func (e WebhookEndpoint) validate() error {
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", e.URL)
+	}
+	if len(e.Secret) < minWebhookSecretLength {
+		return fmt.Errorf("secret of %s must be at least %d characters", e.URL, minWebhookSecretLength)
+	}
+	for _, event := range e.Events {
+		if event != EventLikeCreated && event != EventLikeDeleted {
+			return fmt.Errorf("unknown event %q for %s", event, e.URL)
+		}
+	}
+	return nil
+}
+
+func (e WebhookEndpoint) subscribes(event, likeableType string) bool {
+	return (len(e.Events) == 0 || contains(e.Events, event)) &&
+		(len(e.Types) == 0 || contains(e.Types, likeableType))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookPayload is the JSON body POSTed to webhook endpoints. Id identifies
+// the event: it is the same across retries, so receivers can deduplicate.
+// Sequence is zero, and left out of the body: only events published from the
+// outbox are numbered.
+type WebhookPayload = LikeEvent
+
+// WebhookLike is the like an event is about. Tracking data is never sent.
+type WebhookLike = EventLike
+
+// WebhookDelivery is a row of the delivery log: one event to send to one
+// endpoint, with the outcome of its attempts.
+type WebhookDelivery struct {
+	Id             string     `json:"id" db:"id"`
+	EventId        string     `json:"eventId" db:"event_id"`
+	Event          string     `json:"event" db:"event"`
+	Url            string     `json:"url" db:"url"`
+	Payload        string     `json:"payload" db:"payload"`
+	Status         string     `json:"status" db:"status"`
+	Attempts       int        `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt" db:"next_attempt_at"`
+	LastError      *string    `json:"lastError,omitempty" db:"last_error"`
+	ResponseStatus *int       `json:"responseStatus,omitempty" db:"response_status"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty" db:"delivered_at"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "like_webhook_deliveries"
+}
+
+var webhookDeliveriesTable = WebhookDelivery{}.TableName()
+
+// SignWebhook returns the X-Likeable-Signature of a webhook request: the
+// hex-encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with the endpoint
+// secret, prefixed with "sha256=". Receivers recompute it to authenticate the
+// request, and reject stale timestamps to prevent replays.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueueWebhooks logs a delivery of each event to every endpoint subscribed
+// to it. It runs in the transaction writing the likes, so deliveries are
+// logged if and only if the write commits.
+func (s *LikeService) enqueueWebhooks(ctx context.Context, db database.Database, events []LikeEvent) error {
+	if len(s.config.Webhooks) == 0 {
+		return nil
+	}
+
+	deliveries := crud.New[WebhookDelivery](db)
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		for _, endpoint := range s.config.Webhooks {
+			if !endpoint.subscribes(event.Event, event.Like.Likeable) {
+				continue
+			}
+			err := deliveries.Create(ctx, WebhookDelivery{
+				Id:            uuid.New().String(),
+				EventId:       event.Id,
+				Event:         event.Event,
+				Url:           endpoint.URL,
+				Payload:       string(payload),
+				Status:        deliveryPending,
+				NextAttemptAt: event.OccurredAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WebhookDispatcher sends the deliveries logged by the service, retrying
+// failed ones with exponential backoff until they succeed or run out of
+// attempts. Deliveries are persisted, so they survive restarts, and claimed
+// before being sent, so several instances can dispatch the same log.
+type WebhookDispatcher struct {
+	db     database.Database
+	config *Config
+	client *http.Client
+}
+
+// NewWebhookDispatcher returns a dispatcher for the endpoints of config.
+func NewWebhookDispatcher(db database.Database, config *Config) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:     db,
+		config: config,
+		client: &http.Client{Timeout: config.WebhookTimeout},
+	}
+}
+
+// Run delivers due webhooks every WebhookPollInterval until ctx is done.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.WebhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			sent, err := d.DeliverDue(ctx)
+			if err != nil {
+				logger.Log.Error("likeable: delivering webhooks", "error", err)
+			}
+			if err != nil || sent < webhookBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// DeliverDue sends a batch of the pending deliveries whose next attempt is
+// due, and returns how many it attempted.
+func (d *WebhookDispatcher) DeliverDue(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	due, err := crud.New[WebhookDelivery](d.db).GetAllPaginated(ctx, crud.PaginationOptions{
+		Conditions: []query.Condition{
+			query.Eq("status", deliveryPending),
+			query.Lte("next_attempt_at", now),
+		},
+		OrderBy: []crud.OrderByClause{{Column: "next_attempt_at", Direction: query.ASC}},
+		Limit:   webhookBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for _, delivery := range due.Items {
+		claimed, err := d.claim(ctx, &delivery, now)
+		if err != nil {
+			return attempted, err
+		}
+		if !claimed {
+			continue
+		}
+		attempted++
+		if err := d.finish(ctx, delivery, d.send(ctx, delivery)); err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// claim counts an attempt of delivery, unless another dispatcher counted it
+// first, and pushes its next attempt past the request timeout so a
+// dispatcher crashing mid-request does not hold it forever.
+func (d *WebhookDispatcher) claim(ctx context.Context, delivery *WebhookDelivery, now time.Time) (bool, error) {
+	q, args, err := query.New(d.db.Dialect()).
+		Update(webhookDeliveriesTable).
+		Set("attempts", delivery.Attempts+1).
+		Set("next_attempt_at", now.Add(2*d.config.WebhookTimeout)).
+		Where(query.And(
+			query.Eq("id", delivery.Id),
+			query.Eq("status", deliveryPending),
+			query.Eq("attempts", delivery.Attempts),
+		)).
+		Build()
+	if err != nil {
+		return false, err
+	}
+	result, err := d.db.Exec(ctx, q, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	delivery.Attempts++
+	return affected == 1, nil
+}
+
+// deliveryResult is the outcome of one attempt.
+type deliveryResult struct {
+	status int
+	err    error
+}
+
+func (d *WebhookDispatcher) send(ctx context.Context, delivery WebhookDelivery) deliveryResult {
+	endpoint, ok := d.endpoint(delivery.Url)
+	if !ok {
+		return deliveryResult{err: errors.New("endpoint is no longer configured")}
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return deliveryResult{err: err}
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gorest-likeable-webhooks")
+	req.Header.Set("X-Likeable-Event", delivery.Event)
+	req.Header.Set("X-Likeable-Delivery", delivery.EventId)
+	req.Header.Set("X-Likeable-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Likeable-Signature", SignWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return deliveryResult{err: err}
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return deliveryResult{status: resp.StatusCode, err: fmt.Errorf("endpoint responded %s", resp.Status)}
+	}
+	return deliveryResult{status: resp.StatusCode}
+}
+
+func (d *WebhookDispatcher) endpoint(url string) (WebhookEndpoint, bool) {
+	for _, endpoint := range d.config.Webhooks {
+		if endpoint.URL == url {
+			return endpoint, true
+		}
+	}
+	return WebhookEndpoint{}, false
+}
+
+// finish records the outcome of an attempt: the delivery is done when it
+// succeeded, failed for good once out of attempts, and retried later
+// otherwise.
+func (d *WebhookDispatcher) finish(ctx context.Context, delivery WebhookDelivery, result deliveryResult) error {
+	now := time.Now().UTC()
+	ub := query.New(d.db.Dialect()).Update(webhookDeliveriesTable)
+	if result.status != 0 {
+		ub = ub.Set("response_status", result.status)
+	}
+
+	switch {
+	case result.err == nil:
+		ub = ub.Set("status", deliveryDelivered).Set("delivered_at", now).Set("last_error", nil)
+	case delivery.Attempts >= d.config.WebhookMaxAttempts:
+		ub = ub.Set("status", deliveryFailed).Set("last_error", result.err.Error())
+	default:
+		ub = ub.Set("next_attempt_at", now.Add(d.backoff(delivery.Attempts))).Set("last_error", result.err.Error())
+	}
+
+	q, args, err := ub.Where(query.Eq("id", delivery.Id)).Build()
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(ctx, q, args...)
+	return err
+}
+
+// backoff is the delay before the attempt following the given one: it
+// doubles from WebhookBackoff up to WebhookMaxBackoff.
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.WebhookBackoff
+	for i := 1; i < attempts && delay < d.config.WebhookMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.config.WebhookMaxBackoff)
+}
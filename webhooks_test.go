@@ -0,0 +1,191 @@
+package likeable
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+)
+
+const testWebhookSecret = "0123456789abcdef0123456789abcdef"
+
+// webhookReceiver is a test endpoint answering with the given statuses in
+// turn, then 200, and recording the payloads it accepted.
+type webhookReceiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	received []LikeEvent
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	timestamp, _ := strconv.ParseInt(req.Header.Get("X-Likeable-Timestamp"), 10, 64)
+	if req.Header.Get("X-Likeable-Signature") != SignWebhook(testWebhookSecret, timestamp, body) {
+		r.t.Errorf("bad signature for %s", body)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		r.t.Errorf("decode payload: %v", err)
+	}
+	if bytes.Contains(body, []byte(`"sequence"`)) {
+		r.t.Errorf("payload %s carries a sequence", body)
+	}
+	if req.Header.Get("X-Likeable-Delivery") != payload.Id || req.Header.Get("X-Likeable-Event") != payload.Event {
+		r.t.Errorf("headers do not match payload %+v", payload)
+	}
+	r.received = append(r.received, payload)
+}
+
+func webhookDeliveries(t *testing.T, db database.Database) []WebhookDelivery {
+	t.Helper()
+	page, err := crud.New[WebhookDelivery](db).GetAllPaginated(context.Background(), crud.PaginationOptions{})
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	return page.Items
+}
+
+// makeDue moves every pending delivery's next attempt to the past.
+func makeDue(t *testing.T, db database.Database) {
+	t.Helper()
+	past := time.Now().UTC().Add(-time.Minute)
+	if _, err := db.Exec(context.Background(), "UPDATE like_webhook_deliveries SET next_attempt_at = ?", past); err != nil {
+		t.Fatalf("make deliveries due: %v", err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	receiver := &webhookReceiver{t: t, statuses: []int{http.StatusInternalServerError}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.Webhooks = []WebhookEndpoint{
+		{URL: server.URL, Secret: testWebhookSecret, Types: []string{"post"}},
+		{URL: server.URL + "/comments", Secret: testWebhookSecret, Types: []string{"comment"}},
+	}
+	svc := NewLikeService(db, WithConfig(&cfg))
+	dispatcher := NewWebhookDispatcher(db, &cfg)
+	ctx := context.Background()
+
+	like := newLike("user-1", "post-1", "like")
+	if _, err := svc.Like(ctx, like); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if deliveries := webhookDeliveries(t, db); len(deliveries) != 1 || deliveries[0].Url != server.URL {
+		t.Fatalf("deliveries = %+v, want one to the post endpoint", deliveries)
+	}
+
+	if sent, err := dispatcher.DeliverDue(ctx); err != nil || sent != 1 {
+		t.Fatalf("DeliverDue = %d, %v, want one failed attempt", sent, err)
+	}
+	delivery := webhookDeliveries(t, db)[0]
+	if delivery.Status != deliveryPending || delivery.Attempts != 1 || delivery.LastError == nil ||
+		delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("after a failure, delivery = %+v", delivery)
+	}
+	if !delivery.NextAttemptAt.After(time.Now()) {
+		t.Error("a failed delivery should be retried later")
+	}
+	if sent, _ := dispatcher.DeliverDue(ctx); sent != 0 {
+		t.Error("a delivery should not be retried before its backoff")
+	}
+
+	makeDue(t, db)
+	if sent, err := dispatcher.DeliverDue(ctx); err != nil || sent != 1 {
+		t.Fatalf("DeliverDue = %d, %v, want the retry", sent, err)
+	}
+	delivery = webhookDeliveries(t, db)[0]
+	if delivery.Status != deliveryDelivered || delivery.Attempts != 2 || delivery.DeliveredAt == nil {
+		t.Errorf("after a retry, delivery = %+v", delivery)
+	}
+
+	if err := svc.Unlike(ctx, "user-1", "post", "post-1"); err != nil {
+		t.Fatalf("Unlike: %v", err)
+	}
+	if _, err := dispatcher.DeliverDue(ctx); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+
+	if len(receiver.received) != 2 {
+		t.Fatalf("received %d payloads, want 2", len(receiver.received))
+	}
+	created, deleted := receiver.received[0], receiver.received[1]
+	if created.Event != EventLikeCreated || created.Like.Id != like.Id || created.Like.LikeableId != "post-1" {
+		t.Errorf("created payload = %+v", created)
+	}
+	if deleted.Event != EventLikeDeleted || deleted.Like.Id != like.Id || deleted.Id == created.Id {
+		t.Errorf("deleted payload = %+v", deleted)
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	receiver := &webhookReceiver{t: t, statuses: []int{http.StatusBadGateway, http.StatusBadGateway}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	db := newTestDB(t)
+	cfg := DefaultConfig()
+	cfg.Webhooks = []WebhookEndpoint{{URL: server.URL, Secret: testWebhookSecret, Events: []string{EventLikeCreated}}}
+	cfg.WebhookMaxAttempts = 2
+	svc := NewLikeService(db, WithConfig(&cfg))
+	dispatcher := NewWebhookDispatcher(db, &cfg)
+	ctx := context.Background()
+
+	if _, err := svc.Like(ctx, newLike("user-1", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if err := svc.Unlike(ctx, "user-1", "post", "post-1"); err != nil {
+		t.Fatalf("Unlike: %v", err)
+	}
+	if deliveries := webhookDeliveries(t, db); len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want only the subscribed event", len(deliveries))
+	}
+
+	for i := 0; i < 3; i++ {
+		makeDue(t, db)
+		if _, err := dispatcher.DeliverDue(ctx); err != nil {
+			t.Fatalf("DeliverDue: %v", err)
+		}
+	}
+	delivery := webhookDeliveries(t, db)[0]
+	if delivery.Status != deliveryFailed || delivery.Attempts != 2 {
+		t.Errorf("delivery = %+v, want failed after 2 attempts", delivery)
+	}
+	if len(receiver.received) != 0 {
+		t.Error("a delivery should not be sent once it failed")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.WebhookBackoff = time.Second
+	cfg.WebhookMaxBackoff = 10 * time.Second
+	d := NewWebhookDispatcher(nil, &cfg)
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 50: 10 * time.Second} {
+		if got := d.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package likeable
+
+import (
+	"context"
+
+	"github.com/nicolasbonnici/gorest/crud"
+	"github.com/nicolasbonnici/gorest/database"
+	"github.com/nicolasbonnici/gorest/query"
+)
+
+// Create inserts like and bumps its counter in a single transaction.
+// Duplicates are rejected by the unique indexes, and with ErrAlreadyLiked
+// when they escape them.
+func (s *LikeService) Create(ctx context.Context, like *Like) error {
+	return s.withTx(ctx, func(tx database.Database) error {
+		if err := s.checkHeld(ctx, tx, like); err != nil {
+			return err
+		}
+		return s.insertLike(ctx, tx, like)
+	})
+}
+
+// checkHeld returns ErrAlreadyLiked when the liker of like already holds a
+// reaction Create has to refuse. The unique indexes are per reaction, so they
+// neither keep a liker to one reaction in single reaction mode nor catch
+// likes hashed under a retired pepper; both are checked within the inserting
+// transaction instead.
+func (s *LikeService) checkHeld(ctx context.Context, db database.Database, like *Like) error {
+	single := s.config.ReactionMode == ReactionModeSingle
+	rehashed := len(like.ipAliases) > 0 && like.LikerId == nil && like.AnonymousId == nil
+	if !single && !rehashed {
+		return nil
+	}
+
+	held, err := s.heldReactions(ctx, db, like)
+	if err != nil {
+		return err
+	}
+	for _, h := range held {
+		if single || h.Reaction == like.Reaction {
+			return ErrAlreadyLiked
+		}
+	}
+	return nil
+}
+
+// Delete removes the like with the given id and decrements its counter in a
+// single transaction. It returns ErrLikeNotFound when there is no such like.
+func (s *LikeService) Delete(ctx context.Context, id string) error {
+	return s.withTx(ctx, func(tx database.Database) error {
+		result, err := crud.New[Like](tx).GetAllPaginated(ctx, crud.PaginationOptions{
+			Conditions: []query.Condition{query.Eq("id", id)},
+		})
+		if err != nil {
+			return err
+		}
+		deleted, err := s.deleteLikes(ctx, tx, result.Items)
+		if err != nil {
+			return err
+		}
+		if len(deleted) == 0 {
+			return ErrLikeNotFound
+		}
+		return nil
+	})
+}
+
+// Like records like unless its liker already holds the same reaction on the
+// object, and reports whether a row was inserted. In single reaction mode any
+// other reaction of the liker on that object is replaced. A concurrent write
+// of the same reaction is not an error: the like is already there.
+func (s *LikeService) Like(ctx context.Context, like *Like) (bool, error) {
+	created := false
+	err := s.withTx(ctx, func(tx database.Database) error {
+		held, err := s.heldReactions(ctx, tx, like)
+		if err != nil {
+			return err
+		}
+		for _, h := range held {
+			if h.Reaction == like.Reaction {
+				return nil
+			}
+		}
+
+		if err := s.replaceHeld(ctx, tx, held); err != nil {
+			return err
+		}
+		if err := s.insertLike(ctx, tx, like); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	if err != nil && isUniqueViolation(err) {
+		return false, nil
+	}
+	return created, err
+}
+
+// Toggle removes like's reaction when its liker already holds it on the
+// object and records it otherwise, in a single transaction. It reports
+// whether the reaction is held afterwards, which it is when a concurrent
+// write recorded it first.
+func (s *LikeService) Toggle(ctx context.Context, like *Like) (bool, error) {
+	liked, _, err := s.toggle(ctx, like)
+	return liked, err
+}
+
+// toggle is Toggle, also reporting whether it wrote anything: a toggle losing
+// the race to a concurrent write of the same reaction, or to a concurrent
+// removal of it, leaves the likes as they are.
+func (s *LikeService) toggle(ctx context.Context, like *Like) (liked, changed bool, err error) {
+	err = s.withTx(ctx, func(tx database.Database) error {
+		held, err := s.heldReactions(ctx, tx, like)
+		if err != nil {
+			return err
+		}
+		for _, h := range held {
+			if h.Reaction == like.Reaction {
+				deleted, err := s.deleteLikes(ctx, tx, []Like{h})
+				changed = len(deleted) > 0
+				return err
+			}
+		}
+
+		if err := s.replaceHeld(ctx, tx, held); err != nil {
+			return err
+		}
+		if err := s.insertLike(ctx, tx, like); err != nil {
+			return err
+		}
+		liked, changed = true, true
+		return nil
+	})
+	if err != nil && isUniqueViolation(err) {
+		return true, false, nil
+	}
+	return liked, changed, err
+}
+
+// Withdraw removes the reactions like's liker holds on its object: only
+// like.Reaction when it is set, every reaction otherwise. It returns the
+// number of likes removed.
+func (s *LikeService) Withdraw(ctx context.Context, like *Like) (int64, error) {
+	var removed int64
+	err := s.withTx(ctx, func(tx database.Database) error {
+		held, err := s.heldReactions(ctx, tx, like)
+		if err != nil {
+			return err
+		}
+
+		matching := held[:0]
+		for _, h := range held {
+			if like.Reaction == "" || h.Reaction == like.Reaction {
+				matching = append(matching, h)
+			}
+		}
+		deleted, err := s.deleteLikes(ctx, tx, matching)
+		if err != nil {
+			return err
+		}
+		removed = int64(len(deleted))
+		return nil
+	})
+	return removed, err
+}
+
+// Unlike removes every reaction likerID holds on an object. It returns
+// ErrLikeNotFound when there is nothing to remove.
+func (s *LikeService) Unlike(ctx context.Context, likerID, likeableType, likeableID string) error {
+	return s.UnlikeByLiker(ctx, Liker{UserID: likerID}, likeableType, likeableID)
+}
+
+// UnlikeByLiker is Unlike for any liker, authenticated or anonymous.
+func (s *LikeService) UnlikeByLiker(ctx context.Context, liker Liker, likeableType, likeableID string) error {
+	if liker.IsZero() {
+		return ErrLikeNotFound
+	}
+
+	like := &Like{Likeable: likeableType, LikeableId: likeableID}
+	liker.apply(like)
+	removed, err := s.Withdraw(ctx, like)
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrLikeNotFound
+	}
+	return nil
+}
+
+// heldReactions loads the likes the author of like holds on its object.
+func (s *LikeService) heldReactions(ctx context.Context, db database.Database, like *Like) ([]Like, error) {
+	result, err := crud.New[Like](db).GetAllPaginated(ctx, crud.PaginationOptions{
+		Conditions: []query.Condition{
+			likerCondition(like),
+			query.Eq("likeable", like.Likeable),
+			query.Eq("likeable_id", like.LikeableId),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// replaceHeld clears the reactions a liker already holds when only one
+// reaction per object is allowed.
+func (s *LikeService) replaceHeld(ctx context.Context, db database.Database, held []Like) error {
+	if s.config.ReactionMode != ReactionModeSingle {
+		return nil
+	}
+	_, err := s.deleteLikes(ctx, db, held)
+	return err
+}
+
+// insertLike and deleteLikes are the only places likes are written, so they
+// shadow the likes of shadow-banned likers, keep the like_counts counters in
+// step, record fraud flags and emit the like events within the caller's
+// transaction, and invalidate the cached state of the objects once it
+// commits.
+func (s *LikeService) insertLike(ctx context.Context, db database.Database, like *Like) error {
+	// SQLite keeps timestamps as text, which only compares and truncates
+	// consistently when every like is written in the same zone: trending
+	// windows and histogram buckets rely on it.
+	like.LikedAt = like.LikedAt.UTC()
+	if s.tracking == nil && like.IpAddress != nil {
+		network := truncateIP(*like.IpAddress)
+		like.IpNetwork = &network
+	}
+	if err := s.shadowLike(ctx, db, like); err != nil {
+		return err
+	}
+	if err := crud.New[Like](db).Create(ctx, *like); err != nil {
+		return err
+	}
+	if like.flag != nil {
+		if err := s.recordFlag(ctx, db, like.flag); err != nil {
+			return err
+		}
+	}
+	s.invalidate(ctx, db, []Like{*like})
+	if err := s.emit(ctx, db, EventLikeCreated, []Like{*like}); err != nil {
+		return err
+	}
+	return s.adjustCounts(ctx, db, []Like{*like}, 1)
+}
+
+// deleteLikes deletes likes and returns the ones it removed: a concurrent
+// writer may have deleted some of them first, and those must not be counted
+// or announced twice.
+func (s *LikeService) deleteLikes(ctx context.Context, db database.Database, likes []Like) ([]Like, error) {
+	if len(likes) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]any, len(likes))
+	for i, like := range likes {
+		ids[i] = like.Id
+	}
+	removed, err := deleteLikeRows(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []Like
+	for _, like := range likes {
+		if removed[like.Id] {
+			deleted = append(deleted, like)
+		}
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+
+	s.invalidate(ctx, db, deleted)
+	if err := s.emit(ctx, db, EventLikeDeleted, deleted); err != nil {
+		return nil, err
+	}
+	return deleted, s.adjustCounts(ctx, db, deleted, -1)
+}
+
+// deleteLikeRows deletes the likes with the given ids and returns the ids of
+// the rows actually removed. Postgres and SQLite report them with RETURNING;
+// MySQL has no RETURNING, so the rows still there are locked and read first.
+func deleteLikeRows(ctx context.Context, db database.Database, ids []any) (map[string]bool, error) {
+	dialect := db.Dialect()
+	if !dialect.SupportsReturning() {
+		q, args, err := query.New(dialect).
+			Select("id").
+			From(likesTable).
+			Where(query.In("id", ids...)).
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		locked, err := scanIDs(ctx, db, q+" FOR UPDATE", args)
+		if err != nil || len(locked) == 0 {
+			return locked, err
+		}
+
+		ids = ids[:0]
+		for id := range locked {
+			ids = append(ids, id)
+		}
+		q, args, err = query.New(dialect).
+			Delete(likesTable).
+			Where(query.In("id", ids...)).
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec(ctx, q, args...); err != nil {
+			return nil, err
+		}
+		return locked, nil
+	}
+
+	q, args, err := query.New(dialect).
+		Delete(likesTable).
+		Where(query.In("id", ids...)).
+		Returning("id").
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(ctx, db, q, args)
+}
+
+// scanIDs runs q and collects the ids it returns.
+func scanIDs(ctx context.Context, db database.Database, q string, args []any) (map[string]bool, error) {
+	rows, err := db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
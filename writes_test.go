@@ -0,0 +1,168 @@
+package likeable
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newLike(likerID, likeableID, reaction string) *Like {
+	return &Like{
+		Id:         uuid.New().String(),
+		LikerId:    ptr(likerID),
+		LikeableId: likeableID,
+		Likeable:   "post",
+		Reaction:   reaction,
+		LikedAt:    time.Now(),
+	}
+}
+
+func TestToggle(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	liked, err := svc.Toggle(ctx, newLike("user-1", "post-1", "like"))
+	if err != nil {
+		t.Fatalf("Toggle: %v", err)
+	}
+	if !liked {
+		t.Error("first toggle should like")
+	}
+
+	liked, err = svc.Toggle(ctx, newLike("user-1", "post-1", "like"))
+	if err != nil {
+		t.Fatalf("Toggle: %v", err)
+	}
+	if liked {
+		t.Error("second toggle should unlike")
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 0 {
+		t.Errorf("count = %d, want 0", count.Total)
+	}
+
+	// A write rejected by a unique index is a race lost to a concurrent
+	// toggle, which made the change.
+	first := newLike("user-1", "post-2", "like")
+	if _, err := svc.Toggle(ctx, first); err != nil {
+		t.Fatalf("Toggle: %v", err)
+	}
+	racing := newLike("user-2", "post-2", "like")
+	racing.Id = first.Id
+	liked, changed, err := svc.toggle(ctx, racing)
+	if err != nil || !liked || changed {
+		t.Errorf("toggle losing a race = %v, %v, %v, want liked without a change", liked, changed, err)
+	}
+}
+
+func TestLikeReplacesReactionInSingleMode(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	if _, err := svc.Like(ctx, newLike("user-1", "post-1", "like")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	created, err := svc.Like(ctx, newLike("user-1", "post-1", "like"))
+	if err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+	if created {
+		t.Error("liking twice with the same reaction should be a no-op")
+	}
+
+	if _, err := svc.Like(ctx, newLike("user-1", "post-1", "love")); err != nil {
+		t.Fatalf("Like: %v", err)
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 || count.Reactions["love"] != 1 {
+		t.Errorf("count = %+v, want a single love reaction", count)
+	}
+}
+
+func TestCreateRefusesSecondReactionInSingleMode(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	if err := svc.Create(ctx, newLike("user-1", "post-1", "like")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := svc.Create(ctx, newLike("user-1", "post-1", "love")); !errors.Is(err, ErrAlreadyLiked) {
+		t.Fatalf("Create = %v, want ErrAlreadyLiked", err)
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 {
+		t.Errorf("count = %d, want 1", count.Total)
+	}
+}
+
+func TestLikeKeepsReactionsInMultipleMode(t *testing.T) {
+	db := newTestDB(t)
+	config := DefaultConfig()
+	config.ReactionMode = ReactionModeMultiple
+	svc := NewLikeService(db, WithConfig(&config))
+	ctx := context.Background()
+
+	for _, reaction := range []string{"like", "love"} {
+		if _, err := svc.Like(ctx, newLike("user-1", "post-1", reaction)); err != nil {
+			t.Fatalf("Like(%s): %v", reaction, err)
+		}
+	}
+
+	removed, err := svc.Withdraw(ctx, &Like{LikerId: ptr("user-1"), Likeable: "post", LikeableId: "post-1", Reaction: "love"})
+	if err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 || count.Reactions["like"] != 1 {
+		t.Errorf("count = %+v, want the like reaction only", count)
+	}
+}
+
+func TestUnlike(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewLikeService(db)
+	ctx := context.Background()
+
+	insertLike(t, db, ptr("user-1"), "post", "post-1")
+	insertLike(t, db, ptr("user-2"), "post", "post-1")
+
+	if err := svc.Unlike(ctx, "user-1", "post", "post-1"); err != nil {
+		t.Fatalf("Unlike: %v", err)
+	}
+	if err := svc.Unlike(ctx, "user-1", "post", "post-1"); !errors.Is(err, ErrLikeNotFound) {
+		t.Errorf("second Unlike error = %v, want ErrLikeNotFound", err)
+	}
+
+	count, err := svc.Count(ctx, "post", "post-1")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if count.Total != 1 {
+		t.Errorf("count = %d, want 1: only user-1's like should be removed", count.Total)
+	}
+}